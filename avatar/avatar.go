@@ -25,6 +25,7 @@
 package avatar
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -36,12 +37,21 @@ import (
 	"github.com/profburke/bgurt/bggclient"
 )
 
-var avatarRegEx *regexp.Regexp
+// avatarHost is where BGG serves avatar images from.
+//
+const avatarHost = "https://cf.geekdo-static.com"
+
+// ErrNoAvatar is returned by Get when the user hasn't set an avatar.
+//
+var ErrNoAvatar = errors.New("the user has no avatar")
+
+var noAvatarRegEx *regexp.Regexp
 var getAvatarURL *url.URL
 var setAvatarURL *url.URL
 
 func init() {
-	avatarRegEx = regexp.MustCompile("(https://cf.geekdo-static.com/avatars/avatar_id\\d+.(?:(?i)jpg|png|gif))")
+	// a profile without an avatar has an empty avatar box
+	noAvatarRegEx = regexp.MustCompile("<div class=['\"]profile_avatar['\"]>\\s*</div>")
 	var err error
 
 	getAvatarURL, err = url.Parse("myprofile")
@@ -56,28 +66,36 @@ func init() {
 }
 
 // Get retrieves the user's avatar and writes it to the file specified by the passed
-// in parameter.
+// in parameter. It returns ErrNoAvatar if the user has none, and a
+// *bggclient.LayoutError if the profile page shows neither an avatar nor its
+// absence.
+//
+func Get(client *bggclient.Client, filepath string) (err error) {
+	return GetContext(context.Background(), client, filepath)
+}
+
+// GetContext is like Get but gives up when ctx is done.
 //
-func Get(filepath string) (err error) {
-	page, err := bggclient.Get(getAvatarURL)
+func GetContext(ctx context.Context, client *bggclient.Client, filepath string) (err error) {
+	page, err := client.GetContext(ctx, getAvatarURL)
 	if err != nil {
-		message := fmt.Sprint("avatar.Get could not get page: %v", err)
-		return errors.New(message)
+		return fmt.Errorf("avatar.Get: could not get page: %w", err)
 	}
 
-	pieces := avatarRegEx.FindStringSubmatch(page)
+	pieces := avatarRegEx(client).FindStringSubmatch(page)
 	if len(pieces) != 2 {
-		message := fmt.Sprintf("avatar.Get could not parse avatar url: %v", err)
-		return errors.New(message)
+		if noAvatarRegEx.MatchString(page) {
+			return ErrNoAvatar
+		}
+		return &bggclient.LayoutError{Op: "avatar.Get", What: "avatar url"}
 	}
 
 	avatarURL, err := url.Parse(pieces[1])
 	if err != nil {
-		message := fmt.Sprintf("avatar.Get could not create avatar url: %v", err)
-		return errors.New(message)
+		return fmt.Errorf("avatar.Get: could not create avatar url: %w", err)
 	}
 
-	bytes, err := bggclient.Download(avatarURL)
+	bytes, err := client.DownloadContext(ctx, avatarURL)
 	if err != nil {
 		return
 	}
@@ -93,9 +111,26 @@ func Get(filepath string) (err error) {
 	return
 }
 
+// avatarRegEx matches the URL of an avatar image served by BGG's image host or, so
+// that a stand-in site such as bggclient/bggtest can serve its own, by the site
+// client talks to.
+//
+func avatarRegEx(client *bggclient.Client) *regexp.Regexp {
+	site := client.BaseURL()
+	hosts := regexp.QuoteMeta(avatarHost) + "|" + regexp.QuoteMeta(site.Scheme+"://"+site.Host)
+
+	return regexp.MustCompile("((?:" + hosts + ")/avatars/avatar_id\\d+\\.(?i:jpg|png|gif))")
+}
+
 // Set reads the avatar from the passed in file name and uploads it to the server.
 //
-func Set(filepath string) (err error) {
+func Set(client *bggclient.Client, filepath string) (err error) {
+	return SetContext(context.Background(), client, filepath)
+}
+
+// SetContext is like Set but gives up when ctx is done.
+//
+func SetContext(ctx context.Context, client *bggclient.Client, filepath string) (err error) {
 	fields := map[string]string{
 		"action":     "saveavatar",
 		"domainname": "boardgamegeek.com",
@@ -106,7 +141,7 @@ func Set(filepath string) (err error) {
 		return
 	}
 
-	err = bggclient.Upload(setAvatarURL, data, filepath, "filename", fields)
+	err = client.UploadContext(ctx, setAvatarURL, data, filepath, "filename", fields)
 
 	return
 }
@@ -0,0 +1,131 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package avatar
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/profburke/bgurt/bggclient"
+	"github.com/profburke/bgurt/bggclient/bggtest"
+)
+
+func TestSetAndGet(t *testing.T) {
+	server := bggtest.NewServer()
+	defer server.Close()
+	server.AddUser(bggtest.User{Username: "alice", PassHash: "hash"})
+
+	client, err := server.NewClient("alice")
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+
+	dir := t.TempDir()
+	image := []byte("GIF89a not really an image")
+	in := filepath.Join(dir, "meeple.gif")
+	if err := ioutil.WriteFile(in, image, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Set(client, in); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	out := filepath.Join(dir, "fetched.gif")
+	if err := Get(client, out); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+
+	got, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, image) {
+		t.Errorf("Get wrote %q, want %q", got, image)
+	}
+}
+
+func TestGetWithoutAvatar(t *testing.T) {
+	server := bggtest.NewServer()
+	defer server.Close()
+	server.AddUser(bggtest.User{Username: "alice", PassHash: "hash"})
+
+	client, err := server.NewClient("alice")
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	if err := Get(client, filepath.Join(t.TempDir(), "avatar")); !errors.Is(err, ErrNoAvatar) {
+		t.Errorf("Get without an avatar returned %v, want %v", err, ErrNoAvatar)
+	}
+
+	// a profile page that shows neither an avatar nor an empty avatar box
+	redesigned := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><body><div class="new-profile-picture"></div></body></html>`))
+	}))
+	defer redesigned.Close()
+
+	client, err = bggclient.New(bggclient.WithBaseURL(redesigned.URL), bggclient.WithRateLimit(0))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	var layoutErr *bggclient.LayoutError
+	if err := Get(client, filepath.Join(t.TempDir(), "avatar")); !errors.As(err, &layoutErr) {
+		t.Errorf("Get on a redesigned page returned %v, want a layout error", err)
+	}
+}
+
+func TestAvatarRegEx(t *testing.T) {
+	client, err := bggclient.New()
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	tests := []struct {
+		page string
+		want string
+	}{
+		{`<img src="https://cf.geekdo-static.com/avatars/avatar_id42.PNG">`, "https://cf.geekdo-static.com/avatars/avatar_id42.PNG"},
+		{`<img src="https://boardgamegeek.com/avatars/avatar_id42.gif">`, "https://boardgamegeek.com/avatars/avatar_id42.gif"},
+		{`<img src="https://example.com/avatars/avatar_id42.png">`, ""},
+		{`<img src="http://cf.geekdo-static.com/avatars/avatar_id42.png">`, ""},
+		{`<img src="https://cf.geekdo-static.com/avatars/avatar_idx.png">`, ""},
+	}
+
+	for _, test := range tests {
+		var got string
+		if pieces := avatarRegEx(client).FindStringSubmatch(test.page); len(pieces) == 2 {
+			got = pieces[1]
+		}
+		if got != test.want {
+			t.Errorf("avatar URL in %s is %q, want %q", test.page, got, test.want)
+		}
+	}
+}
+
+// Local Variables:
+// compile-command: "go test"
+// End:
@@ -0,0 +1,140 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package avatar
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif" // to decode GIF avatars and badges
+	_ "image/jpeg"
+	"image/png"
+	"os"
+)
+
+// Compose returns base with badges drawn over its bottom edge, the first badge
+// lowest and the rest stacked above it, each scaled down if need be to fit the
+// width of base. Badges that would not fit in its height are left out.
+//
+func Compose(base image.Image, badges []image.Image) *image.RGBA {
+	bounds := base.Bounds()
+	composed := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(composed, composed.Bounds(), base, bounds.Min, draw.Src)
+
+	bottom := composed.Bounds().Max.Y
+	for _, badge := range badges {
+		badge = fit(badge, composed.Bounds().Dx())
+		size := badge.Bounds().Size()
+		if size.Y > bottom {
+			break
+		}
+
+		// centre the badge horizontally
+		left := (composed.Bounds().Dx() - size.X) / 2
+		target := image.Rect(left, bottom-size.Y, left+size.X, bottom)
+		draw.Draw(composed, target, badge, badge.Bounds().Min, draw.Over)
+		bottom -= size.Y
+	}
+
+	return composed
+}
+
+// ComposeFile is like Compose for images in files: the avatar image in filename
+// and the badge images in badgeFilenames. It returns the result as a PNG.
+//
+func ComposeFile(filename string, badgeFilenames []string) (data []byte, err error) {
+	base, err := decodeFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("avatar.ComposeFile: %w", err)
+	}
+
+	badges := make([]image.Image, len(badgeFilenames))
+	for i, badgeFilename := range badgeFilenames {
+		if badges[i], err = decodeFile(badgeFilename); err != nil {
+			return nil, fmt.Errorf("avatar.ComposeFile: %w", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err = png.Encode(&buf, Compose(base, badges)); err != nil {
+		return nil, fmt.Errorf("avatar.ComposeFile: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func decodeFile(filename string) (image.Image, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	return img, nil
+}
+
+// fit returns img scaled down, keeping its proportions, to be no wider than
+// width. Each pixel of the result is the average of the pixels it covers.
+//
+func fit(img image.Image, width int) image.Image {
+	src := img.Bounds()
+	if src.Dx() <= width || src.Dx() == 0 {
+		return img
+	}
+
+	height := src.Dy() * width / src.Dx()
+	if height < 1 {
+		height = 1
+	}
+
+	scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := src.Min.Y+y*src.Dy()/height, src.Min.Y+(y+1)*src.Dy()/height
+		for x := 0; x < width; x++ {
+			x0, x1 := src.Min.X+x*src.Dx()/width, src.Min.X+(x+1)*src.Dx()/width
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r, g, b, a, n = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa), n+1
+				}
+			}
+			if n > 0 {
+				scaled.Set(x, y, color.RGBA64{uint16(r / n), uint16(g / n), uint16(b / n), uint16(a / n)})
+			}
+		}
+	}
+
+	return scaled
+}
+
+// Local Variables:
+// compile-command: "go build"
+// End:
@@ -0,0 +1,131 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package avatar
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func filled(width, height int, c color.Color) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, c)
+		}
+	}
+
+	return img
+}
+
+func TestCompose(t *testing.T) {
+	white := color.RGBA{255, 255, 255, 255}
+	red := color.RGBA{255, 0, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+
+	// a microbadge is 90x17, so it is scaled to 64x12
+	composed := Compose(filled(64, 64, white), []image.Image{filled(90, 17, red), filled(20, 10, blue)})
+
+	tests := []struct {
+		x, y int
+		want color.RGBA
+	}{
+		{0, 0, white},
+		{0, 51, white},
+		{0, 52, red},
+		{63, 63, red},
+		{10, 51, white},
+		{22, 41, white},
+		{22, 42, blue},
+		{41, 51, blue},
+		{42, 51, white},
+	}
+
+	if composed.Bounds() != image.Rect(0, 0, 64, 64) {
+		t.Fatalf("Compose() bounds == %v", composed.Bounds())
+	}
+	for _, test := range tests {
+		if got := composed.RGBAAt(test.x, test.y); got != test.want {
+			t.Errorf("pixel (%d, %d) == %v, want %v", test.x, test.y, got, test.want)
+		}
+	}
+
+	// badges that don't fit are left out
+	composed = Compose(filled(64, 16, white), []image.Image{filled(64, 10, red), filled(64, 10, blue)})
+	if got := composed.RGBAAt(0, 0); got != white {
+		t.Errorf("pixel (0, 0) == %v, want white", got)
+	}
+}
+
+func TestComposeFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, encode func(f *os.File) error) string {
+		filename := filepath.Join(dir, name)
+		f, err := os.Create(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if err := encode(f); err != nil {
+			t.Fatal(err)
+		}
+		return filename
+	}
+
+	base := write("avatar.png", func(f *os.File) error {
+		return png.Encode(f, filled(64, 64, color.RGBA{255, 255, 255, 255}))
+	})
+	badge := write("badge.gif", func(f *os.File) error {
+		return gif.Encode(f, filled(90, 17, color.RGBA{255, 0, 0, 255}), nil)
+	})
+
+	data, err := ComposeFile(base, []string{badge})
+	if err != nil {
+		t.Fatalf("ComposeFile: %v", err)
+	}
+	composed, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ComposeFile returned something other than a PNG: %v", err)
+	}
+	if r, g, _, _ := composed.At(10, 60).RGBA(); r>>8 != 255 || g>>8 != 0 {
+		t.Errorf("ComposeFile() didn't draw the badge: pixel (10, 60) == %v", composed.At(10, 60))
+	}
+
+	notImage := filepath.Join(dir, "not.gif")
+	if err := ioutil.WriteFile(notImage, []byte("GIF89a not really an image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ComposeFile(base, []string{notImage}); err == nil {
+		t.Error("ComposeFile with a bad badge image succeeded")
+	}
+}
+
+// Local Variables:
+// compile-command: "go test"
+// End:
@@ -21,70 +21,94 @@
 
 // This Lambda function fetches all the microbadges and stores the information as a JSON
 // file at the S3 Bucket path specified in the environment variables BUCKETNAME and ITEMNAME.
+// If the file is already there, the badges are merged into it, as mb-fetch does, and
+// the changes are logged.
 //
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"errors"
 	"log"
 
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/profburke/bgurt/aws/utilities"
 	"github.com/profburke/bgurt/bggclient"
 	"github.com/profburke/bgurt/microbadge"
 )
 
-func HandleRequest() {
+func HandleRequest(ctx context.Context) {
 	user := utilities.GetEnvOrDie("BGGUSERNAME")
 	passhash := utilities.GetEnvOrDie("BGGPASSHASH")
 	bucketname := utilities.GetEnvOrDie("BUCKETNAME")
 	itemname := utilities.GetEnvOrDie("ITEMNAME")
 
-	bggclient.SetCredentials(bggclient.Credentials{user, passhash})
+	client, err := bggclient.New(bggclient.WithCredentials(bggclient.Credentials{
+		Username: user,
+		PassHash: passhash,
+	}))
+	if err != nil {
+		log.Printf("Could not create BGG client: %v", err)
+		return
+	}
 
 	log.Println("Fetching microbadges...")
 
-	badges, err := microbadge.GetAll()
+	badges, err := microbadge.GetAllContext(ctx, client)
 	if err != nil {
 		log.Println("Could not get microbadges: ", err)
 	}
 
-	if badges != nil {
-		var jsonData []byte
-		jsonData, err := json.Marshal(badges)
-		if err != nil {
-			log.Println(err)
-		} else {
-			// TODO: handle error
-			awsSession, _ := session.NewSession(&aws.Config{
-				Region: aws.String("us-east-1"),
-			})
-
-			s3Uploader := s3manager.NewUploader(awsSession)
-
-			reader := bytes.NewReader(jsonData)
-
-			uploadInput := &s3manager.UploadInput{
-				Bucket: aws.String(bucketname),
-				Key:    aws.String(itemname),
-				Body:   reader,
-			}
-
-			_, err := s3Uploader.Upload(uploadInput)
-			if err != nil {
-				log.Println(err)
-			} else {
-				log.Printf("...uploaded micrboadges to %s:%s\n",
-					bucketname, itemname)
-			}
-		}
-	} else {
+	if badges == nil {
 		log.Println("...no badges")
+		return
+	}
+
+	bf, err := mergeBadges(ctx, bucketname, itemname, microbadge.NewBadgesFile(user, badges))
+	if err != nil {
+		log.Println(err)
+		return
 	}
+
+	jsonData, err := bf.Encode()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	if err := utilities.Upload(ctx, bucketname, itemname, jsonData); err != nil {
+		log.Println(err)
+	} else {
+		log.Printf("...uploaded micrboadges to %s:%s\n",
+			bucketname, itemname)
+	}
+}
+
+// mergeBadges merges the badges in bf into those already stored in the bucket,
+// if there are any, and logs what changed.
+//
+func mergeBadges(ctx context.Context, bucketname, itemname string, bf *microbadge.BadgesFile) (*microbadge.BadgesFile, error) {
+	data, err := utilities.Download(ctx, bucketname, itemname)
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) && awsErr.Code() == s3.ErrCodeNoSuchKey {
+		return bf, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	previous, err := microbadge.DecodeBadgesFile(data)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := previous.Merge(bf.Badges, bf.Fetched)
+	previous.Username = bf.Username
+	log.Printf("...%d new, %d no longer owned, %d updated\n",
+		len(changes.Added), len(changes.Disowned), len(changes.Updated))
+
+	return previous, nil
 }
 
 func main() {
@@ -27,6 +27,7 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
@@ -38,7 +39,7 @@ import (
 	"github.com/profburke/bgurt/aws/utilities"
 )
 
-func HandleRequest(notification utilities.Notification) (err error) {
+func HandleRequest(ctx context.Context, notification utilities.Notification) (err error) {
 	topicARN := utilities.GetEnvOrDie("TOPICARN")
 	awsRegion := utilities.GetEnvOrDefault("AWSREGION", "us-east-1")
 
@@ -53,7 +54,7 @@ func HandleRequest(notification utilities.Notification) (err error) {
 		TopicArn: aws.String(topicARN),
 	}
 
-	resp, err := snsService.Publish(params)
+	resp, err := snsService.PublishWithContext(ctx, params)
 	if err != nil {
 		log.Printf("error from call to snsService.Publish: %v", err)
 		return errors.New(fmt.Sprintf("error from call to snsService.Publish: %v", err))
@@ -1,15 +1,16 @@
 package main
 
 import (
+	"context"
 	"log"
 	"math/rand"
 	"strings"
-	"time"
 
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/profburke/bgurt/aws/utilities"
 	"github.com/profburke/bgurt/bggclient"
 	"github.com/profburke/bgurt/geekbadge"
+	"github.com/profburke/bgurt/history"
 	"golang.org/x/image/colornames"
 )
 
@@ -23,14 +24,12 @@ func init() {
 	boxColors = strings.Split(utilities.GetEnvOrDie("BGGBOXCOLORS"), ",")
 	leftWords = strings.Split(utilities.GetEnvOrDie("BGGLEFTWORDS"), ",")
 	rightWords = strings.Split(utilities.GetEnvOrDie("BGGRIGHTWORDS"), ",")
-
-	rand.Seed(time.Now().UnixNano())
 }
 
-func pickColors() (firstColor, secondColor string) {
-	firstColor = boxColors[rand.Intn(len(boxColors))]
+func pickColors(random *rand.Rand) (firstColor, secondColor string) {
+	firstColor = boxColors[random.Intn(len(boxColors))]
 	for {
-		secondColor = boxColors[rand.Intn(len(boxColors))]
+		secondColor = boxColors[random.Intn(len(boxColors))]
 		if firstColor != secondColor {
 			break
 		}
@@ -39,18 +38,51 @@ func pickColors() (firstColor, secondColor string) {
 	return
 }
 
-func HandleRequest() {
-	user := utilities.GetEnvOrDie("BGGUSERNAME")
-	passhash := utilities.GetEnvOrDie("BGGPASSHASH")
+// pickWord picks one of words for the given side of the badge, avoiding words the
+// rotation's policy rules out. The history records words as "side:word".
+//
+func pickWord(random *rand.Rand, rotation *utilities.Rotation, side string, words []string) string {
+	keys := make([]string, len(words))
+	for i, word := range words {
+		keys[i] = side + ":" + word
+	}
 
-	bggclient.SetCredentials(bggclient.Credentials{user, passhash})
+	allowed := rotation.History.Filter(keys, rotation.Policy, func(allowed []string) bool { return len(allowed) > 0 })
 
-	log.Println("Updating geekbadge...")
+	return strings.TrimPrefix(allowed[random.Intn(len(allowed))], side+":")
+}
 
-	firstColor, secondColor := pickColors()
+// HandleRequest designs a new geekbadge and shows it, unless options asks for a dry
+// run. It returns the geekbadge designed.
+//
+func HandleRequest(ctx context.Context, options utilities.RunOptions) (plan utilities.Plan, err error) {
+	random := options.Rand()
+
+	firstColor, secondColor := pickColors(random)
 	log.Printf("Box colors: %s, %s\n", firstColor, secondColor)
 
-	leftWord := leftWords[rand.Intn(len(leftWords))]
+	rotation, err := utilities.OpenRotation(ctx, history.Geekbadge)
+	if err != nil {
+		log.Printf("Could not open the geekbadge history: %v", err)
+		return plan, err
+	}
+
+	left, right := leftWords, rightWords
+	theme, err := utilities.ActiveTheme(ctx, options.Now())
+	if err != nil {
+		log.Printf("Could not load the themes: %v", err)
+		return plan, err
+	}
+	if theme != nil {
+		if len(theme.LeftWords) > 0 {
+			left = theme.LeftWords
+		}
+		if len(theme.RightWords) > 0 {
+			right = theme.RightWords
+		}
+	}
+
+	leftWord := pickWord(random, rotation, "left", left)
 
 	lb := geekbadge.Box{
 		Text:       leftWord,
@@ -59,7 +91,7 @@ func HandleRequest() {
 		TextStart:  4,
 	}
 
-	rightWord := rightWords[rand.Intn(len(rightWords))]
+	rightWord := pickWord(random, rotation, "right", right)
 
 	log.Printf("Left word: %s, Right word: %s", leftWord, rightWord)
 
@@ -70,8 +102,8 @@ func HandleRequest() {
 		TextStart:  44,
 	}
 
-	outerColor := borderColors[rand.Intn(len(borderColors))]
-	innerColor := borderColors[rand.Intn(len(borderColors))]
+	outerColor := borderColors[random.Intn(len(borderColors))]
+	innerColor := borderColors[random.Intn(len(borderColors))]
 
 	log.Printf("Border colors: %s %s\n", outerColor, innerColor)
 
@@ -83,12 +115,37 @@ func HandleRequest() {
 		RightBox:    rb,
 	}
 
-	_, err := geekbadge.Set(gb)
+	plan = utilities.Plan{Seed: options.Seed, Time: options.Time, DryRun: options.DryRun, Change: gb}
+	if options.DryRun {
+		return plan, nil
+	}
+
+	user := utilities.GetEnvOrDie("BGGUSERNAME")
+	passhash := utilities.GetEnvOrDie("BGGPASSHASH")
+
+	client, err := bggclient.New(bggclient.WithCredentials(bggclient.Credentials{
+		Username: user,
+		PassHash: passhash,
+	}))
+	if err != nil {
+		log.Printf("Could not create BGG client: %v", err)
+		return plan, err
+	}
+
+	log.Println("Updating geekbadge...")
+
+	_, err = geekbadge.SetContext(ctx, client, gb)
 	if err != nil {
 		log.Printf("Error updating geekbadge: %v", err)
-	} else {
-		log.Println("Geekbadge updated.")
+		return plan, err
 	}
+
+	log.Println("Geekbadge updated.")
+	if err := rotation.Record(ctx, options.Seed, options.Time, []string{"left:" + leftWord, "right:" + rightWord}); err != nil {
+		log.Printf("Could not save the geekbadge history: %v", err)
+	}
+
+	return plan, nil
 }
 
 func main() {
@@ -1,12 +1,14 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/profburke/bgurt/aws/utilities"
 	"github.com/profburke/bgurt/bggclient"
+	"github.com/profburke/bgurt/history"
 	"github.com/profburke/bgurt/microbadge"
 )
 
@@ -23,23 +25,64 @@ func init() {
 	}
 }
 
-func HandleRequest() {
+// HandleRequest picks new microbadges and shows them, unless options asks for a dry
+// run. It returns the badge numbers chosen.
+//
+func HandleRequest(ctx context.Context, options utilities.RunOptions) (plan utilities.Plan, err error) {
+	candidates := make([]microbadge.Microbadge, len(badges))
+	for i, id := range badges {
+		candidates[i] = microbadge.Microbadge{BadgeNumber: id}
+	}
+
+	rotation, err := utilities.OpenRotation(ctx, history.Microbadges)
+	if err != nil {
+		log.Printf("Could not open the microbadge history: %v.", err)
+		return plan, err
+	}
+
+	chosen, err := utilities.PickMicrobadges(ctx, candidates, rotation, &options)
+	if err != nil {
+		log.Printf("Could not pick microbadges: %v.", err)
+		return plan, err
+	}
+
+	newbadges := make([]uint, len(chosen))
+	for i, mb := range chosen {
+		newbadges[i] = mb.BadgeNumber
+	}
+	log.Printf("New microbadges: %v.", newbadges)
+
+	plan = utilities.Plan{Seed: options.Seed, Time: options.Time, DryRun: options.DryRun, Change: newbadges}
+	if options.DryRun {
+		return plan, nil
+	}
+
 	user := utilities.GetEnvOrDie("BGGUSERNAME")
 	passhash := utilities.GetEnvOrDie("BGGPASSHASH")
 
-	bggclient.SetCredentials(bggclient.Credentials{user, passhash})
+	client, err := bggclient.New(bggclient.WithCredentials(bggclient.Credentials{
+		Username: user,
+		PassHash: passhash,
+	}))
+	if err != nil {
+		log.Printf("Could not create BGG client: %v", err)
+		return plan, err
+	}
 
 	log.Println("Updating badges...")
 
-	newbadges := utilities.Picksome(badges, microbadge.TotalSlots)
-	log.Printf("New microbadges: %v.", newbadges)
-
-	_, err := microbadge.SetAll(newbadges)
+	_, err = microbadge.SetAllContext(ctx, client, newbadges)
 	if err != nil {
 		log.Printf("Error updating microbadges: %v.", err)
-	} else {
-		log.Println("Microbadges updated.")
+		return plan, err
 	}
+
+	log.Println("Microbadges updated.")
+	if err := rotation.Record(ctx, options.Seed, options.Time, history.BadgeKeys(chosen)); err != nil {
+		log.Printf("Could not save the microbadge history: %v.", err)
+	}
+
+	return plan, nil
 }
 
 func main() {
@@ -21,62 +21,69 @@
 
 // This Lambda function is a simple, default implementation for randomly selecting
 // microbadges to display. It downloads a list of microbadges from the specified S3 Bucket
-// path and then randomly picks <TotalSlots> badges. The function outputs the list of selected
-// IDs as a json object.
+// path and then randomly picks <TotalSlots> badges, obeying the constraints (if any) at
+// CONSTRAINTS_BUCKETNAME and CONSTRAINTS_ITEMNAME and weighting them as PICK_STRATEGY
+// (if set) says. If HISTORY_BUCKETNAME is set, the badges shown recently are avoided;
+// see utilities.OpenRotation. While a theme in the themes file at THEMES_BUCKETNAME and
+// THEMES_ITEMNAME applies, only its badges are picked. The function outputs the list of
+// selected IDs as a json object. The input event may give a seed for the random choices
+// (see utilities.RunOptions); a dry run leaves the history alone.
 //
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/profburke/bgurt/aws/utilities"
+	"github.com/profburke/bgurt/history"
 	"github.com/profburke/bgurt/microbadge"
 )
 
-func downloadMicrobadges(bucketname, itemname string) (badges []microbadge.Microbadge, err error) {
-	awsSession, _ := session.NewSession(&aws.Config{
-		Region: aws.String("us-east-1"),
-	})
-
-	buffer := aws.NewWriteAtBuffer([]byte{})
-
-	s3Downloader := s3manager.NewDownloader(awsSession)
-
-	objectInput := &s3.GetObjectInput{
-		Bucket: aws.String(bucketname),
-		Key:    aws.String(itemname),
+func downloadMicrobadges(ctx context.Context, bucketname, itemname string) (badges []microbadge.Microbadge, err error) {
+	data, err := utilities.Download(ctx, bucketname, itemname)
+	if err != nil {
+		return nil, fmt.Errorf("could not download microbadges: %v", err)
 	}
 
-	_, err = s3Downloader.Download(buffer, objectInput)
+	bf, err := microbadge.DecodeBadgesFile(data)
 	if err != nil {
-		err = errors.New(fmt.Sprintf("could not download microbadges from S3: %v", err))
+		return nil, err
 	}
 
-	err = json.Unmarshal(buffer.Bytes(), &badges)
-
-	return badges, err
+	return bf.Owned(), nil
 }
 
-func HandleRequest() (response []byte, err error) {
+func HandleRequest(ctx context.Context, options utilities.RunOptions) (response []byte, err error) {
 	bucketname := utilities.GetEnvOrDie("MICROBADGE_BUCKETNAME")
 	itemname := utilities.GetEnvOrDie("MICROBADGE_ITEMNAME")
 
-	badges, err := downloadMicrobadges(bucketname, itemname)
+	badges, err := downloadMicrobadges(ctx, bucketname, itemname)
 	if err != nil {
 		message := fmt.Sprintf("Could not retrieve microbadges: %v", err)
 		log.Fatalf(message)
 		return nil, errors.New(message)
 	}
 
-	chosen := utilities.Picksome(badges, microbadge.TotalSlots)
+	rotation, err := utilities.OpenRotation(ctx, history.Microbadges)
+	if err != nil {
+		return nil, err
+	}
+
+	chosen, err := utilities.PickMicrobadges(ctx, badges, rotation, &options)
+	if err != nil {
+		return nil, fmt.Errorf("Could not pick microbadges: %v", err)
+	}
+
+	if !options.DryRun {
+		if err := rotation.Record(ctx, options.Seed, options.Time, history.BadgeKeys(chosen)); err != nil {
+			log.Printf("Could not save the microbadge history: %v.", err)
+		}
+	}
 
 	log.Printf("Chosen microbadges: %v.", chosen)
 
@@ -25,18 +25,30 @@
 package utilities
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"math/rand"
 	"os"
+	"path"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/profburke/bgurt/history"
 	"github.com/profburke/bgurt/microbadge"
+	"github.com/profburke/bgurt/microbadge/constraints"
+	"github.com/profburke/bgurt/schedule"
 )
 
-func init() {
-	rand.Seed(time.Now().UnixNano())
-}
-
 // TODO: better name for struct
 type Notification struct {
 	Message string `json:"message"`
@@ -60,22 +72,299 @@ func GetEnvOrDefault(key, defaultValue string) (result string) {
 	return
 }
 
-// TODO: make this "generic"
-func Picksome(original []microbadge.Microbadge, n int) (picked []microbadge.Microbadge) {
-	picked = make([]microbadge.Microbadge, len(original))
-	for i, value := range original {
-		picked[i] = value
+// Download returns the contents of itemname in the S3 bucket bucketname.
+//
+func Download(ctx context.Context, bucketname, itemname string) (data []byte, err error) {
+	awsSession, err := session.NewSession(&aws.Config{
+		Region: aws.String("us-east-1"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not create AWS session: %v", err)
+	}
+
+	buffer := aws.NewWriteAtBuffer([]byte{})
+
+	s3Downloader := s3manager.NewDownloader(awsSession)
+
+	objectInput := &s3.GetObjectInput{
+		Bucket: aws.String(bucketname),
+		Key:    aws.String(itemname),
+	}
+
+	_, err = s3Downloader.DownloadWithContext(ctx, buffer, objectInput)
+	if err != nil {
+		return nil, fmt.Errorf("could not download %s from S3 bucket %s: %w", itemname, bucketname, err)
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// Upload stores data as itemname in the S3 bucket bucketname.
+//
+func Upload(ctx context.Context, bucketname, itemname string, data []byte) (err error) {
+	awsSession, err := session.NewSession(&aws.Config{
+		Region: aws.String("us-east-1"),
+	})
+	if err != nil {
+		return fmt.Errorf("could not create AWS session: %v", err)
+	}
+
+	s3Uploader := s3manager.NewUploader(awsSession)
+
+	uploadInput := &s3manager.UploadInput{
+		Bucket: aws.String(bucketname),
+		Key:    aws.String(itemname),
+		Body:   bytes.NewReader(data),
+	}
+
+	_, err = s3Uploader.UploadWithContext(ctx, uploadInput)
+	if err != nil {
+		return fmt.Errorf("could not upload %s to S3 bucket %s: %w", itemname, bucketname, err)
+	}
+
+	return nil
+}
+
+// S3HistoryStore is a history.Store keeping each History as a JSON object, named
+// after its kind, in an S3 bucket.
+//
+type S3HistoryStore struct {
+	bucketname, prefix string
+}
+
+// NewS3HistoryStore returns a store keeping histories in bucketname, with item names
+// starting with prefix.
+//
+func NewS3HistoryStore(bucketname, prefix string) *S3HistoryStore {
+	return &S3HistoryStore{bucketname: bucketname, prefix: prefix}
+}
+
+func (s *S3HistoryStore) itemname(kind string) string {
+	return s.prefix + kind + ".json"
+}
+
+func (s *S3HistoryStore) Load(ctx context.Context, kind string) (h *history.History, err error) {
+	data, err := Download(ctx, s.bucketname, s.itemname(kind))
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) && awsErr.Code() == s3.ErrCodeNoSuchKey {
+		return &history.History{Kind: kind}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return history.Decode(kind, data)
+}
+
+func (s *S3HistoryStore) Save(ctx context.Context, h *history.History) error {
+	data, err := json.Marshal(h)
+	if err != nil {
+		return err
 	}
 
-	const passes = 6
-	for j := 0; j < passes; j++ {
-		for i := 0; i < len(picked); i++ {
-			j := rand.Intn(len(picked))
-			picked[i], picked[j] = picked[j], picked[i]
+	return Upload(ctx, s.bucketname, s.itemname(h.Kind), data)
+}
+
+// RunOptions are the fields of a Lambda function's input event that control its
+// random choices. A zero Seed means a new one is chosen, and a zero Time, the
+// moment choices that depend on the time are made as of, means now; with DryRun,
+// nothing is changed and the function only reports what it would have done.
+//
+type RunOptions struct {
+	Seed   int64     `json:"seed,omitempty"`
+	Time   time.Time `json:"time"`
+	DryRun bool      `json:"dry_run,omitempty"`
+}
+
+// Now returns the time this run's choices are made as of, choosing the current time
+// (to the second) if none was given. Themes are looked up at this time too.
+//
+func (o *RunOptions) Now() time.Time {
+	if o.Time.IsZero() {
+		o.Time = time.Now().Truncate(time.Second)
+	}
+
+	return o.Time
+}
+
+// Rand returns the source of this run's random choices, choosing a seed and time if
+// none were given. They are logged, so that the run can be repeated.
+//
+func (o *RunOptions) Rand() *rand.Rand {
+	if o.Seed == 0 {
+		o.Seed = time.Now().UnixNano()
+	}
+	o.Now()
+	log.Printf("Seed: %d. Time: %s.", o.Seed, o.Time.Format(time.RFC3339))
+
+	return rand.New(rand.NewSource(o.Seed))
+}
+
+// Plan is what a Lambda function returns: the change it made or, on a dry run,
+// would have made, and the seed and time it was chosen with.
+//
+type Plan struct {
+	Seed   int64       `json:"seed"`
+	Time   time.Time   `json:"time"`
+	DryRun bool        `json:"dry_run,omitempty"`
+	Change interface{} `json:"change"`
+}
+
+// Rotation is a Lambda function's rotation history, with the policy it follows.
+//
+type Rotation struct {
+	History *history.History
+	Policy  history.Policy
+
+	store history.Store
+}
+
+// OpenRotation loads the history of kind from HISTORY_BUCKETNAME, under the prefix
+// HISTORY_PREFIX (by default "history/"). HISTORY_NOREPEAT (by default 1) and
+// HISTORY_SHUFFLEBAG ("true" or "false") give the policy. If HISTORY_BUCKETNAME is
+// not set, no history is kept and nothing is avoided.
+//
+func OpenRotation(ctx context.Context, kind string) (rotation *Rotation, err error) {
+	rotation = &Rotation{History: &history.History{Kind: kind}}
+
+	bucketname := GetEnvOrDefault("HISTORY_BUCKETNAME", "")
+	if bucketname == "" {
+		return rotation, nil
+	}
+
+	rotation.Policy.NoRepeat, err = strconv.Atoi(GetEnvOrDefault("HISTORY_NOREPEAT", "1"))
+	if err != nil {
+		return nil, fmt.Errorf("HISTORY_NOREPEAT: %v", err)
+	}
+	rotation.Policy.ShuffleBag, err = strconv.ParseBool(GetEnvOrDefault("HISTORY_SHUFFLEBAG", "false"))
+	if err != nil {
+		return nil, fmt.Errorf("HISTORY_SHUFFLEBAG: %v", err)
+	}
+
+	rotation.store = NewS3HistoryStore(bucketname, GetEnvOrDefault("HISTORY_PREFIX", "history/"))
+	rotation.History, err = rotation.store.Load(ctx, kind)
+	if err != nil {
+		return nil, fmt.Errorf("could not load the %s history: %v", kind, err)
+	}
+
+	return rotation, nil
+}
+
+// Record adds the items shown, chosen with seed as of time at, to the history and
+// saves it.
+//
+func (r *Rotation) Record(ctx context.Context, seed int64, at time.Time, items []string) error {
+	if r.store == nil {
+		return nil
+	}
+
+	r.History.Record(history.Entry{Time: at, Seed: seed, Items: items}, r.Policy)
+
+	return r.store.Save(ctx, r.History)
+}
+
+// LoadConstraints returns the microbadge constraints stored in S3 at
+// CONSTRAINTS_BUCKETNAME and CONSTRAINTS_ITEMNAME, in JSON if the item name ends
+// in .json and TOML otherwise. If CONSTRAINTS_ITEMNAME is not set there are no
+// constraints.
+//
+func LoadConstraints(ctx context.Context, options ...constraints.Option) (c constraints.Constraints, err error) {
+	return loadConstraints(ctx, GetEnvOrDefault("CONSTRAINTS_ITEMNAME", ""), options...)
+}
+
+func loadConstraints(ctx context.Context, itemname string, options ...constraints.Option) (c constraints.Constraints, err error) {
+	if itemname == "" {
+		return constraints.New(constraints.ConstraintsData{}, options...), nil
+	}
+	bucketname := GetEnvOrDie("CONSTRAINTS_BUCKETNAME")
+
+	data, err := Download(ctx, bucketname, itemname)
+	if err != nil {
+		return nil, err
+	}
+
+	cd, err := constraints.ParseConstraintsData(data, isJSON(itemname))
+	if err != nil {
+		return nil, fmt.Errorf("could not read constraints %s: %v", itemname, err)
+	}
+
+	return constraints.New(cd, options...), nil
+}
+
+func isJSON(itemname string) bool {
+	return strings.EqualFold(path.Ext(itemname), ".json")
+}
+
+// ActiveTheme returns the theme that applies at time t (for a run, the time its
+// choices are made as of; see RunOptions.Now) according to the themes file stored
+// in S3 at THEMES_BUCKETNAME and THEMES_ITEMNAME, or nil if none does or
+// THEMES_ITEMNAME is not set. A theme's constraints name an item in
+// CONSTRAINTS_BUCKETNAME.
+//
+func ActiveTheme(ctx context.Context, t time.Time) (theme *schedule.Theme, err error) {
+	itemname := GetEnvOrDefault("THEMES_ITEMNAME", "")
+	if itemname == "" {
+		return nil, nil
+	}
+	bucketname := GetEnvOrDie("THEMES_BUCKETNAME")
+
+	data, err := Download(ctx, bucketname, itemname)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := schedule.Parse(data, isJSON(itemname))
+	if err != nil {
+		return nil, fmt.Errorf("could not read themes %s: %v", itemname, err)
+	}
+
+	theme = s.Active(t)
+	if theme != nil {
+		log.Printf("Using theme %s.", theme.Name)
+	}
+
+	return theme, nil
+}
+
+// PickMicrobadges chooses TotalSlots of badges, one per slot, obeying the
+// constraints returned by LoadConstraints and, where it can, the rotation's policy.
+// While a theme applies at run's time, only its badges are chosen from, and its
+// constraints are used if it has any. Random choices are made with run's seed and
+// as of its time (see RunOptions.Rand). If PICK_STRATEGY is set, it names the
+// weighting strategy used, whatever the constraints say.
+//
+func PickMicrobadges(ctx context.Context, badges []microbadge.Microbadge, rotation *Rotation, run *RunOptions) (chosen []microbadge.Microbadge, err error) {
+	random := run.Rand()
+	options := []constraints.Option{constraints.WithRand(random), constraints.WithNow(run.Time)}
+	if name := GetEnvOrDefault("PICK_STRATEGY", ""); name != "" {
+		strategy, err := constraints.ParseStrategy(name)
+		if err != nil {
+			return nil, fmt.Errorf("PICK_STRATEGY: %v", err)
 		}
+		options = append(options, constraints.WithStrategy(strategy))
+	}
+
+	constraintsItemname := GetEnvOrDefault("CONSTRAINTS_ITEMNAME", "")
+
+	theme, err := ActiveTheme(ctx, run.Now())
+	if err != nil {
+		return nil, err
+	}
+	if theme != nil {
+		badges = theme.Badges(badges)
+		if len(badges) == 0 {
+			return nil, fmt.Errorf("none of the microbadges of theme %s are available", theme.Name)
+		}
+		if theme.Constraints != "" {
+			constraintsItemname = theme.Constraints
+		}
+	}
+
+	c, err := loadConstraints(ctx, constraintsItemname, options...)
+	if err != nil {
+		return nil, err
 	}
 
-	return picked[0:n]
+	return rotation.History.PickMicrobadges(c, badges, rotation.Policy)
 }
 
 // Local Variables:
@@ -23,28 +23,20 @@
 // and is reponsible for including the user's login credentials as cookies with each HTTP
 // request.
 //
+// Each Client carries its own base URL, transport and cookie jar. The package level
+// functions (Get, Post, Upload, Download and SetCredentials) operate on a default
+// client and are kept for programs that only ever talk to BGG as one user.
+//
 package bggclient
 
 import (
-	"bufio"
-	"bytes"
-	"crypto/tls"
-	"io"
-	"io/ioutil"
+	"context"
 	"log"
-	"mime/multipart"
 	"net/http"
-	"net/http/cookiejar"
 	"net/url"
-	"path/filepath"
-
-	"golang.org/x/net/publicsuffix"
 )
 
-var tlsConfig *tls.Config // TODO: does this (and transport) need to be global?
-var client *http.Client
-var transport *http.Transport
-var bggURL *url.URL
+var defaultClient *Client
 
 type Credentials struct {
 	Username string `toml:"username"`
@@ -57,133 +49,75 @@ func (c Credentials) IsSet() bool {
 
 // TODO: func (c Credentials) NewFromFile(filename string) ....
 
-// TODO: need to decide how to handle URLs. We could almost completely get away
-// with just using strings since the methods on http.Client require strings, not URLs,
-// with one exception: the cookiejar.SetCookies call :(
-
 func init() {
-	tlsConfig = &tls.Config{
-		MinVersion: tls.VersionTLS12,
-	}
-
-	transport = &http.Transport{
-		TLSClientConfig: tlsConfig,
-	}
+	var err error
 
-	jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	defaultClient, err = New()
 	if err != nil {
-		log.Fatalf("bggclient: Error creating cookie jar: %v", err)
-	}
-
-	client = &http.Client{
-		Transport: transport,
-		Jar:       jar,
+		log.Fatalf("bggclient: Error creating default client: %v", err)
 	}
+}
 
-	bggURL, err = url.Parse("https://boardgamegeek.com")
-	if err != nil {
-		log.Fatalf("bggclient: Error parsing URL: %v", err)
-	}
+// Default returns the client used by the package level functions.
+//
+func Default() *Client {
+	return defaultClient
 }
 
-// Download handls an HTTP response that includes a file download.
+// Download handles an HTTP response that includes a file download.
 //
 func Download(relativeURL *url.URL) (data []byte, err error) {
-	u := bggURL.ResolveReference(relativeURL)
-	res, err := client.Get(u.String())
-	if err != nil {
-		return nil, err
-	}
-	defer res.Body.Close()
-
-	var b bytes.Buffer
-	writer := bufio.NewWriter(&b)
-
-	_, err = io.Copy(writer, res.Body)
-	if err == nil {
-		data = b.Bytes()
-	}
+	return defaultClient.Download(relativeURL)
+}
 
-	return
+// DownloadContext is like Download but gives up when ctx is done.
+//
+func DownloadContext(ctx context.Context, relativeURL *url.URL) (data []byte, err error) {
+	return defaultClient.DownloadContext(ctx, relativeURL)
 }
 
 // Get sends an HTTP GET request to the given URL.
 //
 func Get(relativeURL *url.URL) (page string, err error) {
-	u := bggURL.ResolveReference(relativeURL)
-	res, err := client.Get(u.String())
-	defer res.Body.Close()
-
-	if err != nil {
-		return "", err
-	}
-
-	bytes, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return "", err
-	}
-	page = string(bytes)
+	return defaultClient.Get(relativeURL)
+}
 
-	return
+// GetContext is like Get but gives up when ctx is done.
+//
+func GetContext(ctx context.Context, relativeURL *url.URL) (page string, err error) {
+	return defaultClient.GetContext(ctx, relativeURL)
 }
 
 // Post sends an HTTP POST request to the given URL with the given form data.
+// See Client.Post for who closes the response body.
 //
 func Post(relativeURL *url.URL, data url.Values) (res *http.Response, err error) {
-	u := bggURL.ResolveReference(relativeURL)
-	res, err = client.PostForm(u.String(), data)
+	return defaultClient.Post(relativeURL, data)
+}
 
-	return
+// PostContext is like Post but gives up when ctx is done.
+//
+func PostContext(ctx context.Context, relativeURL *url.URL, data url.Values) (res *http.Response, err error) {
+	return defaultClient.PostContext(ctx, relativeURL, data)
 }
 
 // SetCredentials creates cookies containing the BGG username and password hash
-// for use by the client.
+// for use by the default client.
 //
 func SetCredentials(c Credentials) {
-	usernameCookie := http.Cookie{Name: "bggusername", Value: c.Username}
-	passHashCookie := http.Cookie{Name: "bggpassword", Value: c.PassHash}
-	client.Jar.SetCookies(bggURL, []*http.Cookie{&usernameCookie, &passHashCookie})
+	defaultClient.SetCredentials(c)
 }
 
 // Upload sends an HTTP POST request with a file upload.
 //
 func Upload(relativeURL *url.URL, data []byte, filename, fileFieldName string, fields map[string]string) (err error) {
-	u := bggURL.ResolveReference(relativeURL)
-
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
-	part, err := writer.CreateFormFile(fileFieldName, filepath.Base(filename))
-	if err != nil {
-		return err
-	}
-
-	r := bytes.NewReader(data)
-	_, err = io.Copy(part, r)
-
-	for key, val := range fields {
-		_ = writer.WriteField(key, val)
-	}
-
-	err = writer.Close()
-	if err != nil {
-		return err
-	}
-
-	request, err := http.NewRequest("POST", u.String(), body)
-	if err != nil {
-		return err
-	}
-
-	request.Header.Set("Content-Type", writer.FormDataContentType())
-
-	res, err := client.Do(request)
-	if err != nil {
-		return err
-	}
-
-	res.Body.Close()
+	return defaultClient.Upload(relativeURL, data, filename, fileFieldName, fields)
+}
 
-	return nil
+// UploadContext is like Upload but gives up when ctx is done.
+//
+func UploadContext(ctx context.Context, relativeURL *url.URL, data []byte, filename, fileFieldName string, fields map[string]string) (err error) {
+	return defaultClient.UploadContext(ctx, relativeURL, data, filename, fileFieldName, fields)
 }
 
 // Local Variables:
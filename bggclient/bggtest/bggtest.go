@@ -0,0 +1,586 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package bggtest provides a fake BoardGameGeek web site for tests and offline
+// development. It serves just enough of the pages scraped by the avatar, geekbadge,
+// microbadge, overtext and profile packages, accepts the form posts they send, and keeps
+// the resulting state per user so that a test can Set something and Get it back.
+//
+//	server := bggtest.NewServer()
+//	defer server.Close()
+//	server.AddBadge(bggtest.Badge{Number: 1234, Name: "I play games"})
+//	server.AddUser(bggtest.User{Username: "alice", PassHash: "hash", Badges: []uint{1234}})
+//	client, err := server.NewClient("alice")
+//
+package bggtest
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/profburke/bgurt/bggclient"
+)
+
+// TotalSlots mirrors microbadge.TotalSlots; bggtest cannot import microbadge
+// because microbadge's own tests import bggtest.
+//
+const TotalSlots = 5
+
+type Group struct {
+	Number uint
+	Name   string
+}
+
+// Badge is a microbadge in the site-wide catalog. Subsubcategory is optional
+// (Number 0 leaves it out), as are the text fields and related badges. Badges
+// without an Image are served a made-up one.
+//
+type Badge struct {
+	Number         uint
+	Name           string
+	Category       Group
+	Subcategory    Group
+	Subsubcategory Group
+	NumberOfOwners uint
+	Mouseover      string
+	Creator        string
+	Description    string
+	Related        []uint
+	Image          []byte
+}
+
+// User is the state the fake site keeps for one account. Slots holds the badge
+// number displayed in each microbadge slot, 0 meaning empty. Geekbadge holds the
+// fields of the last saved geekbadge form (outerBorder, leftText, ...).
+//
+type User struct {
+	ID             uint
+	Username       string
+	PassHash       string
+	Badges         []uint
+	Slots          [TotalSlots]uint
+	Geekbadge      map[string]string
+	AvatarOvertext string
+	BadgeOvertext  string
+	Avatar         []byte
+	AvatarType     string // file extension of the avatar image, e.g. "png"
+	Stats          Stats
+}
+
+// Stats are the figures shown on a user's profile page. Dates are written as
+// YYYY-MM-DD; a Registered left empty is shown as 2010-01-01.
+//
+type Stats struct {
+	Registered     string
+	LastLogin      string
+	GeekGold       float64
+	ThumbsGiven    uint
+	ThumbsReceived uint
+	Posts          uint
+}
+
+// Server is a running fake BGG. The embedded httptest.Server provides URL and Close.
+//
+type Server struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	badges map[uint]Badge
+	users  map[string]*User
+	nextID uint
+}
+
+// NewServer starts a fake BGG with no badges and no users.
+//
+func NewServer() *Server {
+	s := &Server{
+		badges: make(map[uint]Badge),
+		users:  make(map[string]*User),
+		nextID: 1000,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", s.login)
+	mux.HandleFunc("/microbadge/edit", s.authenticated(s.microbadgeEdit))
+	mux.HandleFunc("/microbadge/", s.microbadge)
+	mux.HandleFunc("/geekmicrobadge.php", s.authenticated(s.geekmicrobadge))
+	mux.HandleFunc("/geekaccount/edit/geekbadge", s.authenticated(s.geekbadgeEdit))
+	mux.HandleFunc("/geekaccount/edit/overtext", s.authenticated(s.overtextEdit))
+	mux.HandleFunc("/geekaccount/edit/avatar", s.authenticated(s.avatarUpload))
+	mux.HandleFunc("/geekaccount.php", s.authenticated(s.geekaccount))
+	mux.HandleFunc("/myprofile", s.authenticated(s.myprofile))
+	mux.HandleFunc("/avatars/", s.avatarImage)
+	mux.HandleFunc("/images/microbadges/", s.microbadgeImage)
+
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+// AddBadge adds (or replaces) a badge in the catalog.
+//
+func (s *Server) AddBadge(b Badge) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.badges[b.Number] = b
+}
+
+// AddUser registers an account. The user is given an ID if it has none. Badges
+// not yet in the catalog are added to it with a placeholder name.
+//
+func (s *Server) AddUser(u User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if u.ID == 0 {
+		s.nextID++
+		u.ID = s.nextID
+	}
+	if u.Geekbadge == nil {
+		u.Geekbadge = make(map[string]string)
+	}
+	for _, number := range u.Badges {
+		if _, ok := s.badges[number]; !ok {
+			s.badges[number] = Badge{Number: number, Name: fmt.Sprintf("Badge %d", number)}
+		}
+	}
+
+	s.users[u.Username] = &u
+}
+
+// User returns a copy of the current state of the named account.
+//
+func (s *Server) User(username string) (u User, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.users[username]
+	if !ok {
+		return User{}, false
+	}
+
+	u = *p
+	u.Badges = append([]uint(nil), p.Badges...)
+	u.Avatar = append([]byte(nil), p.Avatar...)
+	u.Geekbadge = make(map[string]string)
+	for k, v := range p.Geekbadge {
+		u.Geekbadge[k] = v
+	}
+
+	return u, true
+}
+
+// Credentials returns the login for the named account.
+//
+func (s *Server) Credentials(username string) bggclient.Credentials {
+	u, _ := s.User(username)
+
+	return bggclient.Credentials{Username: u.Username, PassHash: u.PassHash}
+}
+
+// NewClient returns a bggclient.Client logged in to the fake site as the named
+// user, with rate limiting and retries turned off so tests run quickly.
+//
+func (s *Server) NewClient(username string, options ...bggclient.Option) (*bggclient.Client, error) {
+	options = append([]bggclient.Option{
+		bggclient.WithBaseURL(s.URL),
+		bggclient.WithRateLimit(0),
+		bggclient.WithRetryPolicy(bggclient.NoRetry),
+		bggclient.WithCredentials(s.Credentials(username)),
+	}, options...)
+
+	return bggclient.New(options...)
+}
+
+// authenticated sends requests without valid credential cookies to the login
+// page, as BGG does.
+//
+func (s *Server) authenticated(handler func(w http.ResponseWriter, r *http.Request, u *User)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username, err := r.Cookie("bggusername")
+		if err != nil {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+		passhash, err := r.Cookie("bggpassword")
+		if err != nil {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		u, ok := s.users[username.Value]
+		if !ok || u.PassHash != passhash.Value {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+
+		handler(w, r, u)
+	}
+}
+
+func (s *Server) login(w http.ResponseWriter, r *http.Request) {
+	page(w, "Login", `<form method="post" action="/login/api/v1">
+<input type="text" name="username">
+<input type="password" name="password">
+</form>`)
+}
+
+func (s *Server) microbadgeEdit(w http.ResponseWriter, r *http.Request, u *User) {
+	var b strings.Builder
+
+	b.WriteString("<table class='microbadge_slots'>\n<tr>\n")
+	for i, number := range u.Slots {
+		fmt.Fprintf(&b, "<td id='slot_%d'>", i+1)
+		if number != 0 {
+			fmt.Fprintf(&b, "<img src='/images/microbadges/%d.gif' alt='%s'>",
+				number, html.EscapeString(s.badges[number].Name))
+		}
+		b.WriteString("</td>\n")
+	}
+	b.WriteString("</tr>\n</table>\n")
+
+	numbers := append([]uint(nil), u.Badges...)
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+	for _, number := range numbers {
+		fmt.Fprintf(&b, "<div class='mbcontainer'>\n<img src='/images/microbadges/%d.gif'>\n", number)
+		fmt.Fprintf(&b, "<div id='badgename_%d'>%s</div>\n</div>\n", number, html.EscapeString(s.badges[number].Name))
+	}
+
+	page(w, "Edit Microbadges", b.String())
+}
+
+func (s *Server) microbadge(w http.ResponseWriter, r *http.Request) {
+	number, err := strconv.ParseUint(path.Base(r.URL.Path), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mu.Lock()
+	b, ok := s.badges[uint(number)]
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	etag := fmt.Sprintf("\"%x\"", sha1.Sum([]byte(fmt.Sprintf("%+v", b))))
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	var groups strings.Builder
+	fmt.Fprintf(&groups, "<a  href=\"/microbadges/group/%d\" >%s</a>\n", b.Category.Number, html.EscapeString(b.Category.Name))
+	fmt.Fprintf(&groups, "<div class='ml10'>\n<a  href=\"/microbadges/group/%d\" >%s</a>\n", b.Subcategory.Number, html.EscapeString(b.Subcategory.Name))
+	if b.Subsubcategory.Number != 0 {
+		fmt.Fprintf(&groups, "<div class='ml10'>\n<a  href=\"/microbadges/group/%d\" >%s</a>\n</div>\n", b.Subsubcategory.Number, html.EscapeString(b.Subsubcategory.Name))
+	}
+	groups.WriteString("</div>\n")
+
+	var rows strings.Builder
+	row := func(label, value string) {
+		fmt.Fprintf(&rows, "<tr>\n\t<td>%s</td>\n\t<td>%s</td>\n</tr>\n", label, value)
+	}
+
+	row("Name", html.EscapeString(b.Name))
+	row("Group", groups.String())
+	row("Num Owners", fmt.Sprint(b.NumberOfOwners))
+	if b.Mouseover != "" {
+		row("Mouseover", html.EscapeString(b.Mouseover))
+	}
+	if b.Creator != "" {
+		row("Created By", fmt.Sprintf("<a href=\"/user/%s\">%s</a>", url.PathEscape(b.Creator), html.EscapeString(b.Creator)))
+	}
+	if b.Description != "" {
+		row("Description", strings.Replace(html.EscapeString(b.Description), "\n", "<br>", -1))
+	}
+	if len(b.Related) > 0 {
+		var related strings.Builder
+		for _, number := range b.Related {
+			fmt.Fprintf(&related, "<a href=\"/microbadge/%d\"><img src='/images/microbadges/%d.gif'></a>\n", number, number)
+		}
+		row("Related Microbadges", related.String())
+	}
+
+	page(w, "Microbadge: "+html.EscapeString(b.Name), fmt.Sprintf(`<div class='microbadge_image'><img src='/images/microbadges/%d.gif'></div>
+<table class='forum_table'>
+%s</table>`, b.Number, rows.String()))
+}
+
+func (s *Server) microbadgeImage(w http.ResponseWriter, r *http.Request) {
+	name := path.Base(r.URL.Path)
+	number, err := strconv.ParseUint(strings.TrimSuffix(name, ".gif"), 10, 64)
+	if err != nil || path.Ext(name) != ".gif" {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mu.Lock()
+	b, ok := s.badges[uint(number)]
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	image := b.Image
+	if image == nil {
+		image = []byte(fmt.Sprintf("GIF89a badge %d", b.Number))
+	}
+
+	w.Header().Set("Content-Type", "image/gif")
+	w.Write(image)
+}
+
+func (s *Server) geekmicrobadge(w http.ResponseWriter, r *http.Request, u *User) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch r.PostFormValue("action") {
+	case "setslot":
+		slot, err := strconv.ParseUint(r.PostFormValue("slot"), 10, 64)
+		if err != nil || slot < 1 || slot > TotalSlots {
+			http.Error(w, "invalid slot", http.StatusBadRequest)
+			return
+		}
+		number, err := strconv.ParseUint(r.PostFormValue("badgeid"), 10, 64)
+		if err != nil || !owns(u, uint(number)) {
+			http.Error(w, "invalid badge", http.StatusBadRequest)
+			return
+		}
+		u.Slots[slot-1] = uint(number)
+		fmt.Fprint(w, `{"success":true}`)
+	case "clearslot":
+		slot, err := strconv.ParseUint(r.PostFormValue("slot"), 10, 64)
+		if err != nil || slot < 1 || slot > TotalSlots {
+			http.Error(w, "invalid slot", http.StatusBadRequest)
+			return
+		}
+		u.Slots[slot-1] = 0
+		fmt.Fprint(w, `{"success":true}`)
+	default:
+		http.Error(w, "unknown action", http.StatusBadRequest)
+	}
+}
+
+func (s *Server) geekbadgeEdit(w http.ResponseWriter, r *http.Request, u *User) {
+	keys := make([]string, 0, len(u.Geekbadge))
+	for k := range u.Geekbadge {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+url.QueryEscape(u.Geekbadge[k]))
+	}
+
+	page(w, "Edit Geekbadge", fmt.Sprintf(`<form method="post" action="/geekaccount.php">
+<input type="hidden" name="action" value="savebadge">
+<div class='geekbadge_preview'><img src="/button.php?%s"></div>
+</form>`, strings.Join(pairs, "&amp;")))
+}
+
+func (s *Server) overtextEdit(w http.ResponseWriter, r *http.Request, u *User) {
+	page(w, "Edit Overtext", fmt.Sprintf(`<form method="post" action="/geekaccount.php">
+<input type="hidden" name="action" value="saveovertext">
+<input type="text" name="overtext[avatar]" value="%s" size="50" maxlength="100">
+<input type="text" name="overtext[badge]" value="%s" size="50" maxlength="100">
+</form>`, html.EscapeString(u.AvatarOvertext), html.EscapeString(u.BadgeOvertext)))
+}
+
+var geekbadgeFields = []string{
+	"outerBorder", "innerBorder", "barPosition",
+	"leftText", "leftFill", "leftTextColor", "leftTextPosition",
+	"rightText", "rightFill", "rightTextColor", "rightTextPosition",
+}
+
+func (s *Server) geekaccount(w http.ResponseWriter, r *http.Request, u *User) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch r.PostFormValue("action") {
+	case "savebadge":
+		for _, field := range geekbadgeFields {
+			u.Geekbadge[field] = r.PostFormValue(field)
+		}
+	case "saveovertext":
+		u.AvatarOvertext = r.PostFormValue("overtext[avatar]")
+		u.BadgeOvertext = r.PostFormValue("overtext[badge]")
+	default:
+		http.Error(w, "unknown action", http.StatusBadRequest)
+		return
+	}
+
+	page(w, "Account", "<p>Your changes have been saved.</p>")
+}
+
+func (s *Server) avatarUpload(w http.ResponseWriter, r *http.Request, u *User) {
+	if r.Method != "POST" {
+		page(w, "Edit Avatar", `<form method="post" enctype="multipart/form-data">
+<input type="hidden" name="action" value="saveavatar">
+<input type="file" name="filename">
+</form>`)
+		return
+	}
+
+	if r.FormValue("action") != "saveavatar" {
+		http.Error(w, "unknown action", http.StatusBadRequest)
+		return
+	}
+
+	file, header, err := r.FormFile("filename")
+	if err != nil {
+		http.Error(w, "missing file", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		http.Error(w, "could not read file", http.StatusBadRequest)
+		return
+	}
+
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(header.Filename), "."))
+	if ext == "jpeg" {
+		ext = "jpg"
+	}
+	if ext != "jpg" && ext != "png" && ext != "gif" {
+		http.Error(w, "avatar must be a GIF, JPG or PNG", http.StatusBadRequest)
+		return
+	}
+
+	u.Avatar = data
+	u.AvatarType = ext
+
+	page(w, "Edit Avatar", "<p>Your avatar has been updated.</p>")
+}
+
+func (s *Server) myprofile(w http.ResponseWriter, r *http.Request, u *User) {
+	var avatar string
+	if len(u.Avatar) > 0 {
+		avatar = fmt.Sprintf(`<img src="%s/avatars/avatar_id%d.%s" alt="avatar">`, s.URL, u.ID, u.AvatarType)
+	}
+
+	registered := u.Stats.Registered
+	if registered == "" {
+		registered = "2010-01-01"
+	}
+	var rows strings.Builder
+	row := func(label, value string) {
+		fmt.Fprintf(&rows, "<tr>\n\t<td>%s</td>\n\t<td>%s</td>\n</tr>\n", label, value)
+	}
+	row("Registered", registered)
+	if u.Stats.LastLogin != "" {
+		row("Last Login", u.Stats.LastLogin)
+	}
+	row("GeekGold", fmt.Sprintf("%.2f", u.Stats.GeekGold))
+	row("Thumbs Given", commas(u.Stats.ThumbsGiven))
+	row("Thumbs Received", commas(u.Stats.ThumbsReceived))
+	row("Posts", commas(u.Stats.Posts))
+
+	page(w, "Profile of "+html.EscapeString(u.Username), fmt.Sprintf(`<div class='profile_avatar'>%s</div>
+<div class='profile_username'>%s</div>
+<table class='profile_stats'>
+%s</table>`, avatar, html.EscapeString(u.Username), rows.String()))
+}
+
+func (s *Server) avatarImage(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(path.Base(r.URL.Path), "avatar_id")
+	id, err := strconv.ParseUint(strings.TrimSuffix(name, path.Ext(name)), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.users {
+		if u.ID == uint(id) && len(u.Avatar) > 0 {
+			w.Header().Set("Content-Type", "image/"+strings.Replace(u.AvatarType, "jpg", "jpeg", 1))
+			w.Write(u.Avatar)
+			return
+		}
+	}
+
+	http.NotFound(w, r)
+}
+
+func owns(u *User, number uint) bool {
+	for _, b := range u.Badges {
+		if b == number {
+			return true
+		}
+	}
+
+	return false
+}
+
+// commas writes n with thousands separators, as BGG does.
+//
+func commas(n uint) string {
+	s := strconv.FormatUint(uint64(n), 10)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+
+	return s
+}
+
+func page(w http.ResponseWriter, title, body string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, `<!DOCTYPE html>
+<html>
+<head><title>%s | BoardGameGeek</title></head>
+<body>
+<div id='maincontent'>
+%s
+</div>
+</body>
+</html>
+`, title, body)
+}
+
+// Local Variables:
+// compile-command: "go build"
+// End:
@@ -0,0 +1,328 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package cassette records the HTTP conversation between a bggclient.Client and
+// BoardGameGeek to a golden file, and replays it later without touching the network.
+// Recording real pages lets the scrapers be tested against what BGG actually sends,
+// so a change in the site's layout shows up as a failing test or a diff in the
+// golden file rather than as silently empty results.
+//
+// Credential cookies are never written to the cassette, and the username and
+// password hash are replaced by placeholders wherever they appear.
+//
+//	recorder, err := cassette.New("testdata/profile.json", cassette.Record, nil)
+//	client, err := bggclient.New(bggclient.WithTransport(recorder), ...)
+//	...
+//	err = recorder.Save()
+//
+package cassette
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+type Mode int
+
+const (
+	// Replay answers requests from the cassette file and fails any request
+	// that was not recorded.
+	Replay Mode = iota
+	// Record passes requests on to the real transport and remembers them.
+	Record
+)
+
+// Request is the part of an HTTP request used to match it on replay.
+//
+type Request struct {
+	Method string
+	URL    string
+	Body   string `json:",omitempty"`
+}
+
+// Response is a recorded HTTP response. Text bodies are stored as is so that
+// golden files diff nicely; anything else (e.g. avatar images) is stored as base64.
+//
+type Response struct {
+	StatusCode int
+	Header     http.Header `json:",omitempty"`
+	Body       string      `json:",omitempty"`
+	BodyBase64 string      `json:",omitempty"`
+}
+
+type Interaction struct {
+	Request  Request
+	Response Response
+}
+
+// Cassette is the contents of a golden file.
+//
+type Cassette struct {
+	Interactions []Interaction
+}
+
+// Recorder is an http.RoundTripper that records to or replays from a cassette.
+//
+type Recorder struct {
+	mode     Mode
+	filename string
+	real     http.RoundTripper
+
+	mu        sync.Mutex
+	cassette  Cassette
+	replayed  map[int]bool
+	scrubbers []string // pairs of old, new
+}
+
+// Option configures a Recorder.
+//
+type Option func(r *Recorder)
+
+// Scrub replaces every occurrence of secret with placeholder in recorded URLs,
+// request bodies, headers and response bodies. Requests are scrubbed the same way
+// before being matched on replay.
+//
+func Scrub(secret, placeholder string) Option {
+	return func(r *Recorder) {
+		if secret != "" {
+			r.scrubbers = append(r.scrubbers, secret, placeholder)
+		}
+	}
+}
+
+// New creates a Recorder for the named cassette file. In Replay mode the file is
+// read immediately. In Record mode requests are sent with real (or
+// http.DefaultTransport if nil) and the file is written by Save.
+//
+func New(filename string, mode Mode, real http.RoundTripper, options ...Option) (r *Recorder, err error) {
+	if real == nil {
+		real = http.DefaultTransport
+	}
+
+	r = &Recorder{
+		mode:     mode,
+		filename: filename,
+		real:     real,
+		replayed: make(map[int]bool),
+	}
+
+	for _, option := range options {
+		option(r)
+	}
+
+	if mode == Replay {
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("cassette.New: %w", err)
+		}
+
+		err = json.Unmarshal(data, &r.cassette)
+		if err != nil {
+			return nil, fmt.Errorf("cassette.New: could not decode %s: %v", filename, err)
+		}
+	}
+
+	return r, nil
+}
+
+// RoundTrip implements http.RoundTripper.
+//
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	recorded, err := r.request(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.mode == Replay {
+		return r.replay(req, recorded)
+	}
+
+	res, err := r.real.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	response := Response{StatusCode: res.StatusCode, Header: r.header(res.Header)}
+	if utf8.Valid(body) {
+		response.Body = r.scrub(string(body))
+	} else {
+		response.BodyBase64 = base64.StdEncoding.EncodeToString(body)
+	}
+
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, Interaction{recorded, response})
+	r.mu.Unlock()
+
+	return r.response(req, response)
+}
+
+// Save writes the recorded interactions to the cassette file, creating its
+// directory if needed. It does nothing in Replay mode.
+//
+func (r *Recorder) Save() (err error) {
+	if r.mode == Replay {
+		return nil
+	}
+
+	r.mu.Lock()
+	data, err := json.MarshalIndent(r.cassette, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(r.filename), 0755)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(r.filename, append(data, '\n'), 0644)
+}
+
+// request builds the (scrubbed) matching key for req, restoring req.Body so that
+// it can still be sent.
+//
+func (r *Recorder) request(req *http.Request) (recorded Request, err error) {
+	recorded = Request{Method: req.Method, URL: r.scrub(req.URL.String())}
+
+	if req.Body == nil || req.GetBody == nil {
+		return recorded, nil
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return recorded, err
+	}
+	defer body.Close()
+
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return recorded, err
+	}
+
+	// multipart boundaries are random, so uploads are matched on method and URL only
+	if !strings.HasPrefix(req.Header.Get("Content-Type"), "multipart/") {
+		recorded.Body = r.scrub(string(data))
+	}
+
+	return recorded, nil
+}
+
+// replay finds the first interaction matching recorded that has not been used yet.
+// Once every match has been used, the last one is repeated.
+//
+func (r *Recorder) replay(req *http.Request, recorded Request) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	found := -1
+	for i, interaction := range r.cassette.Interactions {
+		if interaction.Request != recorded {
+			continue
+		}
+		found = i
+		if !r.replayed[i] {
+			break
+		}
+	}
+
+	if found < 0 {
+		return nil, fmt.Errorf("cassette: %s %s not recorded in %s", recorded.Method, recorded.URL, r.filename)
+	}
+	r.replayed[found] = true
+
+	return r.response(req, r.cassette.Interactions[found].Response)
+}
+
+func (r *Recorder) response(req *http.Request, recorded Response) (*http.Response, error) {
+	body := []byte(recorded.Body)
+	if recorded.BodyBase64 != "" {
+		var err error
+		body, err = base64.StdEncoding.DecodeString(recorded.BodyBase64)
+		if err != nil {
+			return nil, errors.New("cassette: corrupt base64 body")
+		}
+	}
+
+	header := http.Header{}
+	for k, v := range recorded.Header {
+		header[k] = append([]string(nil), v...)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode)),
+		StatusCode:    recorded.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(strings.NewReader(string(body))),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// keptHeaders are the response headers worth recording; everything else (dates,
+// cookies, caching and CDN noise) would only make the golden files churn.
+//
+var keptHeaders = []string{"Content-Type", "Location", "Retry-After"}
+
+func (r *Recorder) header(h http.Header) (kept http.Header) {
+	for _, name := range keptHeaders {
+		if v := h.Values(name); len(v) > 0 {
+			if kept == nil {
+				kept = http.Header{}
+			}
+			for _, value := range v {
+				kept.Add(name, r.scrub(value))
+			}
+		}
+	}
+
+	return
+}
+
+func (r *Recorder) scrub(s string) string {
+	for i := 0; i+1 < len(r.scrubbers); i += 2 {
+		s = strings.Replace(s, r.scrubbers[i], r.scrubbers[i+1], -1)
+	}
+
+	return s
+}
+
+// Local Variables:
+// compile-command: "go build"
+// End:
@@ -0,0 +1,109 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package cassette
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func get(t *testing.T, client *http.Client, url string) (status int, body []byte) {
+	res, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("Get(%s): %v", url, err)
+	}
+	defer res.Body.Close()
+
+	body, err = ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return res.StatusCode, body
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	image := []byte{0x89, 'P', 'N', 'G', 0xff, 0x00}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "SessionID", Value: "topsecret"})
+		switch r.URL.Path {
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(image)
+		default:
+			w.Write([]byte("<p>Welcome, alice</p>"))
+		}
+	}))
+	defer server.Close()
+
+	filename := filepath.Join(t.TempDir(), "cassette.json")
+
+	recorder, err := New(filename, Record, nil, Scrub("alice", "USER"))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	client := &http.Client{Transport: recorder}
+
+	if _, body := get(t, client, server.URL+"/page"); string(body) != "<p>Welcome, USER</p>" {
+		t.Errorf("recorded body == %q, want it scrubbed", body)
+	}
+	get(t, client, server.URL+"/image")
+
+	if err := recorder.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "topsecret") || strings.Contains(string(data), "alice") {
+		t.Errorf("cassette contains a secret:\n%s", data)
+	}
+
+	server.Close()
+
+	replayer, err := New(filename, Replay, nil)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	client = &http.Client{Transport: replayer}
+
+	if status, body := get(t, client, server.URL+"/page"); status != 200 || string(body) != "<p>Welcome, USER</p>" {
+		t.Errorf("replayed page == %d %q", status, body)
+	}
+	if _, body := get(t, client, server.URL+"/image"); !bytes.Equal(body, image) {
+		t.Errorf("replayed image == %v, want %v", body, image)
+	}
+	if _, err := client.Get(server.URL + "/elsewhere"); err == nil {
+		t.Errorf("replaying an unrecorded request succeeded")
+	}
+}
+
+// Local Variables:
+// compile-command: "go test"
+// End:
@@ -0,0 +1,395 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bggclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// DefaultBaseURL is the site a Client talks to unless told otherwise.
+//
+const DefaultBaseURL = "https://boardgamegeek.com"
+
+// Client holds everything needed to talk to BGG on behalf of a single user:
+// the base URL requests are resolved against and the underlying http.Client
+// (transport, cookie jar and timeout). Clients are independent of each other,
+// so a program can hold several at once, e.g. one per account.
+//
+type Client struct {
+	baseURL     *url.URL
+	httpClient  *http.Client
+	limiter     *limiter
+	retryPolicy RetryPolicy
+	credentials *Credentials // from WithCredentials; applied after the other options
+}
+
+// Option configures a Client. Options are applied in order by New.
+//
+type Option func(c *Client) error
+
+// WithBaseURL points the client at a different site, e.g. an httptest.Server.
+//
+func WithBaseURL(rawurl string) Option {
+	return func(c *Client) error {
+		u, err := url.Parse(rawurl)
+		if err != nil {
+			return fmt.Errorf("bggclient.WithBaseURL: could not parse '%s': %v", rawurl, err)
+		}
+		c.baseURL = u
+
+		return nil
+	}
+}
+
+// WithTransport replaces the default TLS transport.
+//
+func WithTransport(transport http.RoundTripper) Option {
+	return func(c *Client) error {
+		c.httpClient.Transport = transport
+
+		return nil
+	}
+}
+
+// WithCookieJar replaces the default cookie jar. The jar is where the
+// credential cookies are stored, so pass a fresh jar per account.
+//
+func WithCookieJar(jar http.CookieJar) Option {
+	return func(c *Client) error {
+		if jar == nil {
+			return errors.New("bggclient.WithCookieJar: jar must not be nil")
+		}
+		c.httpClient.Jar = jar
+
+		return nil
+	}
+}
+
+// WithTimeout sets the overall time limit for each request. Zero means no timeout.
+//
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) error {
+		c.httpClient.Timeout = timeout
+
+		return nil
+	}
+}
+
+// WithCredentials sets the user's login cookies on the new client. It is
+// equivalent to calling SetCredentials once the client is created, so it
+// does not matter whether it comes before or after WithBaseURL.
+//
+func WithCredentials(credentials Credentials) Option {
+	return func(c *Client) error {
+		c.credentials = &credentials
+
+		return nil
+	}
+}
+
+// New creates a Client talking to https://boardgamegeek.com over TLS 1.2+,
+// with its own cookie jar, DefaultRequestInterval between requests and
+// DefaultRetryPolicy, and then applies the given options.
+//
+func New(options ...Option) (c *Client, err error) {
+	baseURL, err := url.Parse(DefaultBaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("bggclient.New: error parsing URL: %v", err)
+	}
+
+	jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	if err != nil {
+		return nil, fmt.Errorf("bggclient.New: error creating cookie jar: %v", err)
+	}
+
+	c = &Client{
+		baseURL: baseURL,
+		httpClient: &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{
+					MinVersion: tls.VersionTLS12,
+				},
+			},
+			Jar: jar,
+		},
+		limiter:     &limiter{interval: DefaultRequestInterval},
+		retryPolicy: DefaultRetryPolicy,
+	}
+
+	for _, option := range options {
+		if err = option(c); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.credentials != nil {
+		c.SetCredentials(*c.credentials)
+		c.credentials = nil
+	}
+
+	return c, nil
+}
+
+// BaseURL returns a copy of the URL that relative URLs are resolved against.
+//
+func (c *Client) BaseURL() *url.URL {
+	u := *c.baseURL
+
+	return &u
+}
+
+// SetCredentials creates cookies containing the BGG username and password hash
+// for use by the client.
+//
+func (c *Client) SetCredentials(credentials Credentials) {
+	usernameCookie := http.Cookie{Name: "bggusername", Value: credentials.Username}
+	passHashCookie := http.Cookie{Name: "bggpassword", Value: credentials.PassHash}
+	c.httpClient.Jar.SetCookies(c.baseURL, []*http.Cookie{&usernameCookie, &passHashCookie})
+}
+
+// Download handles an HTTP response that includes a file download.
+//
+func (c *Client) Download(relativeURL *url.URL) (data []byte, err error) {
+	return c.DownloadContext(context.Background(), relativeURL)
+}
+
+// DownloadContext is like Download but gives up when ctx is done.
+//
+func (c *Client) DownloadContext(ctx context.Context, relativeURL *url.URL) (data []byte, err error) {
+	data, _, err = c.FetchContext(ctx, relativeURL)
+
+	return
+}
+
+// Fetch is like Download but also returns the response's status code, for callers
+// that need to tell successful statuses apart: BGG's XML API, for one, answers
+// 202 Accepted while it prepares a response.
+//
+func (c *Client) Fetch(relativeURL *url.URL) (data []byte, status int, err error) {
+	return c.FetchContext(context.Background(), relativeURL)
+}
+
+// FetchContext is like Fetch but gives up when ctx is done.
+//
+func (c *Client) FetchContext(ctx context.Context, relativeURL *url.URL) (data []byte, status int, err error) {
+	u := c.baseURL.ResolveReference(relativeURL)
+	request, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	res, err := c.do(request)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer res.Body.Close()
+
+	if err = checkResponse(res); err != nil {
+		return nil, res.StatusCode, err
+	}
+
+	var b bytes.Buffer
+	writer := bufio.NewWriter(&b)
+
+	_, err = io.Copy(writer, res.Body)
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		data = b.Bytes()
+	}
+
+	return data, res.StatusCode, err
+}
+
+// Get sends an HTTP GET request to the given URL.
+//
+func (c *Client) Get(relativeURL *url.URL) (page string, err error) {
+	return c.GetContext(context.Background(), relativeURL)
+}
+
+// GetContext is like Get but gives up when ctx is done.
+//
+func (c *Client) GetContext(ctx context.Context, relativeURL *url.URL) (page string, err error) {
+	page, _, _, err = c.GetIfChangedContext(ctx, relativeURL, Validators{})
+
+	return
+}
+
+// Validators identify a version of a page by its ETag and Last-Modified headers,
+// so that it can later be fetched again only if it has changed.
+//
+type Validators struct {
+	ETag         string `json:",omitempty"`
+	LastModified string `json:",omitempty"`
+}
+
+// GetIfChanged is like Get but makes a conditional request with the validators
+// returned by an earlier call. If the server says the page has not changed since,
+// changed is false and page is empty. The page's current validators are returned
+// either way.
+//
+func (c *Client) GetIfChanged(relativeURL *url.URL, previous Validators) (page string, current Validators, changed bool, err error) {
+	return c.GetIfChangedContext(context.Background(), relativeURL, previous)
+}
+
+// GetIfChangedContext is like GetIfChanged but gives up when ctx is done.
+//
+func (c *Client) GetIfChangedContext(ctx context.Context, relativeURL *url.URL, previous Validators) (page string, current Validators, changed bool, err error) {
+	u := c.baseURL.ResolveReference(relativeURL)
+	request, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return "", Validators{}, false, err
+	}
+	if previous.ETag != "" {
+		request.Header.Set("If-None-Match", previous.ETag)
+	}
+	if previous.LastModified != "" {
+		request.Header.Set("If-Modified-Since", previous.LastModified)
+	}
+
+	res, err := c.do(request)
+	if err != nil {
+		return "", Validators{}, false, err
+	}
+	defer res.Body.Close()
+
+	current = Validators{ETag: res.Header.Get("ETag"), LastModified: res.Header.Get("Last-Modified")}
+
+	if res.StatusCode == http.StatusNotModified {
+		if current == (Validators{}) {
+			current = previous
+		}
+		return "", current, false, nil
+	}
+
+	if err = checkResponse(res); err != nil {
+		return "", Validators{}, false, err
+	}
+
+	bytes, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", Validators{}, false, err
+	}
+
+	return string(bytes), current, true, nil
+}
+
+// Post sends an HTTP POST request to the given URL with the given form data.
+// A response with a status other than 2xx is closed and reported as an error;
+// otherwise the caller is responsible for closing the response body.
+//
+func (c *Client) Post(relativeURL *url.URL, data url.Values) (res *http.Response, err error) {
+	return c.PostContext(context.Background(), relativeURL, data)
+}
+
+// PostContext is like Post but gives up when ctx is done.
+//
+func (c *Client) PostContext(ctx context.Context, relativeURL *url.URL, data url.Values) (res *http.Response, err error) {
+	u := c.baseURL.ResolveReference(relativeURL)
+	request, err := http.NewRequestWithContext(ctx, "POST", u.String(), strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, err = c.do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = checkResponse(res); err != nil {
+		res.Body.Close()
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// Upload sends an HTTP POST request with a file upload.
+//
+func (c *Client) Upload(relativeURL *url.URL, data []byte, filename, fileFieldName string, fields map[string]string) (err error) {
+	return c.UploadContext(context.Background(), relativeURL, data, filename, fileFieldName, fields)
+}
+
+// UploadContext is like Upload but gives up when ctx is done.
+//
+func (c *Client) UploadContext(ctx context.Context, relativeURL *url.URL, data []byte, filename, fileFieldName string, fields map[string]string) (err error) {
+	u := c.baseURL.ResolveReference(relativeURL)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile(fileFieldName, filepath.Base(filename))
+	if err != nil {
+		return err
+	}
+
+	r := bytes.NewReader(data)
+	_, err = io.Copy(part, r)
+	if err != nil {
+		return err
+	}
+
+	for key, val := range fields {
+		_ = writer.WriteField(key, val)
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, "POST", u.String(), body)
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+
+	res, err := c.do(request)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	return checkResponse(res)
+}
+
+// Local Variables:
+// compile-command: "go build"
+// End:
@@ -0,0 +1,99 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bggclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestClientSendsCredentialsToBaseURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie("bggusername")
+		if err != nil {
+			w.Write([]byte("anonymous"))
+			return
+		}
+		w.Write([]byte(r.URL.Path + " " + cookie.Value))
+	}))
+	defer server.Close()
+
+	first, err := New(WithBaseURL(server.URL), WithCredentials(Credentials{"alice", "hash"}))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	second, err := New(WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	relativeURL, _ := url.Parse("microbadge/edit")
+
+	cases := []struct {
+		client *Client
+		want   string
+	}{
+		{first, "/microbadge/edit alice"},
+		{second, "anonymous"},
+	}
+
+	for _, c := range cases {
+		got, err := c.client.Get(relativeURL)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if got != c.want {
+			t.Errorf("Get(%s) == %q, want %q", relativeURL, got, c.want)
+		}
+	}
+}
+
+func TestGetContextHonorsCancellation(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client, err := New(WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	relativeURL, _ := url.Parse("myprofile")
+	_, err = client.GetContext(ctx, relativeURL)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("GetContext with cancelled context returned %v, want context.Canceled", err)
+	}
+}
+
+// Local Variables:
+// compile-command: "go test"
+// End:
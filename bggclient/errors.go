@@ -0,0 +1,139 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bggclient
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// These errors classify the ways a conversation with BGG can go wrong. Errors
+// returned by this package and by the packages built on it (avatar, geekbadge,
+// microbadge and overtext) match one of them with errors.Is when the cause is known.
+//
+var (
+	ErrNotAuthenticated = errors.New("not logged in to BoardGameGeek")
+	ErrRateLimited      = errors.New("rate limited by BoardGameGeek")
+	ErrServer           = errors.New("BoardGameGeek server error")
+	ErrUnexpectedLayout = errors.New("unexpected BoardGameGeek page layout")
+)
+
+// StatusError is returned when BGG answers with a status other than 2xx, or
+// sends the request off to the login page.
+//
+type StatusError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	// RetryAfter is the delay requested by the server's Retry-After header, if any.
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s %s: %d %s", e.Method, e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Is lets errors.Is match a StatusError against ErrNotAuthenticated, ErrRateLimited
+// or ErrServer.
+//
+func (e *StatusError) Is(target error) bool {
+	switch target {
+	case ErrNotAuthenticated:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrServer:
+		return e.StatusCode >= 500
+	}
+
+	return false
+}
+
+// LayoutError is returned when a page was fetched successfully but does not
+// contain what the scraper expected, usually because BGG changed its HTML.
+//
+type LayoutError struct {
+	Op   string // the function doing the parsing, e.g. "overtext.Get"
+	What string // what could not be found, e.g. "avatar overtext"
+}
+
+func (e *LayoutError) Error() string {
+	return fmt.Sprintf("%s: could not parse %s", e.Op, e.What)
+}
+
+func (e *LayoutError) Unwrap() error {
+	return ErrUnexpectedLayout
+}
+
+// checkResponse turns an unsuccessful response into a *StatusError. A request
+// that was redirected to the login page is reported as 401 Unauthorized, since
+// that is how BGG answers when the credential cookies are missing or stale.
+//
+func checkResponse(res *http.Response) error {
+	if strings.HasPrefix(res.Request.URL.Path, "/login") {
+		return &StatusError{
+			Method:     res.Request.Method,
+			URL:        res.Request.URL.String(),
+			StatusCode: http.StatusUnauthorized,
+		}
+	}
+
+	if 200 <= res.StatusCode && res.StatusCode < 300 {
+		return nil
+	}
+
+	return &StatusError{
+		Method:     res.Request.Method,
+		URL:        res.Request.URL.String(),
+		StatusCode: res.StatusCode,
+		RetryAfter: retryAfter(res.Header.Get("Retry-After")),
+	}
+}
+
+// retryAfter parses a Retry-After header, which is either a number of seconds
+// or an HTTP date. Anything unparseable counts as no delay.
+//
+func retryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if when, err := http.ParseTime(value); err == nil {
+		if d := time.Until(when); d > 0 {
+			return d
+		}
+	}
+
+	return 0
+}
+
+// Local Variables:
+// compile-command: "go build"
+// End:
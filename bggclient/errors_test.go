@@ -0,0 +1,97 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bggclient
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestStatusErrors(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/forbidden", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+	mux.HandleFunc("/throttled", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	mux.HandleFunc("/unavailable", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	mux.HandleFunc("/stale", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/login?redirect=stale", http.StatusFound)
+	})
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<form>please log in</form>"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client, err := New(WithBaseURL(server.URL), WithRetryPolicy(NoRetry), WithRateLimit(0))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	cases := []struct {
+		path       string
+		want       error
+		retryAfter time.Duration
+	}{
+		{"forbidden", ErrNotAuthenticated, 0},
+		{"throttled", ErrRateLimited, 7 * time.Second},
+		{"unavailable", ErrServer, 0},
+		{"stale", ErrNotAuthenticated, 0},
+	}
+
+	for _, c := range cases {
+		relativeURL, _ := url.Parse(c.path)
+		_, err := client.Get(relativeURL)
+		if !errors.Is(err, c.want) {
+			t.Errorf("Get(%s) returned %v, want %v", c.path, err, c.want)
+			continue
+		}
+
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) {
+			t.Errorf("Get(%s) returned %T, want *StatusError", c.path, err)
+		} else if statusErr.RetryAfter != c.retryAfter {
+			t.Errorf("Get(%s) RetryAfter == %v, want %v", c.path, statusErr.RetryAfter, c.retryAfter)
+		}
+	}
+}
+
+func TestLayoutErrorIsUnexpectedLayout(t *testing.T) {
+	var err error = &LayoutError{Op: "overtext.Get", What: "avatar overtext"}
+
+	if !errors.Is(err, ErrUnexpectedLayout) {
+		t.Errorf("errors.Is(%v, ErrUnexpectedLayout) == false, want true", err)
+	}
+}
+
+// Local Variables:
+// compile-command: "go test"
+// End:
@@ -0,0 +1,230 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bggclient
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultRequestInterval is the minimum time between the start of two requests
+// made by the same client. BGG throttles clients that hammer it, e.g. when
+// fetching metadata for several hundred microbadges in a row.
+//
+const DefaultRequestInterval = 500 * time.Millisecond
+
+// RetryPolicy describes how a Client retries requests that failed with a network
+// error, 429 Too Many Requests or a 5xx status. Delays grow exponentially from
+// BaseDelay up to MaxDelay, with full jitter, unless the server sent a
+// Retry-After header, which is honored instead. A Retry-After longer than
+// MaxDelay is not waited for: the request fails straight away, with a
+// *StatusError (ErrRateLimited for a 429) carrying the delay asked for.
+//
+type RetryPolicy struct {
+	// MaxAttempts is the total number of tries, including the first one.
+	// Values below 2 disable retrying.
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	// RetryNonIdempotent allows POSTs (setting a slot, saving overtext, uploading
+	// an avatar) to be retried too. Off by default, since BGG may have acted on
+	// a request whose response was lost.
+	RetryNonIdempotent bool
+}
+
+// DefaultRetryPolicy is used by clients created without WithRetryPolicy.
+//
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   time.Second,
+	MaxDelay:    30 * time.Second,
+}
+
+// NoRetry disables retrying.
+//
+var NoRetry = RetryPolicy{MaxAttempts: 1}
+
+// WithRetryPolicy replaces DefaultRetryPolicy.
+//
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) error {
+		c.retryPolicy = policy
+
+		return nil
+	}
+}
+
+// WithRateLimit sets the minimum time between the start of two requests.
+// Zero disables rate limiting.
+//
+func WithRateLimit(interval time.Duration) Option {
+	return func(c *Client) error {
+		c.limiter = &limiter{interval: interval}
+
+		return nil
+	}
+}
+
+// limiter spaces out requests so that each one starts at least interval after
+// the previous one. It is shared by all goroutines using the same Client.
+//
+type limiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func (l *limiter) wait(ctx context.Context) error {
+	if l.interval <= 0 {
+		return ctx.Err()
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	start := l.next
+	if start.Before(now) {
+		start = now
+	}
+	l.next = start.Add(l.interval)
+	l.mu.Unlock()
+
+	return sleep(ctx, start.Sub(now))
+}
+
+// sleep waits for d, or until ctx is done, whichever comes first.
+//
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (p RetryPolicy) allows(request *http.Request) bool {
+	if p.MaxAttempts < 2 {
+		return false
+	}
+
+	switch request.Method {
+	case "GET", "HEAD":
+		return true
+	}
+
+	return p.RetryNonIdempotent && request.GetBody != nil
+}
+
+// backoff returns how long to wait before retry number attempt (starting at 1),
+// or false if the server asked for a longer wait than MaxDelay.
+//
+func (p RetryPolicy) backoff(attempt int, retryAfter time.Duration) (time.Duration, bool) {
+	if retryAfter > 0 {
+		if p.MaxDelay > 0 && retryAfter > p.MaxDelay {
+			return 0, false
+		}
+		return retryAfter, true
+	}
+
+	ceiling := p.BaseDelay
+	for i := 1; i < attempt && ceiling < p.MaxDelay; i++ {
+		ceiling *= 2
+	}
+	if p.MaxDelay > 0 && ceiling > p.MaxDelay {
+		ceiling = p.MaxDelay
+	}
+	if ceiling <= 0 {
+		return 0, true
+	}
+
+	return time.Duration(rand.Int63n(int64(ceiling) + 1)), true
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// do sends request once the rate limiter allows it, retrying according to the
+// client's retry policy. The final response is returned as is; callers use
+// checkResponse to turn a bad status into an error.
+//
+func (c *Client) do(request *http.Request) (res *http.Response, err error) {
+	ctx := request.Context()
+	retry := c.retryPolicy.allows(request)
+
+	for attempt := 1; ; attempt++ {
+		if err = c.limiter.wait(ctx); err != nil {
+			return nil, err
+		}
+
+		res, err = c.httpClient.Do(request)
+
+		last := !retry || attempt >= c.retryPolicy.MaxAttempts
+		if err != nil && (last || ctx.Err() != nil) {
+			return nil, err
+		}
+		if err == nil && (last || !retryableStatus(res.StatusCode)) {
+			return res, nil
+		}
+
+		var delay time.Duration
+		if err == nil {
+			var ok bool
+			delay, ok = c.retryPolicy.backoff(attempt, retryAfter(res.Header.Get("Retry-After")))
+			if !ok {
+				return res, nil
+			}
+			io.Copy(ioutil.Discard, res.Body)
+			res.Body.Close()
+		} else {
+			delay, _ = c.retryPolicy.backoff(attempt, 0)
+		}
+
+		if err = sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+
+		if request.GetBody != nil {
+			body, err := request.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			request.Body = body
+		}
+	}
+}
+
+// Local Variables:
+// compile-command: "go build"
+// End:
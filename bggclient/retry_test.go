@@ -0,0 +1,143 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package bggclient
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetries(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+
+	cases := []struct {
+		method    string
+		wantErr   bool
+		wantCalls int32
+	}{
+		{"GET", false, 3},
+		{"POST", true, 1},
+	}
+
+	for _, c := range cases {
+		atomic.StoreInt32(&calls, 0)
+
+		client, err := New(WithBaseURL(server.URL), WithRetryPolicy(policy), WithRateLimit(0))
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+
+		relativeURL, _ := url.Parse("microbadge/1")
+		if c.method == "GET" {
+			_, err = client.Get(relativeURL)
+		} else {
+			_, err = client.Post(relativeURL, url.Values{"action": {"setslot"}})
+		}
+
+		if (err != nil) != c.wantErr {
+			t.Errorf("%s returned error %v, want error: %v", c.method, err, c.wantErr)
+		}
+		if got := atomic.LoadInt32(&calls); got != c.wantCalls {
+			t.Errorf("%s made %d requests, want %d", c.method, got, c.wantCalls)
+		}
+	}
+}
+
+func TestRetryAfterBeyondMaxDelay(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Retry-After", r.URL.Query().Get("wait"))
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 2 * time.Second}
+
+	cases := []struct {
+		wait      string
+		wantCalls int32
+	}{
+		{"1", 3},
+		{"60", 1},
+	}
+
+	for _, c := range cases {
+		atomic.StoreInt32(&calls, 0)
+
+		client, err := New(WithBaseURL(server.URL), WithRetryPolicy(policy), WithRateLimit(0))
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+
+		relativeURL, _ := url.Parse("microbadge/1?wait=" + c.wait)
+		_, err = client.Get(relativeURL)
+		if !errors.Is(err, ErrRateLimited) {
+			t.Errorf("Retry-After %s: Get returned %v, want %v", c.wait, err, ErrRateLimited)
+		}
+		if got := atomic.LoadInt32(&calls); got != c.wantCalls {
+			t.Errorf("Retry-After %s: made %d requests, want %d", c.wait, got, c.wantCalls)
+		}
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	const interval = 20 * time.Millisecond
+	client, err := New(WithBaseURL(server.URL), WithRateLimit(interval))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	relativeURL, _ := url.Parse("myprofile")
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := client.Get(relativeURL); err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed < 2*interval {
+		t.Errorf("3 requests took %v, want at least %v", elapsed, 2*interval)
+	}
+}
+
+// Local Variables:
+// compile-command: "go test"
+// End:
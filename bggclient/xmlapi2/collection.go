@@ -0,0 +1,118 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package xmlapi2
+
+import (
+	"context"
+	"encoding/xml"
+	"net/url"
+
+	"github.com/profburke/bgurt/bggclient"
+)
+
+// The subtypes of things the API distinguishes between. Note that BGG counts
+// expansions as board games too, unless told otherwise.
+//
+const (
+	BoardGame = "boardgame"
+	Expansion = "boardgameexpansion"
+)
+
+// CollectionQuery selects the items of a collection. The zero value asks for
+// everything in it.
+//
+type CollectionQuery struct {
+	Subtype        string // only items of this subtype, e.g. BoardGame
+	ExcludeSubtype string // leaving out items of this subtype, e.g. Expansion
+	Own            bool   // only items owned
+	Played         bool   // only items played
+}
+
+// Collection is a user's collection, or the part of it a query selected.
+//
+type Collection struct {
+	XMLName    xml.Name         `xml:"items"`
+	TotalItems int              `xml:"totalitems,attr"`
+	Items      []CollectionItem `xml:"item"`
+}
+
+// CollectionItem is a thing in a collection.
+//
+type CollectionItem struct {
+	ID            uint   `xml:"objectid,attr"`
+	CollectionID  uint   `xml:"collid,attr"`
+	Subtype       string `xml:"subtype,attr"`
+	Name          string `xml:"name"`
+	YearPublished int    `xml:"yearpublished"`
+	Image         string `xml:"image"`
+	Thumbnail     string `xml:"thumbnail"`
+	Status        Status `xml:"status"`
+	NumPlays      int    `xml:"numplays"`
+}
+
+// Status is how a thing is marked in a collection.
+//
+type Status struct {
+	Own             bool `xml:"own,attr"`
+	PreviouslyOwned bool `xml:"prevowned,attr"`
+	ForTrade        bool `xml:"fortrade,attr"`
+	Want            bool `xml:"want,attr"`
+	WantToPlay      bool `xml:"wanttoplay,attr"`
+	WantToBuy       bool `xml:"wanttobuy,attr"`
+	Wishlist        bool `xml:"wishlist,attr"`
+	Preordered      bool `xml:"preordered,attr"`
+}
+
+// GetCollection returns the items in username's collection that query selects.
+//
+func GetCollection(client *bggclient.Client, username string, query CollectionQuery) (collection *Collection, err error) {
+	return GetCollectionContext(context.Background(), client, username, query)
+}
+
+// GetCollectionContext is like GetCollection but gives up when ctx is done.
+//
+func GetCollectionContext(ctx context.Context, client *bggclient.Client, username string, query CollectionQuery) (collection *Collection, err error) {
+	values := url.Values{"username": {username}}
+	if query.Subtype != "" {
+		values.Set("subtype", query.Subtype)
+	}
+	if query.ExcludeSubtype != "" {
+		values.Set("excludesubtype", query.ExcludeSubtype)
+	}
+	if query.Own {
+		values.Set("own", "1")
+	}
+	if query.Played {
+		values.Set("played", "1")
+	}
+
+	collection = &Collection{}
+	if err := get(ctx, client, "xmlapi2.GetCollection", "collection", values, collection); err != nil {
+		return nil, err
+	}
+
+	return collection, nil
+}
+
+// Local Variables:
+// compile-command: "go build"
+// End:
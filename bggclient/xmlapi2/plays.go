@@ -0,0 +1,152 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package xmlapi2
+
+import (
+	"context"
+	"encoding/xml"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/profburke/bgurt/bggclient"
+)
+
+// PlaysQuery selects some of a user's logged plays. The zero value, apart from
+// the username, asks for all of them.
+//
+type PlaysQuery struct {
+	Username string
+	ID       uint      // only plays of this thing
+	MinDate  time.Time // only plays on or after this day
+	MaxDate  time.Time // only plays on or before this day
+	Subtype  string    // only plays of things of this subtype
+}
+
+// Plays is a list of logged plays.
+//
+type Plays struct {
+	XMLName  xml.Name `xml:"plays"`
+	Username string   `xml:"username,attr"`
+	UserID   uint     `xml:"userid,attr"`
+	Total    int      `xml:"total,attr"`
+	Plays    []Play   `xml:"play"`
+}
+
+// Play is one logged play (or, with a Quantity over 1, several of the same game).
+//
+type Play struct {
+	ID         uint     `xml:"id,attr"`
+	Date       Date     `xml:"date,attr"`
+	Quantity   int      `xml:"quantity,attr"`
+	Length     int      `xml:"length,attr"` // in minutes
+	Incomplete bool     `xml:"incomplete,attr"`
+	NoWinStats bool     `xml:"nowinstats,attr"`
+	Location   string   `xml:"location,attr"`
+	Item       PlayItem `xml:"item"`
+	Comments   string   `xml:"comments"`
+	Players    []Player `xml:"players>player"`
+}
+
+// PlayItem is the thing that was played.
+//
+type PlayItem struct {
+	ID         uint      `xml:"objectid,attr"`
+	Name       string    `xml:"name,attr"`
+	ObjectType string    `xml:"objecttype,attr"`
+	Subtypes   []Subtype `xml:"subtypes>subtype"`
+}
+
+// Subtype is one of the subtypes of a played thing, e.g. BoardGame.
+//
+type Subtype struct {
+	Value string `xml:"value,attr"`
+}
+
+// IsExpansion reports whether the thing played is an expansion.
+//
+func (item PlayItem) IsExpansion() bool {
+	for _, subtype := range item.Subtypes {
+		if subtype.Value == Expansion {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Player is someone who took part in a play.
+//
+type Player struct {
+	Username      string `xml:"username,attr"`
+	UserID        uint   `xml:"userid,attr"`
+	Name          string `xml:"name,attr"`
+	StartPosition string `xml:"startposition,attr"`
+	Color         string `xml:"color,attr"`
+	Score         string `xml:"score,attr"`
+	New           bool   `xml:"new,attr"`
+	Win           bool   `xml:"win,attr"`
+}
+
+// GetPlays returns the plays query selects, fetching every page of them.
+//
+func GetPlays(client *bggclient.Client, query PlaysQuery) (plays *Plays, err error) {
+	return GetPlaysContext(context.Background(), client, query)
+}
+
+// GetPlaysContext is like GetPlays but gives up when ctx is done.
+//
+func GetPlaysContext(ctx context.Context, client *bggclient.Client, query PlaysQuery) (plays *Plays, err error) {
+	values := url.Values{"username": {query.Username}}
+	if query.ID != 0 {
+		values.Set("id", strconv.FormatUint(uint64(query.ID), 10))
+	}
+	if !query.MinDate.IsZero() {
+		values.Set("mindate", query.MinDate.Format(dateLayout))
+	}
+	if !query.MaxDate.IsZero() {
+		values.Set("maxdate", query.MaxDate.Format(dateLayout))
+	}
+	if query.Subtype != "" {
+		values.Set("subtype", query.Subtype)
+	}
+
+	plays = &Plays{}
+	for page := 1; ; page++ {
+		values.Set("page", strconv.Itoa(page))
+
+		var current Plays
+		if err := get(ctx, client, "xmlapi2.GetPlays", "plays", values, &current); err != nil {
+			return nil, err
+		}
+		plays.Username, plays.UserID, plays.Total = current.Username, current.UserID, current.Total
+		plays.Plays = append(plays.Plays, current.Plays...)
+
+		if len(current.Plays) == 0 || len(plays.Plays) >= plays.Total {
+			return plays, nil
+		}
+	}
+}
+
+// Local Variables:
+// compile-command: "go build"
+// End:
@@ -0,0 +1,151 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package xmlapi2
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/profburke/bgurt/bggclient"
+	"github.com/profburke/bgurt/parser"
+)
+
+// Provider supplies the text tags (see the parser package) that count games:
+//
+//	[GO]   games owned
+//	[GP]   different games played
+//	[30]   plays of games and expansions logged in the last 30 days
+//	[30e]  plays of games logged in the last 30 days, leaving out expansions
+//	[30E]  plays of expansions logged in the last 30 days
+//
+// As with the BGG Randomizer's tags, [30] and its kin count plays, so a game
+// played three times counts three times (and a play logged with a quantity
+// counts that many times).
+//
+// Each count is fetched once, when one of its tags is first expanded.
+//
+type Provider struct {
+	client   *bggclient.Client
+	username string
+	now      func() time.Time
+
+	mu     sync.Mutex
+	counts map[string]int
+	recent *Plays
+}
+
+// NewProvider returns a provider of the tags for username's games.
+//
+func NewProvider(client *bggclient.Client, username string) *Provider {
+	return &Provider{client: client, username: username, now: time.Now, counts: make(map[string]int)}
+}
+
+// Tags returns the tags the provider supplies.
+//
+func (p *Provider) Tags() map[string]parser.Func {
+	games := CollectionQuery{Subtype: BoardGame, ExcludeSubtype: Expansion}
+	owned, played := games, games
+	owned.Own = true
+	played.Played = true
+
+	return map[string]parser.Func{
+		"GO":  p.collectionSize(owned),
+		"GP":  p.collectionSize(played),
+		"30":  p.recentlyPlayed(func(item PlayItem) bool { return true }),
+		"30e": p.recentlyPlayed(func(item PlayItem) bool { return !item.IsExpansion() }),
+		"30E": p.recentlyPlayed(PlayItem.IsExpansion),
+	}
+}
+
+// collectionSize returns a tag giving the number of items query selects from the
+// collection.
+//
+func (p *Provider) collectionSize(query CollectionQuery) parser.Func {
+	key := strconv.FormatBool(query.Own) + strconv.FormatBool(query.Played)
+
+	return func(ctx context.Context, tag parser.Tag) (string, error) {
+		if p.username == "" {
+			return "", errors.New("no username to look up")
+		}
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		count, ok := p.counts[key]
+		if !ok {
+			collection, err := GetCollectionContext(ctx, p.client, p.username, query)
+			if err != nil {
+				return "", err
+			}
+			count = collection.TotalItems
+			p.counts[key] = count
+		}
+
+		return strconv.Itoa(count), nil
+	}
+}
+
+// recentlyPlayed returns a tag giving the number of plays logged in the last 30
+// days of the things include selects.
+//
+func (p *Provider) recentlyPlayed(include func(item PlayItem) bool) parser.Func {
+	return func(ctx context.Context, tag parser.Tag) (string, error) {
+		if p.username == "" {
+			return "", errors.New("no username to look up")
+		}
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		if p.recent == nil {
+			plays, err := GetPlaysContext(ctx, p.client, PlaysQuery{
+				Username: p.username,
+				MinDate:  p.now().AddDate(0, 0, -30),
+			})
+			if err != nil {
+				return "", err
+			}
+			p.recent = plays
+		}
+
+		count := 0
+		for _, play := range p.recent.Plays {
+			if !include(play.Item) {
+				continue
+			}
+			if play.Quantity > 1 {
+				count += play.Quantity
+			} else {
+				count++
+			}
+		}
+
+		return strconv.Itoa(count), nil
+	}
+}
+
+// Local Variables:
+// compile-command: "go build"
+// End:
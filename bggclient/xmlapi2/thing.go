@@ -0,0 +1,185 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package xmlapi2
+
+import (
+	"context"
+	"encoding/xml"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/profburke/bgurt/bggclient"
+)
+
+// MaxThingsPerRequest is how many things BGG will describe in one request;
+// GetThings asks for more a batch at a time.
+//
+const MaxThingsPerRequest = 20
+
+// Thing is a game, expansion, accessory or the like.
+//
+type Thing struct {
+	ID             uint
+	Type           string // e.g. BoardGame
+	Name           string // the primary name
+	AlternateNames []string
+	Description    string
+	YearPublished  int
+	MinPlayers     int
+	MaxPlayers     int
+	PlayingTime    int // in minutes
+	MinAge         int
+	Image          string
+	Thumbnail      string
+	Links          []Link
+	Statistics     *Statistics // nil unless asked for
+}
+
+// Link connects a thing to a category, mechanic, designer, expansion and so on.
+//
+type Link struct {
+	Type  string `xml:"type,attr"` // e.g. "boardgamecategory"
+	ID    uint   `xml:"id,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// Statistics are what BGG users make of a thing.
+//
+type Statistics struct {
+	UsersRated   int
+	Average      float64
+	BayesAverage float64
+	Owned        int
+}
+
+// rawThing is how the API writes a Thing.
+//
+type rawThing struct {
+	ID    uint   `xml:"id,attr"`
+	Type  string `xml:"type,attr"`
+	Names []struct {
+		Type  string `xml:"type,attr"`
+		Value string `xml:"value,attr"`
+	} `xml:"name"`
+	Description   string `xml:"description"`
+	YearPublished value  `xml:"yearpublished"`
+	MinPlayers    value  `xml:"minplayers"`
+	MaxPlayers    value  `xml:"maxplayers"`
+	PlayingTime   value  `xml:"playingtime"`
+	MinAge        value  `xml:"minage"`
+	Image         string `xml:"image"`
+	Thumbnail     string `xml:"thumbnail"`
+	Links         []Link `xml:"link"`
+	Ratings       *struct {
+		UsersRated   value `xml:"usersrated"`
+		Average      value `xml:"average"`
+		BayesAverage value `xml:"bayesaverage"`
+		Owned        value `xml:"owned"`
+	} `xml:"statistics>ratings"`
+}
+
+func (raw rawThing) thing() Thing {
+	atoi := func(v value) int {
+		n, _ := strconv.Atoi(v.Value)
+		return n
+	}
+	atof := func(v value) float64 {
+		f, _ := strconv.ParseFloat(v.Value, 64)
+		return f
+	}
+
+	thing := Thing{
+		ID:            raw.ID,
+		Type:          raw.Type,
+		Description:   strings.TrimSpace(raw.Description),
+		YearPublished: atoi(raw.YearPublished),
+		MinPlayers:    atoi(raw.MinPlayers),
+		MaxPlayers:    atoi(raw.MaxPlayers),
+		PlayingTime:   atoi(raw.PlayingTime),
+		MinAge:        atoi(raw.MinAge),
+		Image:         strings.TrimSpace(raw.Image),
+		Thumbnail:     strings.TrimSpace(raw.Thumbnail),
+		Links:         raw.Links,
+	}
+	for _, name := range raw.Names {
+		if name.Type == "primary" {
+			thing.Name = name.Value
+		} else {
+			thing.AlternateNames = append(thing.AlternateNames, name.Value)
+		}
+	}
+	if raw.Ratings != nil {
+		thing.Statistics = &Statistics{
+			UsersRated:   atoi(raw.Ratings.UsersRated),
+			Average:      atof(raw.Ratings.Average),
+			BayesAverage: atof(raw.Ratings.BayesAverage),
+			Owned:        atoi(raw.Ratings.Owned),
+		}
+	}
+
+	return thing
+}
+
+// GetThings describes the things with the given ids, with their statistics if
+// stats is set. Ids BGG doesn't know are left out.
+//
+func GetThings(client *bggclient.Client, ids []uint, stats bool) (things []Thing, err error) {
+	return GetThingsContext(context.Background(), client, ids, stats)
+}
+
+// GetThingsContext is like GetThings but gives up when ctx is done.
+//
+func GetThingsContext(ctx context.Context, client *bggclient.Client, ids []uint, stats bool) (things []Thing, err error) {
+	for start := 0; start < len(ids); start += MaxThingsPerRequest {
+		end := start + MaxThingsPerRequest
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		batch := make([]string, 0, end-start)
+		for _, id := range ids[start:end] {
+			batch = append(batch, strconv.FormatUint(uint64(id), 10))
+		}
+		values := url.Values{"id": {strings.Join(batch, ",")}}
+		if stats {
+			values.Set("stats", "1")
+		}
+
+		var response struct {
+			XMLName xml.Name   `xml:"items"`
+			Items   []rawThing `xml:"item"`
+		}
+		if err := get(ctx, client, "xmlapi2.GetThings", "thing", values, &response); err != nil {
+			return nil, err
+		}
+		for _, raw := range response.Items {
+			things = append(things, raw.thing())
+		}
+	}
+
+	return things, nil
+}
+
+// Local Variables:
+// compile-command: "go build"
+// End:
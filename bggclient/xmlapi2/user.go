@@ -0,0 +1,106 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package xmlapi2
+
+import (
+	"context"
+	"encoding/xml"
+	"net/url"
+	"strconv"
+
+	"github.com/profburke/bgurt/bggclient"
+)
+
+// User is the public part of a user's profile.
+//
+type User struct {
+	ID              uint
+	Name            string
+	FirstName       string
+	LastName        string
+	AvatarLink      string
+	YearRegistered  int
+	LastLogin       Date
+	StateOrProvince string
+	Country         string
+	WebAddress      string
+	TradeRating     int
+}
+
+// rawUser is how the API writes a User, with most fields in value attributes.
+//
+type rawUser struct {
+	XMLName        xml.Name `xml:"user"`
+	ID             uint     `xml:"id,attr"`
+	Name           string   `xml:"name,attr"`
+	FirstName      value    `xml:"firstname"`
+	LastName       value    `xml:"lastname"`
+	AvatarLink     value    `xml:"avatarlink"`
+	YearRegistered value    `xml:"yearregistered"`
+	LastLogin      struct {
+		Value Date `xml:"value,attr"`
+	} `xml:"lastlogin"`
+	StateOrProvince value `xml:"stateorprovince"`
+	Country         value `xml:"country"`
+	WebAddress      value `xml:"webaddress"`
+	TradeRating     value `xml:"traderating"`
+}
+
+// GetUser returns the profile of the named user.
+//
+func GetUser(client *bggclient.Client, name string) (user *User, err error) {
+	return GetUserContext(context.Background(), client, name)
+}
+
+// GetUserContext is like GetUser but gives up when ctx is done.
+//
+func GetUserContext(ctx context.Context, client *bggclient.Client, name string) (user *User, err error) {
+	var raw rawUser
+	if err := get(ctx, client, "xmlapi2.GetUser", "user", url.Values{"name": {name}}, &raw); err != nil {
+		return nil, err
+	}
+	// an unknown user comes back as a user with no id
+	if raw.ID == 0 {
+		return nil, &APIError{Op: "xmlapi2.GetUser", Message: "no such user: " + name}
+	}
+
+	yearRegistered, _ := strconv.Atoi(raw.YearRegistered.Value)
+	tradeRating, _ := strconv.Atoi(raw.TradeRating.Value)
+
+	return &User{
+		ID:              raw.ID,
+		Name:            raw.Name,
+		FirstName:       raw.FirstName.Value,
+		LastName:        raw.LastName.Value,
+		AvatarLink:      raw.AvatarLink.Value,
+		YearRegistered:  yearRegistered,
+		LastLogin:       raw.LastLogin.Value,
+		StateOrProvince: raw.StateOrProvince.Value,
+		Country:         raw.Country.Value,
+		WebAddress:      raw.WebAddress.Value,
+		TradeRating:     tradeRating,
+	}, nil
+}
+
+// Local Variables:
+// compile-command: "go build"
+// End:
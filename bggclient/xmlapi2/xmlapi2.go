@@ -0,0 +1,183 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package xmlapi2 reads BGG's XML API, version 2: a user's collection, plays and
+// profile, and the details of games. Where the rest of bgurt scrapes pages, these
+// are documented, typed data; see https://boardgamegeek.com/wiki/page/BGG_XML_API2.
+//
+// Some requests, notably for collections, are queued by BGG, which answers 202
+// Accepted until the response is ready. The functions here wait and ask again, a
+// few times, before giving up with ErrQueued.
+//
+package xmlapi2
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/profburke/bgurt/bggclient"
+)
+
+// ErrQueued is returned when BGG is still preparing a response after all the
+// attempts to fetch it.
+//
+var ErrQueued = errors.New("BoardGameGeek is still preparing the response; try again later")
+
+// How often, and how long apart, a queued request is asked for again. These are
+// variables so that the tests needn't wait.
+//
+var (
+	queuedAttempts = 8
+	queuedDelay    = 3 * time.Second
+)
+
+// APIError is an error reported by the XML API itself, such as an unknown user.
+//
+type APIError struct {
+	Op      string // the function making the request, e.g. "xmlapi2.Plays"
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Op, e.Message)
+}
+
+// errorsResponse is how the API reports errors: as <errors><error><message>, as
+// <error><message> or, for plays, as a <div> of text.
+//
+type errorsResponse struct {
+	XMLName  xml.Name
+	Messages []string `xml:"error>message"`
+	Message  string   `xml:"message"`
+	Text     string   `xml:",chardata"`
+}
+
+// get fetches the API's path with the given query and decodes the response into v,
+// asking again while BGG says it is queued.
+//
+func get(ctx context.Context, client *bggclient.Client, op, path string, query url.Values, v interface{}) error {
+	u := &url.URL{Path: "xmlapi2/" + path, RawQuery: query.Encode()}
+
+	for attempt := 1; ; attempt++ {
+		data, status, err := client.FetchContext(ctx, u)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if status != http.StatusAccepted {
+			return decode(op, data, v)
+		}
+
+		if attempt >= queuedAttempts {
+			return fmt.Errorf("%s: %w", op, ErrQueued)
+		}
+		if err := sleep(ctx, queuedDelay); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+}
+
+// decode unmarshals an API response into v, reporting the API's own errors as
+// an *APIError and anything else it can't read as a *bggclient.LayoutError.
+//
+func decode(op string, data []byte, v interface{}) error {
+	var response errorsResponse
+	if err := xml.Unmarshal(data, &response); err == nil {
+		switch response.XMLName.Local {
+		case "errors", "error":
+			messages := response.Messages
+			if response.Message != "" {
+				messages = append(messages, response.Message)
+			}
+			return &APIError{Op: op, Message: strings.TrimSpace(strings.Join(messages, "; "))}
+		case "div":
+			return &APIError{Op: op, Message: strings.TrimSpace(response.Text)}
+		}
+	}
+
+	if err := xml.Unmarshal(data, v); err != nil {
+		return &bggclient.LayoutError{Op: op, What: fmt.Sprintf("response (%v)", err)}
+	}
+
+	return nil
+}
+
+// sleep waits for d, or until ctx is done, whichever comes first.
+//
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Date is a date in the API's YYYY-MM-DD format.
+//
+type Date struct {
+	time.Time
+}
+
+// dateLayout is how the API writes dates.
+//
+const dateLayout = "2006-01-02"
+
+func (d *Date) UnmarshalXMLAttr(attr xml.Attr) error {
+	if attr.Value == "" || strings.HasPrefix(attr.Value, "0000") {
+		d.Time = time.Time{}
+		return nil
+	}
+
+	t, err := time.Parse(dateLayout, attr.Value)
+	if err != nil {
+		return err
+	}
+	d.Time = t
+
+	return nil
+}
+
+func (d Date) String() string {
+	if d.IsZero() {
+		return ""
+	}
+
+	return d.Format(dateLayout)
+}
+
+// value is the API's way of giving a single value: <yearpublished value="1995"/>.
+//
+type value struct {
+	Value string `xml:"value,attr"`
+}
+
+// Local Variables:
+// compile-command: "go build"
+// End:
@@ -0,0 +1,329 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package xmlapi2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/profburke/bgurt/bggclient"
+	"github.com/profburke/bgurt/parser"
+)
+
+// fakeAPI answers XML API requests with canned responses, by path, and remembers
+// the requests. A response of "" stands for 202 Accepted.
+//
+type fakeAPI struct {
+	mu        sync.Mutex
+	responses map[string][]string
+	requests  []string
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.requests = append(f.requests, r.URL.RequestURI())
+	queue := f.responses[r.URL.Path]
+	if len(queue) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	response := queue[0]
+	if len(queue) > 1 {
+		f.responses[r.URL.Path] = queue[1:]
+	}
+
+	if response == "" {
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprint(w, "Your request for this collection has been accepted and will be processed.")
+		return
+	}
+	w.Header().Set("Content-Type", "text/xml")
+	fmt.Fprint(w, response)
+}
+
+func newFakeAPI(t *testing.T, responses map[string][]string) (*fakeAPI, *bggclient.Client) {
+	queuedDelay = time.Millisecond
+
+	api := &fakeAPI{responses: responses}
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+
+	client, err := bggclient.New(bggclient.WithBaseURL(server.URL), bggclient.WithRateLimit(0),
+		bggclient.WithRetryPolicy(bggclient.NoRetry))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return api, client
+}
+
+const collectionXML = `<?xml version="1.0" encoding="utf-8" standalone="yes"?>
+<items totalitems="2" termsofuse="https://boardgamegeek.com/xmlapi/termsofuse" pubdate="Sun, 18 Oct 2026 09:00:00 +0000">
+	<item objecttype="thing" objectid="13" subtype="boardgame" collid="101">
+		<name sortindex="1">CATAN</name>
+		<yearpublished>1995</yearpublished>
+		<image>https://example.com/catan.jpg</image>
+		<thumbnail>https://example.com/catan_t.jpg</thumbnail>
+		<status own="1" prevowned="0" fortrade="1" want="0" wanttoplay="0" wanttobuy="0" wishlist="0" preordered="0" lastmodified="2020-01-01 10:00:00"/>
+		<numplays>12</numplays>
+	</item>
+	<item objecttype="thing" objectid="822" subtype="boardgame" collid="102">
+		<name sortindex="1">Carcassonne</name>
+		<yearpublished></yearpublished>
+		<status own="1" prevowned="0" fortrade="0" want="0" wanttoplay="1" wanttobuy="0" wishlist="0" preordered="0" lastmodified="2020-01-01 10:00:00"/>
+		<numplays>0</numplays>
+	</item>
+</items>`
+
+func TestGetCollection(t *testing.T) {
+	api, client := newFakeAPI(t, map[string][]string{"/xmlapi2/collection": {"", "", collectionXML}})
+
+	collection, err := GetCollection(client, "alice", CollectionQuery{Subtype: BoardGame, ExcludeSubtype: Expansion, Own: true})
+	if err != nil {
+		t.Fatalf("GetCollection: %v", err)
+	}
+
+	want := &Collection{TotalItems: 2, Items: []CollectionItem{
+		{ID: 13, CollectionID: 101, Subtype: BoardGame, Name: "CATAN", YearPublished: 1995,
+			Image: "https://example.com/catan.jpg", Thumbnail: "https://example.com/catan_t.jpg",
+			Status: Status{Own: true, ForTrade: true}, NumPlays: 12},
+		{ID: 822, CollectionID: 102, Subtype: BoardGame, Name: "Carcassonne",
+			Status: Status{Own: true, WantToPlay: true}},
+	}}
+	collection.XMLName = want.XMLName
+	if !reflect.DeepEqual(collection, want) {
+		t.Errorf("GetCollection() == %+v, want %+v", collection, want)
+	}
+
+	if len(api.requests) != 3 {
+		t.Errorf("made %d requests, want 3 (two of them queued)", len(api.requests))
+	}
+	if got, want := api.requests[0], "/xmlapi2/collection?excludesubtype=boardgameexpansion&own=1&subtype=boardgame&username=alice"; got != want {
+		t.Errorf("requested %s, want %s", got, want)
+	}
+}
+
+func TestQueuedForever(t *testing.T) {
+	api, client := newFakeAPI(t, map[string][]string{"/xmlapi2/collection": {""}})
+
+	_, err := GetCollection(client, "alice", CollectionQuery{})
+	if !errors.Is(err, ErrQueued) {
+		t.Errorf("GetCollection gave error %v, want ErrQueued", err)
+	}
+	if len(api.requests) != queuedAttempts {
+		t.Errorf("made %d requests, want %d", len(api.requests), queuedAttempts)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	_, client := newFakeAPI(t, map[string][]string{
+		"/xmlapi2/collection": {`<errors><error><message>Invalid username specified</message></error></errors>`},
+		"/xmlapi2/plays":      {`<div class='messagebox error'>Invalid object or user</div>`},
+		"/xmlapi2/user":       {`<user id="" name="nobody" termsofuse="https://boardgamegeek.com/xmlapi/termsofuse"></user>`},
+		"/xmlapi2/thing":      {`<html><body>Oops</body></html>`},
+	})
+
+	tests := []struct {
+		name string
+		call func() error
+		want string
+	}{
+		{"collection", func() error { _, err := GetCollection(client, "nobody", CollectionQuery{}); return err },
+			"xmlapi2.GetCollection: Invalid username specified"},
+		{"plays", func() error { _, err := GetPlays(client, PlaysQuery{Username: "nobody"}); return err },
+			"xmlapi2.GetPlays: Invalid object or user"},
+		{"user", func() error { _, err := GetUser(client, "nobody"); return err },
+			"xmlapi2.GetUser: no such user: nobody"},
+	}
+	for _, test := range tests {
+		var apiErr *APIError
+		if err := test.call(); !errors.As(err, &apiErr) || err.Error() != test.want {
+			t.Errorf("%s: got error %v, want an APIError %q", test.name, err, test.want)
+		}
+	}
+
+	if _, err := GetThings(client, []uint{13}, false); !errors.Is(err, bggclient.ErrUnexpectedLayout) {
+		t.Errorf("GetThings gave error %v, want a layout error", err)
+	}
+}
+
+// playsPage returns a page of plays, each of a different item, numbered from first.
+//
+func playsPage(total, first, count int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<plays username="alice" userid="7" total="%d" page="1">`, total)
+	for i := first; i < first+count; i++ {
+		subtype := BoardGame
+		if i%2 == 0 {
+			subtype = Expansion
+		}
+		fmt.Fprintf(&b, `<play id="%d" date="2026-10-%02d" quantity="1" length="30" incomplete="0" nowinstats="0" location="Home">
+<item name="Game %d" objecttype="thing" objectid="%d"><subtypes><subtype value="boardgame"/><subtype value="%s"/></subtypes></item>
+<players><player username="alice" userid="7" name="Alice" startposition="1" color="red" score="10" new="0" rating="0" win="1"/></players>
+</play>`, i, i, i, i, subtype)
+	}
+	b.WriteString(`</plays>`)
+
+	return b.String()
+}
+
+func TestGetPlays(t *testing.T) {
+	api, client := newFakeAPI(t, map[string][]string{"/xmlapi2/plays": {playsPage(3, 1, 2), playsPage(3, 3, 1)}})
+
+	plays, err := GetPlays(client, PlaysQuery{Username: "alice", MinDate: time.Date(2026, 9, 18, 0, 0, 0, 0, time.UTC)})
+	if err != nil {
+		t.Fatalf("GetPlays: %v", err)
+	}
+
+	if plays.Total != 3 || len(plays.Plays) != 3 || plays.UserID != 7 {
+		t.Fatalf("GetPlays() gave %d of %d plays for user %d, want 3 of 3 for user 7", len(plays.Plays), plays.Total, plays.UserID)
+	}
+	first := plays.Plays[0]
+	if first.Date.String() != "2026-10-01" || first.Length != 30 || first.Location != "Home" || first.Item.Name != "Game 1" {
+		t.Errorf("first play is %+v", first)
+	}
+	if first.Item.IsExpansion() || !plays.Plays[1].Item.IsExpansion() {
+		t.Errorf("IsExpansion() wrong for %+v and %+v", first.Item, plays.Plays[1].Item)
+	}
+	if players := first.Players; len(players) != 1 || players[0].Name != "Alice" || !players[0].Win {
+		t.Errorf("first play's players are %+v", players)
+	}
+
+	want := []string{
+		"/xmlapi2/plays?mindate=2026-09-18&page=1&username=alice",
+		"/xmlapi2/plays?mindate=2026-09-18&page=2&username=alice",
+	}
+	if !reflect.DeepEqual(api.requests, want) {
+		t.Errorf("requested %v, want %v", api.requests, want)
+	}
+}
+
+func TestGetUser(t *testing.T) {
+	_, client := newFakeAPI(t, map[string][]string{"/xmlapi2/user": {`<user id="7" name="alice" termsofuse="https://boardgamegeek.com/xmlapi/termsofuse">
+<firstname value="Alice"/><lastname value="Liddell"/><avatarlink value="N/A"/><yearregistered value="2005"/>
+<lastlogin value="2026-10-17"/><stateorprovince value=""/><country value="England"/><webaddress value=""/>
+<traderating value="3"/></user>`}})
+
+	user, err := GetUser(client, "alice")
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+
+	want := &User{ID: 7, Name: "alice", FirstName: "Alice", LastName: "Liddell", AvatarLink: "N/A",
+		YearRegistered: 2005, LastLogin: Date{time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)},
+		Country: "England", TradeRating: 3}
+	if !reflect.DeepEqual(user, want) {
+		t.Errorf("GetUser() == %+v, want %+v", user, want)
+	}
+}
+
+func TestGetThings(t *testing.T) {
+	thing := func(id int) string {
+		return fmt.Sprintf(`<item type="boardgame" id="%d"><name type="primary" sortindex="1" value="Game %d"/>
+<name type="alternate" sortindex="1" value="Spiel %d"/><description>Fun.</description><yearpublished value="2001"/>
+<minplayers value="2"/><maxplayers value="4"/><playingtime value="45"/><minage value="10"/>
+<link type="boardgamecategory" id="1002" value="Card Game"/>
+<statistics page="1"><ratings><usersrated value="100"/><average value="7.5"/><bayesaverage value="6.9"/><owned value="250"/></ratings></statistics>
+</item>`, id, id, id)
+	}
+	batch := func(first, last int) string {
+		var b strings.Builder
+		b.WriteString("<items>")
+		for id := first; id <= last; id++ {
+			b.WriteString(thing(id))
+		}
+		b.WriteString("</items>")
+		return b.String()
+	}
+	api, client := newFakeAPI(t, map[string][]string{"/xmlapi2/thing": {batch(1, 20), batch(21, 25)}})
+
+	ids := make([]uint, 25)
+	for i := range ids {
+		ids[i] = uint(i + 1)
+	}
+	things, err := GetThings(client, ids, true)
+	if err != nil {
+		t.Fatalf("GetThings: %v", err)
+	}
+
+	if len(things) != 25 || len(api.requests) != 2 {
+		t.Fatalf("got %d things in %d requests, want 25 in 2", len(things), len(api.requests))
+	}
+	want := Thing{ID: 25, Type: BoardGame, Name: "Game 25", AlternateNames: []string{"Spiel 25"}, Description: "Fun.",
+		YearPublished: 2001, MinPlayers: 2, MaxPlayers: 4, PlayingTime: 45, MinAge: 10,
+		Links:      []Link{{Type: "boardgamecategory", ID: 1002, Value: "Card Game"}},
+		Statistics: &Statistics{UsersRated: 100, Average: 7.5, BayesAverage: 6.9, Owned: 250}}
+	if !reflect.DeepEqual(things[24], want) {
+		t.Errorf("last thing is %+v, want %+v", things[24], want)
+	}
+	if !strings.HasSuffix(api.requests[1], "?id=21%2C22%2C23%2C24%2C25&stats=1") {
+		t.Errorf("second request was %s", api.requests[1])
+	}
+}
+
+func TestProvider(t *testing.T) {
+	// plays of games 1, 3 and 5 and expansions 2 and 4, then game 1 again and game 3
+	// twice more in one play logged with a quantity
+	plays := strings.Replace(playsPage(7, 1, 5), "</plays>", `<play id="6" date="2026-10-06" quantity="1">
+<item name="Game 1" objecttype="thing" objectid="1"><subtypes><subtype value="boardgame"/></subtypes></item></play>
+<play id="7" date="2026-10-07" quantity="2">
+<item name="Game 3" objecttype="thing" objectid="3"><subtypes><subtype value="boardgame"/></subtypes></item></play>
+</plays>`, 1)
+	api, client := newFakeAPI(t, map[string][]string{
+		"/xmlapi2/collection": {collectionXML},
+		"/xmlapi2/plays":      {plays},
+	})
+
+	provider := NewProvider(client, "alice")
+	provider.now = func() time.Time { return time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC) }
+	engine := parser.New(parser.WithProvider(provider))
+
+	got, err := engine.Expand(context.Background(), "[GO] games, [GO] owned; [30] lately: [30e] games, [30E] expansions")
+	if err != nil {
+		t.Fatalf("Expand: %v", err)
+	}
+	if want := "2 games, 2 owned; 8 lately: 6 games, 2 expansions"; got != want {
+		t.Errorf("Expand() == %q, want %q", got, want)
+	}
+
+	want := []string{
+		"/xmlapi2/collection?excludesubtype=boardgameexpansion&own=1&subtype=boardgame&username=alice",
+		"/xmlapi2/plays?mindate=2026-09-18&page=1&username=alice",
+	}
+	if !reflect.DeepEqual(api.requests, want) {
+		t.Errorf("requested %v, want %v", api.requests, want)
+	}
+}
+
+// Local Variables:
+// compile-command: "go test"
+// End:
@@ -42,11 +42,12 @@ func main() {
 		os.Exit(1)
 	}
 
-	utilities.SetCredentials()
-	err := avatar.Get(os.Args[1])
+	client := utilities.NewClient()
+	ctx, stop := utilities.InterruptContext()
+	defer stop()
+	err := avatar.GetContext(ctx, client, os.Args[1])
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%v\n", err)
-		os.Exit(1)
+		utilities.ReportErrorAndDie("av-fetch", err)
 	}
 }
 
@@ -23,20 +23,32 @@
 // name of a directory containg several images and it will randomly set your avatar to
 // one of the images.
 //
+// It avoids the images used in the latest runs (by default just the last one; see the
+// no-repeat flag), or with the shuffle-bag flag uses every image once before repeating
+// any. The history is kept in the bgurt configuration directory; see "bgurt history".
+//
+// While a theme applies (see the schedule package) that names an avatar folder, that
+// folder is used instead of the one given, which may then be left out.
+//
+// The overlay flag draws microbadges over the chosen image, as for av-set.
+//
+// With the dry-run flag, av-randomize prints the image it would use and changes nothing.
+// Each run's random seed is kept in the history (and the log); the seed flag repeats it.
+//
 package main
 
 import (
 	"flag"
 	"fmt"
 	"log"
-	"math/rand"
 	"os"
 	"path/filepath"
 	"strings"
-	"time"
 
 	"github.com/profburke/bgurt/avatar"
 	"github.com/profburke/bgurt/cli/utilities"
+	"github.com/profburke/bgurt/history"
+	"github.com/profburke/bgurt/schedule"
 )
 
 func visit(files *[]string) filepath.WalkFunc {
@@ -66,18 +78,21 @@ func main() {
 	flag.BoolVar(&verbose, "v", false, "makes execution verbose (shorthand)")
 
 	flag.StringVar(&logfile, "log", "", "filename for log")
+	historySettings := utilities.HistoryFlags()
+	themeSettings := utilities.ThemeFlags()
+	randomSettings := utilities.RandomFlags()
+	overlaySettings := utilities.OverlayFlags()
 
 	flag.Parse()
 
 	args := flag.Args()
 
-	if len(args) != 1 {
-		fmt.Fprintln(os.Stderr, "usage: av-randomize [-v|--verbose] <directoryname>")
+	path := themeSettings.Source("av-randomize", args, randomSettings.Now(), func(th *schedule.Theme) string { return th.Avatars }, verbose)
+	if len(args) > 1 || path == "" {
+		fmt.Fprintln(os.Stderr, "usage: av-randomize [options] <directoryname>")
 		os.Exit(1)
 	}
 
-	path := args[0]
-
 	if !utilities.DirectoryExists(path) {
 		fmt.Fprintf(os.Stderr, "'%s' does not exist.\n", path)
 		os.Exit(1)
@@ -111,21 +126,48 @@ func main() {
 		}
 	}()
 
-	rand.Seed(time.Now().Unix())
-	filename := files[rand.Intn(len(files))]
+	ctx, stop := utilities.InterruptContext()
+	defer stop()
 
-	utilities.SetCredentials()
+	// the history names files relative to the directory, so it survives moving it
+	names := make([]string, len(files))
+	for i, file := range files {
+		names[i], _ = filepath.Rel(path, file)
+	}
+	rotation := historySettings.Open(ctx, "av-randomize", history.Avatar)
+	allowed := rotation.Filter(names, func(allowed []string) bool { return len(allowed) > 0 })
+
+	random := randomSettings.Rand()
+	name := allowed[random.Intn(len(allowed))]
+	filename := filepath.Join(path, name)
+
+	if randomSettings.DryRun {
+		randomSettings.ReportPlan("av-randomize", "set your avatar to "+filename, struct{ Avatar string }{filename})
+		return
+	}
+	randomSettings.ReportSeed("av-randomize")
 
-	err = avatar.Set(filename)
+	client := utilities.NewClient()
+
+	composed, err := overlaySettings.Apply(ctx, client, filename)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		utilities.ReportErrorAndDie("av-randomize", err)
+	}
+	if composed != filename {
+		defer os.Remove(composed)
+	}
+
+	err = avatar.SetContext(ctx, client, composed)
+	if err != nil {
+		utilities.ReportErrorAndDie("av-randomize", err)
 	} else if verbose {
 		fmt.Println("avatar updated")
 	}
 
+	rotation.Record(ctx, randomSettings.Seed, randomSettings.Time, []string{name})
+
 	if len(logfile) > 0 {
-		logger.Printf("avatar set to %s\n", args[0])
+		logger.Printf("avatar set to %s (seed %d)\n", filename, randomSettings.Seed)
 	}
 }
 
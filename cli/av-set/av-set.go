@@ -20,7 +20,9 @@
 // SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
 
 // The av-set program is a command line tool to set the user's avatar.
-// The image in the file named on the command line is sent to the server.
+// The image in the file named on the command line is sent to the server,
+// with the microbadges named by the [MBI1234] tags in the overlay flag drawn
+// over its bottom edge.
 //
 package main
 
@@ -42,6 +44,7 @@ func main() {
 	flag.BoolVar(&verbose, "v", false, "makes execution verbose (shorthand)")
 
 	flag.StringVar(&logfile, "log", "", "filename for log")
+	overlaySettings := utilities.OverlayFlags()
 
 	flag.Parse()
 
@@ -68,11 +71,20 @@ func main() {
 		}
 	}()
 
-	utilities.SetCredentials()
-	err := avatar.Set(args[0])
+	client := utilities.NewClient()
+	ctx, stop := utilities.InterruptContext()
+	defer stop()
+	filename, err := overlaySettings.Apply(ctx, client, args[0])
 	if err != nil {
-		fmt.Printf("%v\n", err)
-		os.Exit(1)
+		utilities.ReportErrorAndDie("av-set", err)
+	}
+	if filename != args[0] {
+		defer os.Remove(filename)
+	}
+
+	err = avatar.SetContext(ctx, client, filename)
+	if err != nil {
+		utilities.ReportErrorAndDie("av-set", err)
 	} else if verbose {
 		// TODO: logging shouldn't be dependent on verbose flag
 		if len(logfile) > 0 {
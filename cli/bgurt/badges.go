@@ -0,0 +1,88 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/profburke/bgurt/cli/utilities"
+	"github.com/profburke/bgurt/microbadge"
+)
+
+// badgesCommand describes a badges file (by default the one mb-fetch saves in the
+// configuration directory). With -migrate, a file in an older format is rewritten
+// in the current one.
+//
+func badgesCommand(args []string) {
+	var migrate bool
+
+	flags := flag.NewFlagSet("badges", flag.ExitOnError)
+	flags.BoolVar(&migrate, "migrate", false, "rewrite the file in the current format")
+	flags.Parse(args)
+
+	var filename string
+	if flags.NArg() > 0 {
+		filename = flags.Arg(0)
+	} else {
+		var err error
+		if filename, err = utilities.BadgeFilename(); err != nil {
+			utilities.ReportErrorAndDie("bgurt badges", err)
+		}
+	}
+
+	bf, err := utilities.LoadBadgesFile(filename)
+	if err != nil {
+		utilities.ReportErrorAndDie("bgurt badges", err)
+	}
+
+	owned := len(bf.Owned())
+	fmt.Printf("%s: %d badges", filename, owned)
+	if disowned := len(bf.Badges) - owned; disowned > 0 {
+		fmt.Printf(" (and %d no longer owned)", disowned)
+	}
+	fmt.Printf(", format version %d", bf.Version)
+	if bf.Version < microbadge.BadgesFileVersion {
+		fmt.Printf(" (current is %d)", microbadge.BadgesFileVersion)
+	}
+	fmt.Println()
+	if bf.Username != "" {
+		fmt.Printf("  fetched for %s", bf.Username)
+	} else {
+		fmt.Printf("  fetched")
+	}
+	if !bf.Fetched.IsZero() {
+		fmt.Printf(" at %s", bf.Fetched.Local().Format("2006-01-02 15:04"))
+	}
+	fmt.Println()
+
+	if migrate && bf.Version < microbadge.BadgesFileVersion {
+		if err := utilities.SaveBadgesFile(filename, true, bf); err != nil {
+			utilities.ReportErrorAndDie("bgurt badges", err)
+		}
+		fmt.Printf("  migrated to version %d\n", microbadge.BadgesFileVersion)
+	}
+}
+
+// Local Variables:
+// compile-command: "go build"
+// End:
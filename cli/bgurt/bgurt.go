@@ -0,0 +1,97 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// The bgurt program gathers the tools that work on your whole profile, rather than
+// on one part of it like the av-, gb-, mb- and ot- programs, as subcommands:
+//
+//	bgurt badges [-migrate] [file]
+//	bgurt history [-n count] [kind ...]
+//	bgurt restore [-yes] [-dry-run] snapshot
+//	bgurt selftest [-record] [-dir directory]
+//	bgurt snapshot [-force] [file]
+//	bgurt stats
+//	bgurt theme [-themes file] [-date YYYY-MM-DD]
+//
+// Run "bgurt help" for the list of subcommands.
+//
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string)
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"badges", "describe (or migrate) a badges file", badgesCommand},
+		{"history", "show what the randomizers have chosen lately", historyCommand},
+		{"restore", "put your profile back the way it was in a snapshot", restoreCommand},
+		{"selftest", "check that the scrapers still understand BGG's pages", selftestCommand},
+		{"snapshot", "save your avatar, geekbadge, overtext and microbadges", snapshotCommand},
+		{"stats", "print the figures on your profile page as JSON", statsCommand},
+		{"theme", "show which theme applies on a day", themeCommand},
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: bgurt <command> [arguments]")
+	fmt.Fprintln(os.Stderr, "\nThe commands are:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(os.Stderr, "\nRun \"bgurt <command> -h\" for a command's options.")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	name := os.Args[1]
+	for _, c := range commands {
+		if c.name == name {
+			c.run(os.Args[2:])
+			return
+		}
+	}
+
+	if name == "help" || name == "-h" || name == "-help" || name == "--help" {
+		usage()
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "bgurt: unknown command '%s'\n", name)
+	usage()
+	os.Exit(2)
+}
+
+// Local Variables:
+// compile-command: "go build"
+// End:
@@ -0,0 +1,104 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/profburke/bgurt/cli/utilities"
+	"github.com/profburke/bgurt/history"
+)
+
+// historyCommand shows the latest runs recorded in the randomizers' rotation
+// history, for the kinds named (by default all of them), newest first, with the
+// seeds that repeat them.
+//
+func historyCommand(args []string) {
+	var count int
+	var dir string
+
+	defaultDir, _ := utilities.HistoryDir()
+
+	flags := flag.NewFlagSet("history", flag.ExitOnError)
+	flags.IntVar(&count, "n", 10, "show at most `n` runs of each kind")
+	flags.StringVar(&dir, "dir", defaultDir, "directory holding the history")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: bgurt history [-n count] [%s ...]\n", strings.Join(history.Kinds, "|"))
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	kinds := flags.Args()
+	if len(kinds) == 0 {
+		kinds = history.Kinds
+	}
+	for _, kind := range kinds {
+		if !isKind(kind) {
+			utilities.PrintErrorAndDie(fmt.Sprintf("bgurt history: unknown kind '%s' (must be one of %s)",
+				kind, strings.Join(history.Kinds, ", ")))
+		}
+	}
+
+	store, err := history.NewFileStore(dir)
+	if err != nil {
+		utilities.ReportErrorAndDie("bgurt history", err)
+	}
+
+	for i, kind := range kinds {
+		h, err := store.Load(context.Background(), kind)
+		if err != nil {
+			utilities.ReportErrorAndDie("bgurt history", err)
+		}
+
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%s: %d runs recorded, %d items shown this cycle\n", kind, len(h.Entries), len(h.Cycle))
+		for j := len(h.Entries) - 1; j >= 0 && j >= len(h.Entries)-count; j-- {
+			entry := h.Entries[j]
+			fmt.Printf("  %s  %s", entry.Time.Local().Format("2006-01-02 15:04"), strings.Join(entry.Items, ", "))
+			if entry.Seed != 0 {
+				fmt.Printf("  (seed %d, time %s)", entry.Seed, entry.Time.Format(time.RFC3339))
+			}
+			fmt.Println()
+		}
+	}
+}
+
+func isKind(kind string) bool {
+	for _, k := range history.Kinds {
+		if k == kind {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Local Variables:
+// compile-command: "go build"
+// End:
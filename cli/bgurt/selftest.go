@@ -0,0 +1,76 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/profburke/bgurt/cli/utilities"
+	"github.com/profburke/bgurt/selftest"
+)
+
+// selftestCommand runs each scraper once against BGG and reports which ones worked.
+// With -record, it also saves the conversation and the results as the fixtures
+// replayed by the selftest package's tests. Recording only reads from your profile.
+//
+func selftestCommand(args []string) {
+	var record bool
+	var dir string
+
+	flags := flag.NewFlagSet("selftest", flag.ExitOnError)
+	flags.BoolVar(&record, "record", false, "save the responses and results as test fixtures")
+	flags.StringVar(&dir, "dir", "selftest/testdata", "directory for the fixtures")
+	flags.Parse(args)
+
+	ctx, stop := utilities.InterruptContext()
+	defer stop()
+
+	var results selftest.Results
+	var err error
+	if record {
+		results, err = selftest.Record(ctx, utilities.LoadCredentials(), dir, utilities.SiteOptions()...)
+	} else {
+		results, err = selftest.Run(ctx, utilities.NewClient())
+	}
+
+	for _, step := range selftest.Steps {
+		if failure, ok := results.Failures[step]; ok {
+			fmt.Printf("%-16s FAILED: %s\n", step, failure)
+		} else {
+			fmt.Printf("%-16s ok\n", step)
+		}
+	}
+
+	if err != nil {
+		utilities.ReportErrorAndDie("bgurt selftest", err)
+	}
+
+	if record {
+		fmt.Fprintf(os.Stderr, "fixtures written to %s; review them with git diff before committing\n", dir)
+	}
+}
+
+// Local Variables:
+// compile-command: "go build"
+// End:
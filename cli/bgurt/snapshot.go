@@ -0,0 +1,221 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/profburke/bgurt/bggclient"
+	"github.com/profburke/bgurt/cli/utilities"
+	"github.com/profburke/bgurt/snapshot"
+)
+
+// snapshotCommand saves your avatar, geekbadge, overtext and displayed microbadges
+// in one archive, by default named after the time in the snapshots directory of the
+// configuration directory.
+//
+func snapshotCommand(args []string) {
+	var force bool
+
+	flags := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	flags.BoolVar(&force, "force", false, "overwrite the file if it exists")
+	flags.BoolVar(&force, "f", false, "overwrite the file if it exists (shorthand)")
+	flags.Parse(args)
+
+	ctx, stop := utilities.InterruptContext()
+	defer stop()
+
+	s, err := take(ctx, utilities.NewClient())
+	if err != nil {
+		utilities.ReportErrorAndDie("bgurt snapshot", err)
+	}
+
+	filename := flags.Arg(0)
+	if filename, err = saveSnapshot(filename, force, s); err != nil {
+		utilities.ReportErrorAndDie("bgurt snapshot", err)
+	}
+	fmt.Printf("saved snapshot to %s\n", filename)
+}
+
+// restoreCommand shows how your profile differs from a snapshot and, once you
+// agree, puts back the parts that differ. The profile as it was is saved as a
+// snapshot first, so a restore can itself be undone.
+//
+func restoreCommand(args []string) {
+	var yes, dryRun bool
+
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	flags.BoolVar(&yes, "yes", false, "restore without asking")
+	flags.BoolVar(&yes, "y", false, "restore without asking (shorthand)")
+	flags.BoolVar(&dryRun, "dry-run", false, "only show what would change")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: bgurt restore [options] <snapshot>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	target, err := loadSnapshot(flags.Arg(0))
+	if err != nil {
+		utilities.ReportErrorAndDie("bgurt restore", err)
+	}
+
+	ctx, stop := utilities.InterruptContext()
+	defer stop()
+
+	client := utilities.NewClient()
+	current, err := take(ctx, client)
+	if err != nil {
+		utilities.ReportErrorAndDie("bgurt restore", err)
+	}
+	if target.Username != "" && current.Username != "" && target.Username != current.Username {
+		utilities.PrintErrorAndDie(fmt.Sprintf("bgurt restore: the snapshot is of %s's profile, not %s's",
+			target.Username, current.Username))
+	}
+
+	differences := snapshot.Diff(current, target)
+	if len(differences) == 0 {
+		fmt.Println("your profile already matches the snapshot")
+		return
+	}
+	fmt.Printf("restoring the snapshot taken %s would change:\n", target.Taken.Local().Format("2006-01-02 15:04"))
+	for _, d := range differences {
+		fmt.Printf("  %v\n", d)
+	}
+
+	if dryRun || (!yes && !confirm("restore?")) {
+		return
+	}
+
+	backup, err := saveSnapshot("", false, current)
+	if err != nil {
+		utilities.ReportErrorAndDie("bgurt restore", err)
+	}
+	fmt.Printf("saved your profile as it was to %s\n", backup)
+
+	if err := snapshot.RestoreContext(ctx, client, target, changedParts(differences)); err != nil {
+		utilities.ReportErrorAndDie("bgurt restore", err)
+	}
+	fmt.Println("restored")
+}
+
+// take snapshots the profile of the user in the configuration.
+//
+func take(ctx context.Context, client *bggclient.Client) (*snapshot.Snapshot, error) {
+	s, err := snapshot.TakeContext(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	s.Username = utilities.LoadCredentials().Username
+
+	return s, nil
+}
+
+// changedParts lists, in restore order, the parts of the profile in differences.
+//
+func changedParts(differences []snapshot.Difference) (parts []snapshot.Part) {
+	for _, part := range snapshot.Parts {
+		for _, d := range differences {
+			if d.Part == part {
+				parts = append(parts, part)
+				break
+			}
+		}
+	}
+
+	return parts
+}
+
+// confirm asks a yes or no question on the terminal; anything but yes is no.
+//
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+
+	return answer == "y" || answer == "yes"
+}
+
+// saveSnapshot writes s to filename or, if it is empty, to a file named after the
+// time it was taken in the snapshots directory. It returns the name used.
+//
+func saveSnapshot(filename string, force bool, s *snapshot.Snapshot) (string, error) {
+	if filename == "" {
+		dir, err := utilities.SnapshotDir()
+		if err != nil {
+			return "", err
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", err
+		}
+		filename = filepath.Join(dir, s.Taken.Local().Format("2006-01-02-150405")+".zip")
+	}
+
+	if !force && utilities.FileExists(filename) {
+		return "", fmt.Errorf("'%s' exists", filename)
+	}
+
+	data, err := s.Encode()
+	if err != nil {
+		return "", err
+	}
+
+	return filename, ioutil.WriteFile(filename, data, 0644)
+}
+
+// loadSnapshot reads a snapshot from filename or, failing that, from the file of
+// that name in the snapshots directory.
+//
+func loadSnapshot(filename string) (*snapshot.Snapshot, error) {
+	if !utilities.FileExists(filename) && filepath.Base(filename) == filename {
+		if dir, err := utilities.SnapshotDir(); err == nil && utilities.FileExists(filepath.Join(dir, filename)) {
+			filename = filepath.Join(dir, filename)
+		}
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := snapshot.Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+
+	return s, nil
+}
+
+// Local Variables:
+// compile-command: "go build"
+// End:
@@ -0,0 +1,83 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/profburke/bgurt/cli/utilities"
+)
+
+// themeCommand says which theme applies on a day (by default today), so that a
+// themes file can be checked before the day comes.
+//
+func themeCommand(args []string) {
+	var filename, day string
+
+	flags := flag.NewFlagSet("theme", flag.ExitOnError)
+	flags.StringVar(&filename, "themes", "", "themes `file` (by default themes.toml in the configuration directory)")
+	flags.StringVar(&day, "date", "", "the `day` to check, as YYYY-MM-DD (by default today)")
+	flags.Parse(args)
+
+	when := time.Now()
+	if day != "" {
+		var err error
+		when, err = time.ParseInLocation("2006-01-02", day, time.Local)
+		if err != nil {
+			utilities.PrintErrorAndDie(fmt.Sprintf("bgurt theme: bad date %q (must be YYYY-MM-DD)", day))
+		}
+		// noon, so the day is the same in the schedule's time zone
+		when = when.Add(12 * time.Hour)
+	}
+
+	s := utilities.LoadSchedule("bgurt theme", filename)
+	if s == nil {
+		utilities.PrintErrorAndDie("bgurt theme: no themes file")
+	}
+
+	theme := s.Active(when)
+	if theme == nil {
+		fmt.Println("no theme applies")
+		return
+	}
+
+	fmt.Printf("theme %s applies\n", theme.Name)
+	for _, source := range []struct{ name, value string }{
+		{"microbadges", fmt.Sprint(theme.Microbadges)},
+		{"constraints", theme.Constraints},
+		{"geekbadges", theme.Geekbadges},
+		{"avatars", theme.Avatars},
+		{"overtext", theme.Overtext},
+		{"left words", fmt.Sprint(theme.LeftWords)},
+		{"right words", fmt.Sprint(theme.RightWords)},
+	} {
+		if source.value != "" && source.value != "[]" {
+			fmt.Printf("  %-12s %s\n", source.name, source.value)
+		}
+	}
+}
+
+// Local Variables:
+// compile-command: "go build"
+// End:
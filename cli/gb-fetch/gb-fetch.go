@@ -48,17 +48,18 @@ func main() {
 
 	flag.Parse()
 
-	utilities.SetCredentials()
+	client := utilities.NewClient()
+	ctx, stop := utilities.InterruptContext()
+	defer stop()
 
 	if verbose {
 		fmt.Println("fetching geekbadge...")
 	}
 
-	gb, err := geekbadge.Get()
+	gb, err := geekbadge.GetContext(ctx, client)
 
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		utilities.ReportErrorAndDie("gb-fetch", err)
 	}
 
 	var jsonData []byte
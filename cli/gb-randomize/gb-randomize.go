@@ -23,6 +23,19 @@
 // name of a directory containg several geekbadges (stored as JSON in individual files)  and
 // it will randomly set your geekbadge to one of them.
 //
+// It avoids the geekbadges used in the latest runs (by default just the last one; see the
+// no-repeat flag), or with the shuffle-bag flag uses every geekbadge once before repeating
+// any. The history is kept in the bgurt configuration directory; see "bgurt history".
+//
+// While a theme applies (see the schedule package) that names a geekbadge folder, that
+// folder is used instead of the one given, which may then be left out.
+//
+// Tags in the text of the chosen geekbadge's boxes, like [LF], are expanded before it
+// is set (see the parser package) unless the no-tags flag is set.
+//
+// With the dry-run flag, gb-randomize prints the geekbadge it would use and changes
+// nothing. Each run's random seed is kept in the history; the seed flag repeats it.
+//
 package main
 
 import (
@@ -30,14 +43,14 @@ import (
 	"flag"
 	"fmt"
 	"io/ioutil"
-	"math/rand"
 	"os"
 	"path/filepath"
 	"strings"
-	"time"
 
 	"github.com/profburke/bgurt/cli/utilities"
 	"github.com/profburke/bgurt/geekbadge"
+	"github.com/profburke/bgurt/history"
+	"github.com/profburke/bgurt/schedule"
 )
 
 func visit(files *[]string) filepath.WalkFunc {
@@ -64,18 +77,21 @@ func main() {
 
 	flag.BoolVar(&verbose, "verbose", false, "makes execution verbose")
 	flag.BoolVar(&verbose, "v", false, "makes execution verbose (shorthand)")
+	historySettings := utilities.HistoryFlags()
+	themeSettings := utilities.ThemeFlags()
+	randomSettings := utilities.RandomFlags()
+	templateSettings := utilities.TemplateFlags()
 
 	flag.Parse()
 
 	args := flag.Args()
 
-	if len(args) != 1 {
-		fmt.Fprintln(os.Stderr, "usage: gb-randomize <directoryname>")
+	path := themeSettings.Source("gb-randomize", args, randomSettings.Now(), func(th *schedule.Theme) string { return th.Geekbadges }, verbose)
+	if len(args) > 1 || path == "" {
+		fmt.Fprintln(os.Stderr, "usage: gb-randomize [options] <directoryname>")
 		os.Exit(1)
 	}
 
-	path := args[0]
-
 	if !utilities.DirectoryExists(path) {
 		fmt.Fprintf(os.Stderr, "'%s' does not exist.\n", path)
 		os.Exit(1)
@@ -92,8 +108,20 @@ func main() {
 		os.Exit(1)
 	}
 
-	rand.Seed(time.Now().Unix())
-	filename := files[rand.Intn(len(files))]
+	ctx, stop := utilities.InterruptContext()
+	defer stop()
+
+	// the history names files relative to the directory, so it survives moving it
+	names := make([]string, len(files))
+	for i, file := range files {
+		names[i], _ = filepath.Rel(path, file)
+	}
+	rotation := historySettings.Open(ctx, "gb-randomize", history.Geekbadge)
+	allowed := rotation.Filter(names, func(allowed []string) bool { return len(allowed) > 0 })
+
+	random := randomSettings.Rand()
+	name := allowed[random.Intn(len(allowed))]
+	filename := filepath.Join(path, name)
 	jsonData, err := ioutil.ReadFile(filename)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error reading file: %v\n", err)
@@ -107,15 +135,31 @@ func main() {
 		os.Exit(1)
 	}
 
-	utilities.SetCredentials()
+	gb, err = templateSettings.ExpandGeekbadge(ctx, gb)
+	if err != nil {
+		utilities.ReportErrorAndDie("gb-randomize", err)
+	}
+
+	if randomSettings.DryRun {
+		randomSettings.ReportPlan("gb-randomize", "set your geekbadge to "+filename,
+			struct {
+				File      string
+				Geekbadge geekbadge.Geekbadge
+			}{filename, gb})
+		return
+	}
+	randomSettings.ReportSeed("gb-randomize")
 
-	_, err = geekbadge.Set(gb)
+	client := utilities.NewClient()
+
+	_, err = geekbadge.SetContext(ctx, client, gb)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		utilities.ReportErrorAndDie("gb-randomize", err)
 	} else if verbose {
 		fmt.Println("geekbadge updated")
 	}
+
+	rotation.Record(ctx, randomSettings.Seed, randomSettings.Time, []string{name})
 }
 
 // Local Variables:
@@ -20,7 +20,8 @@
 // SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
 
 // The gb-set program is a command line tool to set the user's geekbadge (uberbadge).
-// The data is read from the specified file.
+// The data is read from the specified file. Tags in the text of its boxes, like [LF],
+// are expanded first (see the parser package) unless the no-tags flag is set.
 //
 package main
 
@@ -40,6 +41,7 @@ func main() {
 
 	flag.BoolVar(&verbose, "verbose", false, "makes execution verbose")
 	flag.BoolVar(&verbose, "v", false, "makes execution verbose (shorthand)")
+	templateSettings := utilities.TemplateFlags()
 
 	flag.Parse()
 
@@ -49,7 +51,9 @@ func main() {
 		os.Exit(1)
 	}
 
-	utilities.SetCredentials()
+	client := utilities.NewClient()
+	ctx, stop := utilities.InterruptContext()
+	defer stop()
 
 	jsonData, err := ioutil.ReadFile(args[0])
 	if err != nil {
@@ -64,10 +68,14 @@ func main() {
 		os.Exit(1)
 	}
 
-	_, err = geekbadge.Set(gb)
+	gb, err = templateSettings.ExpandGeekbadge(ctx, gb)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%v", err)
-		os.Exit(1)
+		utilities.ReportErrorAndDie("gb-set", err)
+	}
+
+	_, err = geekbadge.SetContext(ctx, client, gb)
+	if err != nil {
+		utilities.ReportErrorAndDie("gb-set", err)
 	} else if verbose {
 		fmt.Println("new geekbadge set")
 	}
@@ -19,65 +19,226 @@
 // TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
 // SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
 
-// The mb-fetch program is a command line tool to retrieve your microbadges. By defaut,
-// the data is written to standard out in JSON format. You can use a command line flag
-// to specify a file name instead.
+// The mb-fetch program is a command line tool to retrieve your microbadges. By default,
+// they are saved in the badges file in the bgurt configuration directory, where the other
+// microbadge tools look for them (see microbadge.BadgesFile for the format). You can use
+// a command line flag to specify a file name instead, or "-" for standard out. With the
+// slots flag, only the microbadges currently in your display slots are fetched (see also
+// mb-fetchslot), and written as a plain JSON array to standard out unless a file is named.
+//
+// Badge metadata is cached (under the user cache directory) so that later runs only
+// fetch the pages of new badges, plus those whose copy is older than the cache-ttl
+// flag, which are revalidated rather than downloaded again.
+//
+// When the output file already exists, the badges are merged into it rather than
+// replacing it (see microbadge.BadgesFile.Merge), and a summary of the changes is
+// printed. New badges are recorded as acquired now, and the others keep their
+// acquisition times (which the mb-randomize "recent" strategy uses) along with any
+// fields added to them by hand; badges no longer owned are kept, marked as such.
+// Set the merge flag to false to replace the file instead.
+//
+// With the images flag, each badge's image is also downloaded into the given
+// directory, and its path is recorded in the badge's ImageFilename.
 //
 package main
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"os"
+	"time"
 
 	"github.com/profburke/bgurt/cli/utilities"
 	"github.com/profburke/bgurt/microbadge"
 )
 
 func main() {
-	var verbose, force bool
-	var outputFilename string
+	var verbose, force, slotsOnly, merge bool
+	var outputFilename, imageDir string
+	var workers int
+	var noCache bool
+	var cacheTTL time.Duration
 
-	flag.BoolVar(&force, "force", false, "overwrite output file if it exists")
+	flag.BoolVar(&force, "force", false, "overwrite output file if it exists (and isn't merged)")
 	flag.BoolVar(&force, "f", false, "overwrite output file if it exists (shorthand)")
+	flag.BoolVar(&merge, "merge", true, "merge the badges into an existing output file")
 	flag.BoolVar(&verbose, "verbose", false, "makes execution verbose")
 	flag.BoolVar(&verbose, "v", false, "makes execution verbose (shorthand)")
-	flag.StringVar(&outputFilename, "output", "", "filename for output")
+	flag.StringVar(&outputFilename, "output", "", "filename for output, or - for standard out (by default the badges file in the configuration directory)")
 	flag.StringVar(&outputFilename, "o", "", "filename for output (shorthand)")
+	flag.BoolVar(&slotsOnly, "slots", false, "fetch just the microbadges in your display slots")
+	flag.IntVar(&workers, "workers", microbadge.DefaultWorkers, "number of badge pages to fetch at once")
+	flag.StringVar(&imageDir, "images", "", "download the badge images into this `directory`")
+	flag.BoolVar(&noCache, "no-cache", false, "fetch every badge page, ignoring the cache")
+	flag.DurationVar(&cacheTTL, "cache-ttl", 7*24*time.Hour, "how long cached badge metadata is used before being revalidated")
 
 	flag.Parse()
 
-	utilities.SetCredentials()
+	client := utilities.NewClient()
+	ctx, stop := utilities.InterruptContext()
+	defer stop()
 
 	if verbose {
 		fmt.Println("fetching microbadges...")
 	}
 
-	badges, err := microbadge.GetAll()
-	if err != nil {
-		log.Fatalf("mb-fetch: could not get microbadges: ", err)
+	var badges []microbadge.Microbadge
+	var err error
+	if slotsOnly {
+		badges, err = microbadge.GetSlotsContext(ctx, client)
+	} else {
+		options := []microbadge.FetchOption{microbadge.WithWorkers(workers)}
+		if !noCache {
+			options = append(options, microbadge.WithCache(openCache(cacheTTL, verbose)))
+		}
+		badges, err = microbadge.GetAllContext(ctx, client, options...)
+	}
+	var metadataErr *microbadge.MetadataError
+	if errors.As(err, &metadataErr) {
+		// the badges are still worth having; just say what is missing
+		for _, f := range metadataErr.Fields {
+			if f.Field == "page" {
+				fmt.Fprintf(os.Stderr, "mb-fetch: warning: could not fetch the page of badge# %d: %s\n", f.BadgeNumber, f.Problem)
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "mb-fetch: warning: could not parse %v\n", f)
+		}
+	} else if err != nil {
+		utilities.ReportErrorAndDie("mb-fetch", err)
 	}
 
-	if badges != nil {
-		var jsonData []byte
-		jsonData, err := json.Marshal(badges)
+	if imageDir != "" && badges != nil {
+		if verbose {
+			fmt.Println("fetching microbadge images...")
+		}
+
+		store, err := microbadge.NewImageStore(imageDir)
 		if err != nil {
-			log.Fatalf("mb-fetch: %v", err)
+			utilities.ReportErrorAndDie("mb-fetch", err)
 		}
-		if outputFilename != "" {
-			utilities.WriteToFile(outputFilename, "mb-fetch", force, jsonData)
-		} else {
-			fmt.Println(string(jsonData))
+
+		err = microbadge.FetchImagesContext(ctx, client, store, badges, microbadge.WithWorkers(workers))
+		if err != nil {
+			utilities.ReportErrorAndDie("mb-fetch", err)
 		}
-	} else {
+	}
+
+	if badges == nil {
 		if verbose {
 			// NOTE: no error, just no badges
 			fmt.Println("no badges")
 		}
+		return
+	}
+
+	if outputFilename == "-" || (slotsOnly && outputFilename == "") {
+		outputFilename = ""
+	} else if outputFilename == "" {
+		outputFilename, err = utilities.BadgeFilename()
+		if err != nil {
+			utilities.ReportErrorAndDie("mb-fetch", err)
+		}
+		// mb-fetch owns the default file, so always replaces it
+		force = true
+	}
+
+	if slotsOnly {
+		// the slots are not a badges file (empty slots have no badge), so they
+		// are written as they are
+		writeJSON(outputFilename, force, badges)
+		return
+	}
+
+	bf := microbadge.NewBadgesFile(utilities.LoadCredentials().Username, badges)
+	if merge && outputFilename != "" && utilities.FileExists(outputFilename) {
+		bf = mergeInto(outputFilename, bf)
+		// merging keeps everything that was in the file
+		force = true
+	}
+
+	if outputFilename == "" {
+		writeJSON("", force, bf)
+		return
+	}
+
+	if err := utilities.SaveBadgesFile(outputFilename, force, bf); err != nil {
+		utilities.PrintErrorAndDie(fmt.Sprintf("mb-fetch: %v", err))
+	}
+	if verbose {
+		fmt.Printf("%d badges saved to %s\n", len(badges), outputFilename)
 	}
 }
 
+// writeJSON writes data as JSON to filename or, if it is empty, standard out.
+//
+func writeJSON(filename string, force bool, data interface{}) {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		log.Fatalf("mb-fetch: %v", err)
+	}
+	if filename != "" {
+		utilities.WriteToFile(filename, "mb-fetch", force, jsonData)
+	} else {
+		fmt.Println(string(jsonData))
+	}
+}
+
+// mergeInto merges the badges in bf into those saved in filename, prints what
+// changed and returns the result.
+//
+func mergeInto(filename string, bf *microbadge.BadgesFile) *microbadge.BadgesFile {
+	previous, err := utilities.LoadBadgesFile(filename)
+	if err != nil {
+		utilities.PrintErrorAndDie(fmt.Sprintf("mb-fetch: %v (use -merge=false to replace it)", err))
+	}
+	if previous.Username != "" && bf.Username != "" && previous.Username != bf.Username {
+		utilities.PrintErrorAndDie(fmt.Sprintf("mb-fetch: %s holds %s's badges, not %s's (use -merge=false to replace it)",
+			filename, previous.Username, bf.Username))
+	}
+
+	changes := previous.Merge(bf.Badges, bf.Fetched)
+	if bf.Username != "" {
+		previous.Username = bf.Username
+	}
+
+	if changes.Empty() {
+		fmt.Println("no changes")
+		return previous
+	}
+	fmt.Printf("%d new, %d no longer owned, %d updated\n",
+		len(changes.Added), len(changes.Disowned), len(changes.Updated))
+	for _, mb := range changes.Added {
+		fmt.Printf("  + #%d %s\n", mb.BadgeNumber, mb.Name)
+	}
+	for _, mb := range changes.Disowned {
+		fmt.Printf("  - #%d %s\n", mb.BadgeNumber, mb.Name)
+	}
+	for _, mb := range changes.Updated {
+		fmt.Printf("  ~ #%d %s\n", mb.BadgeNumber, mb.Name)
+	}
+
+	return previous
+}
+
+// openCache opens the badge metadata cache. The cache only saves time, so if it
+// can't be opened mb-fetch carries on without it.
+//
+func openCache(ttl time.Duration, verbose bool) *microbadge.Cache {
+	cache, err := utilities.OpenBadgeCache(ttl)
+	if err == nil {
+		return cache
+	}
+
+	if verbose {
+		fmt.Fprintf(os.Stderr, "mb-fetch: not using the cache: %v\n", err)
+	}
+
+	return nil
+}
+
 // Local Variables:
 // compile-command: "go build"
 // End:
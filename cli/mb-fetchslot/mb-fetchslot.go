@@ -1,9 +1,102 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// The mb-fetchslot program is a command line tool to show which microbadges are in
+// your display slots. Give a slot number as an argument to see just that slot;
+// otherwise all slots are shown. Output is plain text unless the json flag is given.
+//
 package main
 
-import "fmt"
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/profburke/bgurt/cli/utilities"
+	"github.com/profburke/bgurt/microbadge"
+)
 
 func main() {
-	fmt.Println("Not implemented yet. Will download your the microbadge for the given slot.")
+	var verbose, jsonOutput bool
+
+	flag.BoolVar(&verbose, "verbose", false, "makes execution verbose")
+	flag.BoolVar(&verbose, "v", false, "makes execution verbose (shorthand)")
+	flag.BoolVar(&jsonOutput, "json", false, "format output as JSON")
+
+	flag.Parse()
+
+	var slot uint
+	if flag.NArg() > 0 {
+		v, err := strconv.ParseUint(flag.Arg(0), 10, 64)
+		if err != nil || !microbadge.ValidSlot(uint(v)) {
+			fmt.Fprintf(os.Stderr, "mb-fetchslot: slot number must be between 1 and %d.\n",
+				microbadge.TotalSlots)
+			os.Exit(1)
+		}
+		slot = uint(v)
+	}
+
+	client := utilities.NewClient()
+	ctx, stop := utilities.InterruptContext()
+	defer stop()
+
+	if verbose {
+		fmt.Println("fetching microbadge slots...")
+	}
+
+	slots, err := microbadge.GetSlotsContext(ctx, client)
+	if err != nil {
+		utilities.ReportErrorAndDie("mb-fetchslot", err)
+	}
+
+	first, last := uint(1), uint(microbadge.TotalSlots)
+	if slot != 0 {
+		first, last = slot, slot
+	}
+
+	if jsonOutput {
+		var jsonData []byte
+		if slot != 0 {
+			jsonData, err = json.Marshal(slots[slot-1])
+		} else {
+			jsonData, err = json.Marshal(slots)
+		}
+		if err != nil {
+			log.Fatalf("mb-fetchslot: %v", err)
+		}
+		fmt.Println(string(jsonData))
+		return
+	}
+
+	for n := first; n <= last; n++ {
+		mb := slots[n-1]
+		if mb.BadgeNumber == 0 {
+			fmt.Printf("slot %d: (empty)\n", n)
+		} else {
+			fmt.Printf("slot %d: #%d %s\n", n, mb.BadgeNumber, mb.Name)
+		}
+	}
 }
 
 // Local Variables:
@@ -19,25 +19,45 @@
 // TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
 // SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
 
-// The mb-randomize program is a command line tool to set your microbadges randomly according
-// to constraints specified in XYZ. To build the XYZ file you should run the TUV tool.
+// The mb-randomize program is a command line tool to set your microbadges randomly. It
+// picks from the badges in a file written by mb-fetch (by default the badges file in the
+// bgurt configuration directory), obeying the constraints (pinned, forbidden and excluded
+// badges) in the constraints file: by default constraints.toml in the bgurt configuration
+// directory, if it exists. See the constraints package for the file format.
 //
-// TODO: more details
+// Badges can be given weights in the constraints file to make them more or less likely
+// to be chosen. The strategy flag picks a built in weighting: inverse-popularity favors
+// rare badges, using the number of owners mb-fetch records, and recent favors badges
+// mb-fetch has seen for the first time lately.
+//
+// Badges shown in the latest runs (by default just the last one; see the no-repeat flag)
+// are avoided when the constraints allow, and with the shuffle-bag flag every badge is
+// shown once before any is shown again. See "bgurt history".
+//
+// While a theme applies (see the schedule package), only the theme's microbadges are
+// picked from, and the theme's constraints file is used unless one is given.
+//
+// With the dry-run flag, mb-randomize prints the badges it would show and changes
+// nothing. Each run's random seed and time (which the theme is chosen and the recent
+// strategy weighs badges as of) are kept in the history; the seed and time flags
+// repeat them.
+//
+// With the check-constraints flag, mb-randomize only checks whether the constraints can be
+// satisfied with your badges, explaining which rules conflict if not, and changes nothing.
 //
 package main
 
 import (
-	"encoding/json"
 	"flag"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"math/rand"
 	"os"
-	"time"
+	"strings"
 
 	"github.com/profburke/bgurt/cli/utilities"
+	"github.com/profburke/bgurt/history"
 	"github.com/profburke/bgurt/microbadge"
+	"github.com/profburke/bgurt/microbadge/constraints"
 )
 
 func badgeIDs(badges []microbadge.Microbadge) (result []uint) {
@@ -48,69 +68,153 @@ func badgeIDs(badges []microbadge.Microbadge) (result []uint) {
 	return
 }
 
-// TODO: dedup this -- also implemented in aws/utilities
-
-func pick(original []microbadge.Microbadge, n int) (picked []microbadge.Microbadge) {
-	picked = make([]microbadge.Microbadge, len(original))
-	for i, value := range original {
-		picked[i] = value
+// loadConstraints reads the named constraints file. If no file was named, the
+// default one is used when it exists, and otherwise there are no constraints.
+//
+func loadConstraints(filename string) (cd constraints.ConstraintsData) {
+	if filename == "" {
+		defaultFilename, err := utilities.ConstraintsFilename()
+		if err != nil || !utilities.FileExists(defaultFilename) {
+			return constraints.ConstraintsData{}
+		}
+		filename = defaultFilename
 	}
 
-	const passes = 6
-	for j := 0; j < passes; j++ {
-		for i := 0; i < len(picked); i++ {
-			j := rand.Intn(len(picked))
-			picked[i], picked[j] = picked[j], picked[i]
-		}
+	cd, err := constraints.LoadConstraintsData(filename)
+	if err != nil {
+		utilities.PrintErrorAndDie(fmt.Sprintf("mb-randomize: %v", err))
 	}
 
-	return picked[0:n]
+	return
 }
 
-// TODO: try to read in badges from $CONFIG_DIR/badges.json
-//       if it doesn't exist, download them and then proceed
-//       overridden by filename on command line?
+// checkConstraints reports how many badges each slot may show and whether the
+// constraints can be satisfied, exiting with status 1 if not.
+//
+func checkConstraints(c constraints.Constraints, badges []microbadge.Microbadge) {
+	for slot := uint(1); slot <= microbadge.TotalSlots; slot++ {
+		fmt.Printf("slot %d: %d badges allowed\n", slot, len(c.Allowed(badges, slot)))
+	}
+
+	err := c.Check(badges)
+	if err == nil {
+		fmt.Println("the constraints can be satisfied")
+		return
+	}
+
+	conflict, ok := err.(*constraints.ConflictError)
+	if !ok {
+		utilities.PrintErrorAndDie(fmt.Sprintf("mb-randomize: %v", err))
+	}
+
+	fmt.Println("the constraints cannot be satisfied:")
+	fmt.Printf("  %s, because\n", conflict.Summary)
+	for _, reason := range conflict.Reasons {
+		fmt.Printf("    %s\n", reason)
+	}
+	os.Exit(1)
+}
 
 func main() {
-	var verbose bool
+	var verbose, checkOnly bool
+	var constraintsFilename, strategyName string
 
 	flag.BoolVar(&verbose, "verbose", false, "makes execution verbose")
 	flag.BoolVar(&verbose, "v", false, "makes execution verbose (shorthand)")
+	flag.StringVar(&constraintsFilename, "constraints", "", "constraints `file` (TOML or JSON)")
+	flag.StringVar(&strategyName, "strategy", "", "weighting `strategy`: uniform, inverse-popularity or recent (overrides the constraints file)")
+	historySettings := utilities.HistoryFlags()
+	themeSettings := utilities.ThemeFlags()
+	randomSettings := utilities.RandomFlags()
+	flag.BoolVar(&checkOnly, "check-constraints", false, "check that the constraints can be satisfied, without changing anything")
 
 	flag.Parse()
 
-	// 2. get filename from command line and read it in as allBadges
+	// get the badges file from the command line, or use the default one
 	args := flag.Args()
-	if len(args) != 1 {
-		log.Println("usage: mb-randomize <filename>")
+	if len(args) > 1 {
+		log.Println("usage: mb-randomize [options] [<filename>]")
 		os.Exit(1)
 	}
+	var badgesFilename string
+	if len(args) == 1 {
+		badgesFilename = args[0]
+	}
 
-	jsonData, err := ioutil.ReadFile(args[0])
+	allBadges, err := utilities.LoadBadges(badgesFilename)
 	if err != nil {
+		utilities.PrintErrorAndDie(fmt.Sprintf("mb-randomize: couldn't load badges (run mb-fetch first?): %v", err))
+	}
+
+	if theme := themeSettings.Active("mb-randomize", randomSettings.Now()); theme != nil {
+		if verbose {
+			fmt.Printf("using theme %s\n", theme.Name)
+		}
+		allBadges = theme.Badges(allBadges)
+		if len(allBadges) == 0 {
+			utilities.PrintErrorAndDie(fmt.Sprintf("mb-randomize: you have none of the microbadges of theme %s", theme.Name))
+		}
+		if constraintsFilename == "" {
+			constraintsFilename = theme.Constraints
+		}
 	}
 
-	var allBadges []microbadge.Microbadge
-	_ = json.Unmarshal(jsonData, &allBadges)
+	random := randomSettings.Rand()
+	options := []constraints.Option{constraints.WithRand(random), constraints.WithNow(randomSettings.Time)}
+	if strategyName != "" {
+		strategy, err := constraints.ParseStrategy(strategyName)
+		if err != nil {
+			utilities.PrintErrorAndDie(fmt.Sprintf("mb-randomize: %v", err))
+		}
+		options = append(options, constraints.WithStrategy(strategy))
+	}
 
-	utilities.SetCredentials()
+	c := constraints.New(loadConstraints(constraintsFilename), options...)
+
+	if checkOnly {
+		checkConstraints(c, allBadges)
+		return
+	}
 
-	rand.Seed(time.Now().UnixNano())
-	newBadges := pick(allBadges, microbadge.TotalSlots)
+	ctx, stop := utilities.InterruptContext()
+	defer stop()
+
+	rotation := historySettings.Open(ctx, "mb-randomize", history.Microbadges)
+	newBadges, err := rotation.PickMicrobadges(c, allBadges)
+	if err != nil {
+		utilities.PrintErrorAndDie(fmt.Sprintf("mb-randomize: %v", err))
+	}
 
 	badgeNumbers := badgeIDs(newBadges)
 
+	if randomSettings.DryRun {
+		described := make([]string, len(newBadges))
+		for i, mb := range newBadges {
+			described[i] = fmt.Sprintf("%d", mb.BadgeNumber)
+			if mb.Name != "" {
+				described[i] += " (" + mb.Name + ")"
+			}
+		}
+		randomSettings.ReportPlan("mb-randomize", "set your microbadges to "+strings.Join(described, ", "),
+			struct{ Microbadges []microbadge.Microbadge }{newBadges})
+		return
+	}
+	randomSettings.ReportSeed("mb-randomize")
+
+	client := utilities.NewClient()
+
 	if verbose {
 		fmt.Println("sending new badges to server")
 	}
 
-	_, err = microbadge.SetAll(badgeNumbers)
+	_, err = microbadge.SetAllContext(ctx, client, badgeNumbers)
 
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "mb-randomize: could not set badges: %v\n", err)
-		os.Exit(1)
+		utilities.ReportErrorAndDie("mb-randomize", err)
 	}
 
+	rotation.Record(ctx, randomSettings.Seed, randomSettings.Time, history.BadgeKeys(newBadges))
+
 	if verbose {
 		fmt.Printf("badges set")
 	}
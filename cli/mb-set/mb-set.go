@@ -63,13 +63,14 @@ func main() {
 		os.Exit(1)
 	}
 
-	utilities.SetCredentials()
+	client := utilities.NewClient()
+	ctx, stop := utilities.InterruptContext()
+	defer stop()
 	badgeNumbers := parseParameters(args)
 
-	_, err := microbadge.SetAll(badgeNumbers)
+	_, err := microbadge.SetAllContext(ctx, client, badgeNumbers)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "mb-set: %v\n", err)
-		os.Exit(1)
+		utilities.ReportErrorAndDie("mb-set", err)
 	}
 
 	if verbose {
@@ -44,7 +44,9 @@ func main() {
 
 	flag.Parse()
 
-	utilities.SetCredentials()
+	client := utilities.NewClient()
+	ctx, stop := utilities.InterruptContext()
+	defer stop()
 
 	if !microbadge.ValidSlot(slot) {
 		fmt.Fprintf(os.Stderr, "mb-setslot: slot number must be between 1 and %d.\n",
@@ -57,10 +59,9 @@ func main() {
 		os.Exit(1)
 	}
 
-	_, err := microbadge.SetSlot(slot, badgeNumber)
+	_, err := microbadge.SetSlotContext(ctx, client, slot, badgeNumber)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "mb-setslot: %v\n", err)
-		os.Exit(1)
+		utilities.ReportErrorAndDie("mb-setslot", err)
 	}
 
 	if verbose {
@@ -0,0 +1,95 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// The fakebgg program runs the fake BoardGameGeek site from bggclient/bggtest on a
+// local port so the other tools can be tried out without touching your real profile.
+// Point them at it by exporting the variables it prints. Optionally seed the fake
+// with the badges in a file written by mb-fetch.
+//
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/profburke/bgurt/bggclient/bggtest"
+	"github.com/profburke/bgurt/cli/utilities"
+)
+
+func main() {
+	var username, passhash, badgeFilename string
+
+	flag.StringVar(&username, "username", "bgurt", "username of the fake account")
+	flag.StringVar(&passhash, "passhash", "fakehash", "password hash of the fake account")
+	flag.StringVar(&badgeFilename, "badges", "", "seed the fake with the badges in this file (as written by mb-fetch)")
+
+	flag.Parse()
+
+	server := bggtest.NewServer()
+	defer server.Close()
+
+	user := bggtest.User{
+		Username: username,
+		PassHash: passhash,
+		Stats:    bggtest.Stats{GeekGold: 12.5, ThumbsGiven: 1200, ThumbsReceived: 345, Posts: 67},
+	}
+
+	if badgeFilename != "" {
+		badges, err := utilities.LoadBadges(badgeFilename)
+		if err != nil {
+			utilities.PrintErrorAndDie(fmt.Sprintf("fakebgg: couldn't load badges: %v", err))
+		}
+
+		for _, mb := range badges {
+			server.AddBadge(bggtest.Badge{
+				Number:         mb.BadgeNumber,
+				Name:           mb.Name,
+				Category:       bggtest.Group{Number: mb.Category.GroupNumber, Name: mb.Category.Name},
+				Subcategory:    bggtest.Group{Number: mb.Subcategory.GroupNumber, Name: mb.Subcategory.Name},
+				Subsubcategory: bggtest.Group{Number: mb.Subsubcategory.GroupNumber, Name: mb.Subsubcategory.Name},
+				NumberOfOwners: mb.NumberOfOwners,
+				Mouseover:      mb.Mouseover,
+				Creator:        mb.Creator,
+				Description:    mb.Description,
+				Related:        mb.RelatedBadges,
+			})
+			user.Badges = append(user.Badges, mb.BadgeNumber)
+		}
+	}
+
+	server.AddUser(user)
+
+	fmt.Printf("fake BGG listening at %s; to use it:\n\n", server.URL)
+	fmt.Printf("export BGGURL=%s\n", server.URL)
+	fmt.Printf("export BGGUSERNAME=%s\n", username)
+	fmt.Printf("export BGGPASSHASH=%s\n\n", passhash)
+	fmt.Println("press Ctrl-C to stop")
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	<-interrupt
+}
+
+// Local Variables:
+// compile-command: "go build"
+// End:
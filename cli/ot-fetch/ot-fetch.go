@@ -55,15 +55,17 @@ func main() {
 		os.Exit(1)
 	}
 
-	utilities.SetCredentials()
+	client := utilities.NewClient()
+	ctx, stop := utilities.InterruptContext()
+	defer stop()
 
 	if verbose {
 		fmt.Println("fetching overtext...")
 	}
 
-	overtext, err := overtext.Get()
+	overtext, err := overtext.GetContext(ctx, client)
 	if err != nil {
-		log.Fatalf("ot-fetch: %v.", err)
+		utilities.ReportErrorAndDie("ot-fetch", err)
 	}
 
 	if jsonOutput {
@@ -23,6 +23,20 @@
 // name of a file containg an array of overtext options (stored as JSON) and
 // it will randomly set your overtext.
 //
+// It avoids the options used in the latest runs (by default just the last one; see the
+// no-repeat flag), or with the shuffle-bag flag uses every option once before repeating
+// any. The history is kept in the bgurt configuration directory; see "bgurt history".
+//
+// While a theme applies (see the schedule package) that names an overtext file, that
+// file is used instead of the one given, which may then be left out.
+//
+// Tags in the chosen overtext, like [LF], are expanded before it is set (see the
+// parser package) unless the no-tags flag is set.
+//
+// With the dry-run flag, ot-randomize prints the overtext it would use and changes
+// nothing. Each run's random seed is kept in the history (and the log); the seed flag
+// repeats it.
+//
 package main
 
 import (
@@ -31,12 +45,13 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
-	"math/rand"
 	"os"
-	"time"
+	"strings"
 
 	"github.com/profburke/bgurt/cli/utilities"
+	"github.com/profburke/bgurt/history"
 	"github.com/profburke/bgurt/overtext"
+	"github.com/profburke/bgurt/schedule"
 )
 
 // TODO: add a flag to specify a log file
@@ -48,19 +63,21 @@ func main() {
 	flag.BoolVar(&verbose, "verbose", false, "makes execution verbose")
 	flag.BoolVar(&verbose, "v", false, "makes execution verbose (shorthand)")
 	flag.StringVar(&logfile, "log", "", "filename for log")
+	historySettings := utilities.HistoryFlags()
+	themeSettings := utilities.ThemeFlags()
+	randomSettings := utilities.RandomFlags()
+	templateSettings := utilities.TemplateFlags()
 
 	flag.Parse()
 
 	args := flag.Args()
 
-	if len(args) != 1 {
-		fmt.Fprintln(os.Stderr, "usage: ot-randomize <file>")
+	filename := themeSettings.Source("ot-randomize", args, randomSettings.Now(), func(th *schedule.Theme) string { return th.Overtext }, verbose)
+	if len(args) > 1 || filename == "" {
+		fmt.Fprintln(os.Stderr, "usage: ot-randomize [options] <file>")
 		os.Exit(1)
 	}
 
-	filename := args[0]
-
-	rand.Seed(time.Now().Unix())
 	jsonData, err := ioutil.ReadFile(filename)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error reading file: %v\n", err)
@@ -91,20 +108,52 @@ func main() {
 		os.Exit(1)
 	}
 
-	utilities.SetCredentials()
+	if len(options) == 0 {
+		fmt.Fprintf(os.Stderr, "ot-randomize: no overtext options in %s\n", filename)
+		os.Exit(1)
+	}
+
+	ctx, stop := utilities.InterruptContext()
+	defer stop()
+
+	// the history identifies each option by its JSON encoding
+	keys := make([]string, len(options))
+	byKey := make(map[string]overtext.Overtext)
+	for i, option := range options {
+		jsonOption, _ := json.Marshal(option)
+		keys[i] = string(jsonOption)
+		byKey[keys[i]] = option
+	}
+	rotation := historySettings.Open(ctx, "ot-randomize", history.Overtext)
+	allowed := rotation.Filter(keys, func(allowed []string) bool { return len(allowed) > 0 })
+
+	random := randomSettings.Rand()
+	key := allowed[random.Intn(len(allowed))]
+	option, err := templateSettings.ExpandOvertext(ctx, byKey[key])
+	if err != nil {
+		utilities.ReportErrorAndDie("ot-randomize", err)
+	}
 
-	option := options[rand.Intn(len(options))]
-	_, err = overtext.Set(option)
+	if randomSettings.DryRun {
+		randomSettings.ReportPlan("ot-randomize", "set your overtext to "+strings.ReplaceAll(option.String(), "\n", ", "), option)
+		return
+	}
+	randomSettings.ReportSeed("ot-randomize")
+
+	client := utilities.NewClient()
+
+	_, err = overtext.SetContext(ctx, client, option)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		utilities.ReportErrorAndDie("ot-randomize", err)
 	} else if verbose {
 		fmt.Println("overtext updated")
 	}
 
+	rotation.Record(ctx, randomSettings.Seed, randomSettings.Time, []string{key})
+
 	if len(logfile) > 0 {
-		logger.Printf("overtext set to avatar: %s badge: %s\n", *option.Avatar,
-			*option.Badge)
+		logger.Printf("overtext set to avatar: %s badge: %s (seed %d)\n", *option.Avatar,
+			*option.Badge, randomSettings.Seed)
 	}
 
 }
@@ -20,14 +20,14 @@
 // SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
 
 // The ot-set program is a command line tool to set your overtext. You can specify
-// which overtext to set (avatar, badge, or both).
+// which overtext to set (avatar, badge, or both). Tags in the text, like [LF], are
+// expanded first (see the parser package) unless the no-tags flag is set.
 //
 package main
 
 import (
 	"flag"
 	"fmt"
-	"log"
 
 	"github.com/profburke/bgurt/cli/utilities"
 	"github.com/profburke/bgurt/overtext"
@@ -41,20 +41,28 @@ func main() {
 	flag.BoolVar(&verbose, "v", false, "makes execution verbose (shorthand)")
 	flag.StringVar(&avatarOvertext, "avatar", "", "specify avatar overtext")
 	flag.StringVar(&badgeOvertext, "badge", "", "specify badge overtext")
+	templateSettings := utilities.TemplateFlags()
 
 	flag.Parse()
 
-	utilities.SetCredentials()
+	client := utilities.NewClient()
+	ctx, stop := utilities.InterruptContext()
+	defer stop()
 
 	// if either avatarOvertext or badgeOvertext are empty,
 	// fetch them from server ,,, how do we then explicitly reset one of the text
 
-	_, err := overtext.Set(overtext.Overtext{
+	ot, err := templateSettings.ExpandOvertext(ctx, overtext.Overtext{
 		Avatar: &avatarOvertext,
 		Badge:  &badgeOvertext,
 	})
 	if err != nil {
-		log.Fatalf("ot-set: %v", err)
+		utilities.ReportErrorAndDie("ot-set", err)
+	}
+
+	_, err = overtext.SetContext(ctx, client, ot)
+	if err != nil {
+		utilities.ReportErrorAndDie("ot-set", err)
 	}
 
 	if verbose {
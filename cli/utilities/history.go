@@ -0,0 +1,124 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utilities
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/profburke/bgurt/history"
+	"github.com/profburke/bgurt/microbadge"
+	"github.com/profburke/bgurt/microbadge/constraints"
+)
+
+// HistorySettings are the rotation history flags the randomizers share.
+//
+type HistorySettings struct {
+	Policy   history.Policy
+	Disabled bool
+}
+
+// HistoryFlags registers the no-repeat, shuffle-bag and no-history flags and
+// returns the settings they fill in.
+//
+func HistoryFlags() (settings *HistorySettings) {
+	settings = &HistorySettings{}
+	flag.IntVar(&settings.Policy.NoRepeat, "no-repeat", 1, "don't repeat anything shown in the last `n` runs (if possible)")
+	flag.BoolVar(&settings.Policy.ShuffleBag, "shuffle-bag", false, "show everything once before showing anything again")
+	flag.BoolVar(&settings.Disabled, "no-history", false, "neither use nor update the rotation history")
+
+	return
+}
+
+// Rotation is a randomizer's history, with the policy it follows.
+//
+type Rotation struct {
+	History *history.History
+
+	toolname string
+	policy   history.Policy
+	store    history.Store
+}
+
+// Open loads the history of kind. The history only improves the choice, so if it
+// can't be loaded the tool warns and carries on without it.
+//
+func (hs *HistorySettings) Open(ctx context.Context, toolname, kind string) (rotation *Rotation) {
+	rotation = &Rotation{History: &history.History{Kind: kind}, toolname: toolname}
+	if hs.Disabled {
+		return
+	}
+
+	dir, err := HistoryDir()
+	if err == nil {
+		var store *history.FileStore
+		store, err = history.NewFileStore(dir)
+		if err == nil {
+			var h *history.History
+			h, err = store.Load(ctx, kind)
+			if err == nil {
+				rotation.History = h
+				rotation.policy = hs.Policy
+				rotation.store = store
+				return
+			}
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "%s: warning: not using the rotation history: %v\n", toolname, err)
+
+	return
+}
+
+// Filter returns the items the policy allows; see history.History.Filter.
+//
+func (r *Rotation) Filter(items []string, ok func(allowed []string) bool) []string {
+	return r.History.Filter(items, r.policy, ok)
+}
+
+// PickMicrobadges chooses badges obeying c and, where it can, the policy; see
+// history.History.PickMicrobadges.
+//
+func (r *Rotation) PickMicrobadges(c constraints.Constraints, badges []microbadge.Microbadge) ([]microbadge.Microbadge, error) {
+	return r.History.PickMicrobadges(c, badges, r.policy)
+}
+
+// Record adds the items shown, chosen with seed as of time at, to the history and
+// saves it, warning if it can't.
+//
+func (r *Rotation) Record(ctx context.Context, seed int64, at time.Time, items []string) {
+	if r.store == nil {
+		return
+	}
+
+	r.History.Record(history.Entry{Time: at, Seed: seed, Items: items}, r.policy)
+	if err := r.store.Save(ctx, r.History); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: warning: could not save the rotation history: %v\n", r.toolname, err)
+	}
+}
+
+// Local Variables:
+// compile-command: "go build"
+// End:
@@ -0,0 +1,138 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utilities
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"time"
+)
+
+// RandomSettings are the seed, time, dry-run and json flags the randomizers share.
+// Time is the moment choices that depend on the time (how recently a badge was
+// acquired, say) are made as of.
+//
+type RandomSettings struct {
+	Seed   int64
+	Time   time.Time
+	DryRun bool
+	JSON   bool
+}
+
+// RandomFlags registers the seed, time, dry-run and json flags and returns the
+// settings they fill in.
+//
+func RandomFlags() (settings *RandomSettings) {
+	settings = &RandomSettings{}
+	flag.Int64Var(&settings.Seed, "seed", 0, "make the random choices with this `seed` (by default a new one each run)")
+	flag.Var((*timeValue)(&settings.Time), "time", "make time-dependent choices as of this `time` (RFC 3339; by default now)")
+	flag.BoolVar(&settings.DryRun, "dry-run", false, "print what would be chosen, without changing anything")
+	flag.BoolVar(&settings.JSON, "json", false, "with dry-run, print the choice as JSON")
+
+	return
+}
+
+// Now returns the time this run's choices are made as of: the time flag's or,
+// without one, the current time (to the second), stored in Time so that it can be
+// reported. Themes are looked up at this time too.
+//
+func (rs *RandomSettings) Now() time.Time {
+	if rs.Time.IsZero() {
+		rs.Time = time.Now().Truncate(time.Second)
+	}
+
+	return rs.Time
+}
+
+// Rand returns the source of this run's random choices. Without a seed flag a new
+// seed is chosen, and stored in Seed so that it can be reported; the same seed and
+// time (see Now) with the same inputs (and rotation history) make the same choices.
+//
+func (rs *RandomSettings) Rand() *rand.Rand {
+	if rs.Seed == 0 {
+		rs.Seed = time.Now().UnixNano()
+	}
+	rs.Now()
+
+	return rand.New(rand.NewSource(rs.Seed))
+}
+
+// Plan is what a dry run prints with the json flag.
+//
+type Plan struct {
+	Tool   string      `json:"tool"`
+	Seed   int64       `json:"seed"`
+	Time   time.Time   `json:"time"`
+	Change interface{} `json:"change"`
+}
+
+// ReportPlan prints the change a dry run would have made: description, or with the
+// json flag change as JSON.
+//
+func (rs *RandomSettings) ReportPlan(toolname, description string, change interface{}) {
+	if !rs.JSON {
+		fmt.Printf("%s would %s (seed %d, time %s)\n", toolname, description, rs.Seed, rs.Time.Format(time.RFC3339))
+		return
+	}
+
+	jsonData, err := json.MarshalIndent(Plan{Tool: toolname, Seed: rs.Seed, Time: rs.Time, Change: change}, "", "  ")
+	if err != nil {
+		log.Fatalf("%s: %v", toolname, err)
+	}
+	fmt.Println(string(jsonData))
+}
+
+// ReportSeed says which seed and time a real run used, on standard error, so that
+// the run can be repeated with the seed and time flags. Every real run reports
+// them, verbose or not.
+//
+func (rs *RandomSettings) ReportSeed(toolname string) {
+	fmt.Fprintf(os.Stderr, "%s: seed %d, time %s\n", toolname, rs.Seed, rs.Time.Format(time.RFC3339))
+}
+
+// timeValue is a flag.Value holding a time written as in RFC 3339.
+//
+type timeValue time.Time
+
+func (tv *timeValue) String() string {
+	if tv == nil || time.Time(*tv).IsZero() {
+		return ""
+	}
+	return time.Time(*tv).Format(time.RFC3339)
+}
+
+func (tv *timeValue) Set(s string) error {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return err
+	}
+	*tv = timeValue(t)
+	return nil
+}
+
+// Local Variables:
+// compile-command: "go build"
+// End:
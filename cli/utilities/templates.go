@@ -0,0 +1,287 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utilities
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/profburke/bgurt/avatar"
+	"github.com/profburke/bgurt/bggclient"
+	"github.com/profburke/bgurt/bggclient/xmlapi2"
+	"github.com/profburke/bgurt/countdown"
+	"github.com/profburke/bgurt/geekbadge"
+	"github.com/profburke/bgurt/microbadge"
+	"github.com/profburke/bgurt/overtext"
+	"github.com/profburke/bgurt/parser"
+	"github.com/profburke/bgurt/profile"
+)
+
+// TemplateSettings is the no-tags flag shared by the tools that set overtext and
+// geekbadges, which otherwise expand the tags in the text they set (see the parser
+// package).
+//
+type TemplateSettings struct {
+	NoTags bool
+
+	engine *parser.Engine
+}
+
+// TemplateFlags registers the no-tags flag and returns the settings it fills in.
+//
+func TemplateFlags() (settings *TemplateSettings) {
+	settings = &TemplateSettings{}
+	flag.BoolVar(&settings.NoTags, "no-tags", false, "set the text as it is, without expanding tags like [LF]")
+
+	return
+}
+
+// TemplateEngine returns an engine that expands all the tags bgurt knows, looking
+// up username's data with client and counting down to the events in countdowns.
+// The tags that need BGG only call client and username, at most once each, when
+// one of them is first expanded, so templates without them need no credentials.
+//
+func TemplateEngine(client func() *bggclient.Client, username func() string, countdowns countdown.Config, options ...parser.Option) *parser.Engine {
+	var once sync.Once
+	var c *bggclient.Client
+	var name string
+	login := func() (*bggclient.Client, string) {
+		once.Do(func() { c, name = client(), username() })
+		return c, name
+	}
+
+	options = append([]parser.Option{
+		lazily(login, func(client *bggclient.Client, username string) parser.Provider {
+			return xmlapi2.NewProvider(client, username)
+		}),
+		lazily(login, func(client *bggclient.Client, username string) parser.Provider {
+			return profile.NewProvider(client)
+		}),
+		lazily(login, func(client *bggclient.Client, username string) parser.Provider {
+			return microbadge.NewProvider(client, nil, badgeCacheOption())
+		}),
+		parser.WithProvider(countdown.NewProvider(countdowns)),
+	}, options...)
+
+	return parser.New(options...)
+}
+
+// tags is a parser.Provider made of its tags.
+//
+type tags map[string]parser.Func
+
+func (t tags) Tags() map[string]parser.Func {
+	return t
+}
+
+// lazily adds the tags of the provider newProvider makes, only making it (and
+// calling login) when one of them is first expanded. The names of the tags come
+// from a provider made with no client, which the providers allow.
+//
+func lazily(login func() (*bggclient.Client, string), newProvider func(client *bggclient.Client, username string) parser.Provider) parser.Option {
+	var once sync.Once
+	var provided map[string]parser.Func
+	load := func() {
+		once.Do(func() { provided = newProvider(login()).Tags() })
+	}
+
+	lazy := make(tags)
+	for name := range newProvider(nil, "").Tags() {
+		name := name
+		lazy[name] = func(ctx context.Context, tag parser.Tag) (string, error) {
+			load()
+			return provided[name](ctx, tag)
+		}
+	}
+
+	return parser.WithProvider(lazy)
+}
+
+// badgeCacheTTL is how long the microbadge tags use cached badge metadata, the
+// same as mb-fetch by default.
+//
+const badgeCacheTTL = 7 * 24 * time.Hour
+
+// badgeCacheOption returns the option to fetch badges through the metadata cache.
+// The cache only saves requests, so without one the badges are simply fetched.
+//
+func badgeCacheOption() microbadge.FetchOption {
+	cache, _ := OpenBadgeCache(badgeCacheTTL)
+
+	return microbadge.WithCache(cache)
+}
+
+// LoadCountdowns reads the [countdown] table of the configuration file, which is
+// empty if there is no file.
+//
+func LoadCountdowns() (countdown.Config, error) {
+	var config struct {
+		Countdown countdown.Config `toml:"countdown"`
+	}
+
+	cfile, err := ConfigFilename()
+	if err != nil {
+		return config.Countdown, err
+	}
+	if _, err = toml.DecodeFile(cfile, &config); err != nil && !os.IsNotExist(err) {
+		return config.Countdown, fmt.Errorf("%s: %v", cfile, err)
+	}
+	if err = config.Countdown.Check(); err != nil {
+		return config.Countdown, fmt.Errorf("%s: %v", cfile, err)
+	}
+
+	return config.Countdown, nil
+}
+
+// Expand expands the tags in text, unless the no-tags flag is set.
+//
+func (ts *TemplateSettings) Expand(ctx context.Context, text string) (string, error) {
+	// text without tags needs no engine
+	if ts.NoTags || !strings.Contains(text, "[") {
+		return text, nil
+	}
+	if ts.engine == nil {
+		countdowns, err := LoadCountdowns()
+		if err != nil {
+			return text, err
+		}
+		username := func() string { return LoadCredentials().Username }
+		ts.engine = TemplateEngine(NewClient, username, countdowns, parser.WithUnknown(func(text string, pos int) {
+			if text == "[" {
+				fmt.Fprintf(os.Stderr, "warning: the [ at offset %d doesn't start a tag, so it is left as written\n", pos)
+				return
+			}
+			fmt.Fprintf(os.Stderr, "warning: %s is not a tag bgurt knows, so it is left as written\n", text)
+		}))
+	}
+
+	return ts.engine.Expand(ctx, text)
+}
+
+// ExpandOvertext expands the tags in both overtexts.
+//
+func (ts *TemplateSettings) ExpandOvertext(ctx context.Context, ot overtext.Overtext) (expanded overtext.Overtext, err error) {
+	expand := func(text *string) (*string, error) {
+		if text == nil {
+			return nil, nil
+		}
+		result, err := ts.Expand(ctx, *text)
+		return &result, err
+	}
+
+	if expanded.Avatar, err = expand(ot.Avatar); err != nil {
+		return ot, err
+	}
+	if expanded.Badge, err = expand(ot.Badge); err != nil {
+		return ot, err
+	}
+
+	return expanded, nil
+}
+
+// ExpandGeekbadge expands the tags in the text of both of the geekbadge's boxes.
+//
+func (ts *TemplateSettings) ExpandGeekbadge(ctx context.Context, gb geekbadge.Geekbadge) (expanded geekbadge.Geekbadge, err error) {
+	expanded = gb
+	if expanded.LeftBox.Text, err = ts.Expand(ctx, gb.LeftBox.Text); err != nil {
+		return gb, err
+	}
+	if expanded.RightBox.Text, err = ts.Expand(ctx, gb.RightBox.Text); err != nil {
+		return gb, err
+	}
+
+	return expanded, nil
+}
+
+// OverlaySettings is the overlay flag of the tools that set the avatar: text whose
+// [MBI1234] tags name the microbadges to draw over the avatar image.
+//
+type OverlaySettings struct {
+	Overlay string
+}
+
+// OverlayFlags registers the overlay flag and returns the settings it fills in.
+//
+func OverlayFlags() (settings *OverlaySettings) {
+	settings = &OverlaySettings{}
+	flag.StringVar(&settings.Overlay, "overlay", "", "draw the microbadges named by [MBI1234] tags in this `text` over the avatar")
+
+	return
+}
+
+// Apply draws the overlay's badges over the avatar image in filename and returns
+// the name of a temporary PNG file holding the result, which the caller should
+// remove. Without an overlay it returns filename itself.
+//
+func (ols *OverlaySettings) Apply(ctx context.Context, client *bggclient.Client, filename string) (composed string, err error) {
+	if ols.Overlay == "" {
+		return filename, nil
+	}
+
+	store, err := OpenBadgeImageStore()
+	if err != nil {
+		return "", err
+	}
+	badges := microbadge.NewProvider(client, store, badgeCacheOption())
+	text, err := parser.New(parser.WithProvider(badges)).Expand(ctx, ols.Overlay)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(text) != "" {
+		return "", fmt.Errorf("an overlay can only hold [MBI1234] tags, not %q", strings.TrimSpace(text))
+	}
+
+	var badgeFilenames []string
+	for _, mb := range badges.Images() {
+		badgeFilenames = append(badgeFilenames, mb.ImageFilename)
+	}
+	data, err := avatar.ComposeFile(filename, badgeFilenames)
+	if err != nil {
+		return "", err
+	}
+
+	tmp, err := ioutil.TempFile("", "bgurt-avatar-*.png")
+	if err != nil {
+		return "", err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+
+	return tmp.Name(), nil
+}
+
+// Local Variables:
+// compile-command: "go build"
+// End:
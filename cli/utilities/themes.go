@@ -0,0 +1,103 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utilities
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/profburke/bgurt/schedule"
+)
+
+// ThemeSettings are the theme flags the randomizers share.
+//
+type ThemeSettings struct {
+	Filename string
+	Disabled bool
+}
+
+// ThemeFlags registers the themes and no-theme flags and returns the settings
+// they fill in.
+//
+func ThemeFlags() (settings *ThemeSettings) {
+	settings = &ThemeSettings{}
+	flag.StringVar(&settings.Filename, "themes", "", "themes `file` (by default themes.toml in the configuration directory, if it exists)")
+	flag.BoolVar(&settings.Disabled, "no-theme", false, "ignore the themes")
+
+	return
+}
+
+// LoadSchedule reads the named themes file or, if filename is empty, the default
+// one if it exists. With no file there are no themes, and a nil Schedule is
+// returned. A file that can't be read is fatal.
+//
+func LoadSchedule(toolname, filename string) (s *schedule.Schedule) {
+	if filename == "" {
+		defaultFilename, err := ThemesFilename()
+		if err != nil || !FileExists(defaultFilename) {
+			return nil
+		}
+		filename = defaultFilename
+	}
+
+	s, err := schedule.Load(filename)
+	if err != nil {
+		PrintErrorAndDie(fmt.Sprintf("%s: %v", toolname, err))
+	}
+
+	return s
+}
+
+// Active returns the theme that applies at time t (for a randomizer, the time its
+// choices are made as of; see RandomSettings.Now), or nil if none does.
+//
+func (ts *ThemeSettings) Active(toolname string, t time.Time) *schedule.Theme {
+	if ts.Disabled {
+		return nil
+	}
+
+	return LoadSchedule(toolname, ts.Filename).Active(t)
+}
+
+// Source returns where a randomizer should get its choices from: the source the
+// theme active at time t gives (as chosen by source), if any, and otherwise the
+// single command line argument. It returns "" if there is neither.
+//
+func (ts *ThemeSettings) Source(toolname string, args []string, t time.Time, source func(th *schedule.Theme) string, verbose bool) string {
+	if theme := ts.Active(toolname, t); theme != nil && source(theme) != "" {
+		if verbose {
+			fmt.Printf("using theme %s\n", theme.Name)
+		}
+		return source(theme)
+	}
+
+	if len(args) == 1 {
+		return args[0]
+	}
+
+	return ""
+}
+
+// Local Variables:
+// compile-command: "go build"
+// End:
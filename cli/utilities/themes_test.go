@@ -0,0 +1,71 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package utilities
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/profburke/bgurt/schedule"
+)
+
+const testThemes = `
+timezone = "UTC"
+
+[[theme]]
+name = "essen"
+from = "10-20"
+to = "10-27"
+avatars = "essen"
+`
+
+func TestThemeReplay(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "themes.toml")
+	if err := ioutil.WriteFile(filename, []byte(testThemes), 0600); err != nil {
+		t.Fatal(err)
+	}
+	themes := &ThemeSettings{Filename: filename}
+	avatars := func(th *schedule.Theme) string { return th.Avatars }
+
+	// a run made during Essen, replayed with its seed and time whenever it is now
+	run := &RandomSettings{Seed: 7, Time: time.Date(2026, 10, 21, 9, 0, 0, 0, time.UTC)}
+	if got := themes.Source("av-randomize", []string{"usual"}, run.Now(), avatars, false); got != filepath.Join(dir, "essen") {
+		t.Errorf("replaying a run made during Essen used %q, want its theme's avatars", got)
+	}
+
+	run = &RandomSettings{Seed: 7, Time: time.Date(2026, 11, 21, 9, 0, 0, 0, time.UTC)}
+	if got := themes.Source("av-randomize", []string{"usual"}, run.Now(), avatars, false); got != "usual" {
+		t.Errorf("replaying a run made after Essen used %q, want %q", got, "usual")
+	}
+
+	run = &RandomSettings{}
+	if now := run.Now(); now.IsZero() || !run.Time.Equal(now) {
+		t.Errorf("Now() == %v with Time %v, want the same non-zero time", now, run.Time)
+	}
+}
+
+// Local Variables:
+// compile-command: "go test"
+// End:
@@ -24,12 +24,15 @@
 package utilities
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/profburke/bgurt/bggclient"
@@ -41,6 +44,10 @@ import (
 
 const configFilename = "config.toml"
 const badgeFilename = "badges.json"
+const constraintsFilename = "constraints.toml"
+const historyDirname = "history"
+const snapshotsDirname = "snapshots"
+const themesFilename = "themes.toml"
 const AppName = "bgurt"
 
 func ConfigDir() (string, error) {
@@ -52,6 +59,29 @@ func ConfigDir() (string, error) {
 	return filepath.Join(baseDir, AppName), nil
 }
 
+// OpenBadgeCache opens the cache of microbadge metadata in the cache directory,
+// whose copies are used for ttl before being revalidated.
+//
+func OpenBadgeCache(ttl time.Duration) (*microbadge.Cache, error) {
+	dir, err := CacheDir()
+	if err != nil {
+		return nil, err
+	}
+
+	return microbadge.NewCache(filepath.Join(dir, "microbadges"), ttl)
+}
+
+// OpenBadgeImageStore opens the store of microbadge images in the cache directory.
+//
+func OpenBadgeImageStore() (*microbadge.ImageStore, error) {
+	dir, err := CacheDir()
+	if err != nil {
+		return nil, err
+	}
+
+	return microbadge.NewImageStore(filepath.Join(dir, "microbadge-images"))
+}
+
 func ConfigFilename() (string, error) {
 	dirname, err := ConfigDir()
 	if err != nil {
@@ -70,6 +100,66 @@ func BadgeFilename() (string, error) {
 	return filepath.Join(dirname, badgeFilename), nil
 }
 
+// ConstraintsFilename returns the name of the file mb-randomize reads its
+// constraints from by default.
+//
+func ConstraintsFilename() (string, error) {
+	dirname, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dirname, constraintsFilename), nil
+}
+
+// ThemesFilename returns the name of the file the randomizers read their themes
+// from by default.
+//
+func ThemesFilename() (string, error) {
+	dirname, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dirname, themesFilename), nil
+}
+
+// HistoryDir returns the directory where the randomizers keep their rotation
+// history.
+//
+func HistoryDir() (string, error) {
+	dirname, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dirname, historyDirname), nil
+}
+
+// SnapshotDir returns the directory where bgurt snapshot saves snapshots of your
+// profile by default.
+//
+func SnapshotDir() (string, error) {
+	dirname, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dirname, snapshotsDirname), nil
+}
+
+// CacheDir returns the directory where the tools keep data they can fetch again,
+// such as microbadge metadata.
+//
+func CacheDir() (string, error) {
+	baseDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(baseDir, AppName), nil
+}
+
 // TODO: refactor the next two functions
 
 func DirectoryExists(path string) bool {
@@ -93,8 +183,79 @@ func FileExists(filename string) bool {
 	return !info.IsDir()
 }
 
-func LoadBadges(filepath string) (badges []microbadge.Microbadge, err error) {
-	return nil, errors.New("not implemented yet")
+// LoadBadgesFile reads and checks a badges file (see microbadge.BadgesFile),
+// migrating one in the original format. An empty filename means the default one,
+// BadgeFilename().
+//
+func LoadBadgesFile(filename string) (bf *microbadge.BadgesFile, err error) {
+	if filename == "" {
+		if filename, err = BadgeFilename(); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	bf, err = microbadge.DecodeBadgesFile(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+
+	return bf, nil
+}
+
+// LoadBadges returns the badges still owned in a badges file; see LoadBadgesFile.
+//
+func LoadBadges(filename string) (badges []microbadge.Microbadge, err error) {
+	bf, err := LoadBadgesFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return bf.Owned(), nil
+}
+
+// SaveBadgesFile writes bf, in the current format, to filename or, if it is
+// empty, the default badges file, creating the configuration directory if need be.
+// An existing file is only replaced if force is set or it is the default one.
+//
+func SaveBadgesFile(filename string, force bool, bf *microbadge.BadgesFile) (err error) {
+	defaultFilename, err := BadgeFilename()
+	if filename == "" {
+		if err != nil {
+			return err
+		}
+		filename = defaultFilename
+	}
+	if err == nil && filename == defaultFilename {
+		force = true
+		if err = os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			return err
+		}
+	}
+
+	if !force && FileExists(filename) {
+		return fmt.Errorf("'%s' exists", filename)
+	}
+
+	data, err := bf.Encode()
+	if err != nil {
+		return err
+	}
+
+	// write a new file and rename it, so an interrupted save keeps the old badges
+	temp := filename + ".tmp"
+	if err = ioutil.WriteFile(temp, data, 0644); err == nil {
+		err = os.Rename(temp, filename)
+	}
+	if err != nil {
+		os.Remove(temp)
+	}
+
+	return err
 }
 
 // PrintErrorAndDie prints the specified message to standard error and exits
@@ -105,14 +266,75 @@ func PrintErrorAndDie(message string) {
 	os.Exit(1)
 }
 
-// SetCredentials retrieves the username and password hash and configures the
-// bggclient object. Environment variables take priority. If they are not set,
-// try and load from config file. If still not set, emit error and quit program.
+// Exit codes used by the cli programs, so that scripts (and cron) can tell
+// what kind of failure occurred.
+//
+const (
+	ExitFailure          = 1
+	ExitNotAuthenticated = 3
+	ExitRateLimited      = 4
+	ExitServerError      = 5
+	ExitUnexpectedLayout = 6
+	ExitInterrupted      = 130
+)
+
+// ExitCode maps an error returned by the bgurt libraries to one of the exit
+// codes above.
+//
+func ExitCode(err error) int {
+	switch {
+	case errors.Is(err, bggclient.ErrNotAuthenticated):
+		return ExitNotAuthenticated
+	case errors.Is(err, bggclient.ErrRateLimited):
+		return ExitRateLimited
+	case errors.Is(err, bggclient.ErrServer):
+		return ExitServerError
+	case errors.Is(err, bggclient.ErrUnexpectedLayout):
+		return ExitUnexpectedLayout
+	case errors.Is(err, context.Canceled):
+		return ExitInterrupted
+	}
+
+	return ExitFailure
+}
+
+// ReportErrorAndDie prints err to standard error, prefixed with the tool name and
+// followed by a hint about what to do next when there is one, and exits the
+// program with the code given by ExitCode.
+//
+func ReportErrorAndDie(toolname string, err error) {
+	fmt.Fprintf(os.Stderr, "%s: %v\n", toolname, err)
+
+	code := ExitCode(err)
+	switch code {
+	case ExitNotAuthenticated:
+		fmt.Fprintln(os.Stderr, "BGG did not accept your login; check your username and password hash.")
+	case ExitRateLimited:
+		fmt.Fprintln(os.Stderr, "BGG is limiting requests; wait a while before trying again.")
+	case ExitServerError:
+		fmt.Fprintln(os.Stderr, "BGG is having problems; try again later.")
+	case ExitUnexpectedLayout:
+		fmt.Fprintln(os.Stderr, "BGG may have changed its pages; please report this at https://github.com/profburke/bgurt/issues.")
+	}
+
+	os.Exit(code)
+}
+
+// InterruptContext returns a context that is cancelled when the user hits Ctrl-C,
+// so that any request to BGG in progress is abandoned cleanly. Call stop once the
+// program is done with the context to restore the default SIGINT behavior.
+//
+func InterruptContext() (ctx context.Context, stop context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt)
+}
+
+// LoadCredentials retrieves the username and password hash. Environment variables
+// take priority. If they are not set, try and load from config file. If still not set,
+// emit error and quit program.
 //
 // TODO: allow override from command line
-// TODO: this function does too much; refactor needed
 //
-func SetCredentials() (credentials bggclient.Credentials) {
+func LoadCredentials() (credentials bggclient.Credentials) {
 	var username, passhash string
 
 	var configCredentials bggclient.Credentials
@@ -131,7 +353,7 @@ func SetCredentials() (credentials bggclient.Credentials) {
 		passhash = v
 	}
 
-	envCredentials := bggclient.Credentials{username, passhash}
+	envCredentials := bggclient.Credentials{Username: username, PassHash: passhash}
 
 	if !envCredentials.IsSet() && !configCredentials.IsSet() {
 		message := `
@@ -147,11 +369,48 @@ Or set username and password hash in the configuration file.
 	} else {
 		credentials = configCredentials
 	}
+
+	return
+}
+
+// SetCredentials loads the username and password hash (see LoadCredentials) and
+// configures bggclient's default client with them.
+//
+func SetCredentials() (credentials bggclient.Credentials) {
+	credentials = LoadCredentials()
 	bggclient.SetCredentials(credentials)
 
 	return
 }
 
+// NewClient loads the username and password hash (see LoadCredentials) and returns
+// a bggclient.Client logged in with them and configured by SiteOptions. Any error
+// creating the client is fatal.
+//
+func NewClient() (client *bggclient.Client) {
+	options := append(SiteOptions(), bggclient.WithCredentials(LoadCredentials()))
+
+	client, err := bggclient.New(options...)
+	if err != nil {
+		PrintErrorAndDie(err.Error())
+	}
+
+	return
+}
+
+// SiteOptions returns the client options for the site the tools should talk to.
+// If the BGGURL environment variable is set, that is the site instead of
+// boardgamegeek.com; this is mainly useful for pointing the tools at a fake BGG
+// (see cli/misc/fakebgg).
+//
+func SiteOptions() (options []bggclient.Option) {
+	if v, ok := os.LookupEnv("BGGURL"); ok {
+		options = append(options, bggclient.WithBaseURL(v))
+	}
+
+	return
+}
+
 // WriteToFile writes data to file. If force is false and the file exists, returns error
 // rather than overwriting the file.
 //
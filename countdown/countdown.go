@@ -0,0 +1,359 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package countdown supplies the text tags (see the parser package) that count the
+// days to and from events, such as a convention or a game night. Events are listed
+// in the [countdown] table of the bgurt configuration file:
+//
+//	[countdown]
+//	timezone = "America/New_York"  # the time zone days are counted in (by default the local one)
+//	date_format = "Jan 2"          # how [DATE] writes dates, as a Go time layout
+//
+//	[[countdown.event]]
+//	name = "essen"
+//	date = "10-22"                 # every year on October 22nd...
+//	until = "10-25"                # ...to the 25th
+//	during = "Essen is on!"        # the text for [C] while it is on (by default 0)
+//	timezone = "Europe/Berlin"
+//
+//	[[countdown.event]]
+//	name = "launch"
+//	date = "2026-11-02"            # once
+//	business_days = true           # count Monday to Friday only
+//	after = "It's out!"            # the text for [C] once it is over (by default 0)
+//
+// The tags are:
+//
+//	[C]         days until the first event (or while it's on, its during text, and
+//	            once it's over, its after text)
+//	[C:name]    the same for the named event; [C2] is the second event
+//	[SINCE]     days since the first event (0 until it has happened)
+//	[SINCE:name]
+//	[DATE]      today's date
+//	[DATE:+7]   the date a week from today (and [DATE:-7] a week ago)
+//	[DATE:name] the date the named event next starts
+//
+// Dates are written as in a themes file (see schedule.ParseDate): "MM-DD", recurring
+// every year (a range may wrap past the new year), or "YYYY-MM-DD" for an event
+// that happens once.
+//
+package countdown
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/profburke/bgurt/parser"
+	"github.com/profburke/bgurt/schedule"
+)
+
+// DefaultDateFormat is how [DATE] writes dates unless configured otherwise.
+//
+const DefaultDateFormat = "Jan 2"
+
+// Event is something to count the days to, or from.
+//
+type Event struct {
+	Name         string `toml:"name" json:"name"`
+	Date         string `toml:"date" json:"date"`
+	Until        string `toml:"until" json:"until,omitempty"` // the last day, if it lasts more than one
+	BusinessDays bool   `toml:"business_days" json:"business_days,omitempty"`
+	During       string `toml:"during" json:"during,omitempty"`
+	After        string `toml:"after" json:"after,omitempty"`
+	Timezone     string `toml:"timezone" json:"timezone,omitempty"`
+}
+
+// Config is the [countdown] table of the configuration file.
+//
+type Config struct {
+	Timezone   string  `toml:"timezone" json:"timezone,omitempty"`
+	DateFormat string  `toml:"date_format" json:"date_format,omitempty"`
+	Events     []Event `toml:"event" json:"event,omitempty"`
+}
+
+// Check reports the first problem with the configuration: a bad date or time
+// zone, or two events with the same name.
+//
+func (c *Config) Check() error {
+	if _, err := location(c.Timezone); err != nil {
+		return fmt.Errorf("countdown: bad timezone %q", c.Timezone)
+	}
+
+	names := make(map[string]bool)
+	for i, event := range c.Events {
+		what := fmt.Sprintf("event %d", i+1)
+		if event.Name != "" {
+			what = fmt.Sprintf("event %q", event.Name)
+		}
+
+		start, err := schedule.ParseDate(event.Date)
+		if err != nil {
+			return fmt.Errorf("countdown: %s: %v", what, err)
+		}
+		if event.Until != "" {
+			end, err := schedule.ParseDate(event.Until)
+			if err != nil {
+				return fmt.Errorf("countdown: %s: %v", what, err)
+			}
+			if (start.Year == 0) != (end.Year == 0) {
+				return fmt.Errorf("countdown: %s: date and until must both recur or both not", what)
+			}
+			if start.Year != 0 && civil(end, 0).Before(civil(start, 0)) {
+				return fmt.Errorf("countdown: %s: until is before date", what)
+			}
+		}
+		if _, err := location(event.Timezone); err != nil {
+			return fmt.Errorf("countdown: %s: bad timezone %q", what, event.Timezone)
+		}
+
+		name := strings.ToLower(event.Name)
+		if name != "" && names[name] {
+			return fmt.Errorf("countdown: %s: more than one event has that name", what)
+		}
+		names[name] = true
+	}
+
+	return nil
+}
+
+// Provider supplies the countdown tags.
+//
+type Provider struct {
+	config Config
+	now    func() time.Time
+}
+
+// NewProvider returns a provider of the tags for the events in config, which
+// should have passed Check.
+//
+func NewProvider(config Config) *Provider {
+	if config.DateFormat == "" {
+		config.DateFormat = DefaultDateFormat
+	}
+
+	return &Provider{config: config, now: time.Now}
+}
+
+// Tags returns the tags the provider supplies.
+//
+func (p *Provider) Tags() map[string]parser.Func {
+	return map[string]parser.Func{
+		"C":     p.countdown,
+		"SINCE": p.since,
+		"DATE":  p.date,
+	}
+}
+
+// event returns the event a tag's argument names: by name, by position (counting
+// from 1) or, with no argument, the first one.
+//
+func (p *Provider) event(arg string) (*Event, error) {
+	if len(p.config.Events) == 0 {
+		return nil, errors.New("no countdown events are configured")
+	}
+	if arg == "" {
+		return &p.config.Events[0], nil
+	}
+
+	for i := range p.config.Events {
+		if strings.EqualFold(p.config.Events[i].Name, arg) {
+			return &p.config.Events[i], nil
+		}
+	}
+	if n, err := strconv.Atoi(arg); err == nil && 1 <= n && n <= len(p.config.Events) {
+		return &p.config.Events[n-1], nil
+	}
+
+	return nil, fmt.Errorf("no countdown event %q", arg)
+}
+
+// today returns the current day where event is counted.
+//
+func (p *Provider) today(event *Event) time.Time {
+	timezone := p.config.Timezone
+	if event != nil && event.Timezone != "" {
+		timezone = event.Timezone
+	}
+	where, err := location(timezone)
+	if err != nil {
+		where = time.Local
+	}
+
+	now := p.now().In(where)
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// location returns the time zone named timezone, or the local one if it is empty.
+// (time.LoadLocation would take an empty name to mean UTC.)
+//
+func location(timezone string) (*time.Location, error) {
+	if timezone == "" {
+		return time.Local, nil
+	}
+
+	return time.LoadLocation(timezone)
+}
+
+func (p *Provider) countdown(ctx context.Context, tag parser.Tag) (string, error) {
+	event, err := p.event(tag.Arg)
+	if err != nil {
+		return "", err
+	}
+
+	today := p.today(event)
+	start, end := occurrence(event, today)
+	switch {
+	case today.Before(start):
+		return strconv.Itoa(days(today, start, event.BusinessDays)), nil
+	case !today.After(end):
+		return textOrZero(event.During), nil
+	default:
+		return textOrZero(event.After), nil
+	}
+}
+
+func (p *Provider) since(ctx context.Context, tag parser.Tag) (string, error) {
+	event, err := p.event(tag.Arg)
+	if err != nil {
+		return "", err
+	}
+
+	today := p.today(event)
+	_, end, ok := lastOccurrence(event, today)
+	if !ok || !today.After(end) {
+		return "0", nil
+	}
+
+	return strconv.Itoa(days(end, today, event.BusinessDays)), nil
+}
+
+func (p *Provider) date(ctx context.Context, tag parser.Tag) (string, error) {
+	if tag.Arg == "" || tag.Arg[0] == '+' || tag.Arg[0] == '-' {
+		offset := 0
+		if tag.Arg != "" {
+			var err error
+			if offset, err = strconv.Atoi(tag.Arg); err != nil {
+				return "", fmt.Errorf("bad number of days %q", tag.Arg)
+			}
+		}
+		return p.today(nil).AddDate(0, 0, offset).Format(p.config.DateFormat), nil
+	}
+
+	event, err := p.event(tag.Arg)
+	if err != nil {
+		return "", err
+	}
+	start, _ := occurrence(event, p.today(event))
+
+	return start.Format(p.config.DateFormat), nil
+}
+
+func textOrZero(text string) string {
+	if text == "" {
+		return "0"
+	}
+
+	return text
+}
+
+// civil returns d as midnight UTC, in year if it recurs. (A yearly February 29th
+// falls on March 1st in other years.)
+//
+func civil(d schedule.Date, year int) time.Time {
+	if d.Year != 0 {
+		year = d.Year
+	}
+
+	return time.Date(year, time.Month(d.Month), d.Day, 0, 0, 0, 0, time.UTC)
+}
+
+// span returns the first and last days of the event's occurrence starting in year.
+//
+func span(event *Event, year int) (start, end time.Time) {
+	first, _ := schedule.ParseDate(event.Date)
+	start = civil(first, year)
+	end = start
+	if event.Until != "" {
+		last, _ := schedule.ParseDate(event.Until)
+		end = civil(last, year)
+		if end.Before(start) {
+			// a yearly event that wraps past the new year
+			end = civil(last, year+1)
+		}
+	}
+
+	return start, end
+}
+
+// occurrence returns the event's current or next occurrence; for an event that
+// happens once and is over, that is the one occurrence.
+//
+func occurrence(event *Event, today time.Time) (start, end time.Time) {
+	for year := today.Year() - 1; year <= today.Year()+1; year++ {
+		start, end = span(event, year)
+		if !end.Before(today) {
+			return start, end
+		}
+	}
+
+	return start, end
+}
+
+// lastOccurrence returns the event's latest occurrence to have started by today,
+// and whether there is one.
+//
+func lastOccurrence(event *Event, today time.Time) (start, end time.Time, ok bool) {
+	for year := today.Year(); year >= today.Year()-1; year-- {
+		start, end = span(event, year)
+		if !start.After(today) {
+			return start, end, true
+		}
+	}
+
+	return start, end, false
+}
+
+// days counts the days after from up to and including to, or only the weekdays
+// among them if business is set.
+//
+func days(from, to time.Time, business bool) int {
+	total := int(to.Sub(from).Hours() / 24)
+	if !business {
+		return total
+	}
+
+	count := 0
+	for d := from.AddDate(0, 0, 1); !d.After(to); d = d.AddDate(0, 0, 1) {
+		if d.Weekday() != time.Saturday && d.Weekday() != time.Sunday {
+			count++
+		}
+	}
+
+	return count
+}
+
+// Local Variables:
+// compile-command: "go build"
+// End:
@@ -0,0 +1,190 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package countdown
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/profburke/bgurt/parser"
+)
+
+var testConfig = Config{
+	Timezone: "America/New_York",
+	Events: []Event{
+		{Name: "essen", Date: "10-22", Until: "10-25", During: "Essen is on!", Timezone: "Europe/Berlin"},
+		{Name: "launch", Date: "2026-11-02", BusinessDays: true, After: "It's out!"},
+		{Name: "holidays", Date: "12-24", Until: "01-01"},
+		{Name: "birthday", Date: "03-01"},
+	},
+}
+
+func at(s string) func() time.Time {
+	return func() time.Time {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			panic(err)
+		}
+		return t
+	}
+}
+
+func TestTags(t *testing.T) {
+	tests := []struct {
+		now  string
+		text string
+		want string
+	}{
+		{"2026-10-18T12:00:00Z", "[C]", "4"},
+		{"2026-10-18T12:00:00Z", "[C:Essen] days", "4 days"},
+		{"2026-10-18T12:00:00Z", "[C1]", "4"},
+		{"2026-10-22T12:00:00Z", "[C]", "Essen is on!"},
+		{"2026-10-25T12:00:00Z", "[C]", "Essen is on!"},
+		// midnight has passed in Berlin, but not in UTC
+		{"2026-10-25T23:30:00Z", "[C]", "361"},
+		{"2026-10-26T12:00:00Z", "[C]", "361"},
+		{"2026-10-26T12:00:00Z", "[SINCE]", "1"},
+		{"2026-10-18T12:00:00Z", "[SINCE]", "358"},
+		{"2026-10-23T12:00:00Z", "[SINCE]", "0"},
+
+		// the 18th is a Sunday: 10 weekdays from the 19th to the 30th, then the 2nd
+		{"2026-10-18T12:00:00Z", "[C:launch]", "11"},
+		{"2026-10-31T12:00:00Z", "[C2]", "1"},
+		{"2026-11-02T12:00:00Z", "[C:launch]", "0"},
+		{"2026-11-03T12:00:00Z", "[C:launch]", "It's out!"},
+		{"2026-10-18T12:00:00Z", "[SINCE:launch]", "0"},
+		{"2026-11-09T12:00:00Z", "[SINCE:launch]", "5"},
+
+		{"2026-12-20T12:00:00Z", "[C:holidays]", "4"},
+		{"2027-01-01T12:00:00Z", "[C:holidays]", "0"},
+		{"2027-01-02T12:00:00Z", "[C:holidays]", "356"},
+		{"2027-01-05T12:00:00Z", "[SINCE:holidays]", "4"},
+
+		{"2027-02-28T12:00:00Z", "[C:birthday]", "1"},
+		{"2028-02-28T12:00:00Z", "[C:birthday]", "2"},
+
+		{"2026-10-18T12:00:00Z", "[DATE]", "Oct 18"},
+		// still the 18th in New York
+		{"2026-10-19T02:00:00Z", "[DATE]", "Oct 18"},
+		{"2026-10-18T12:00:00Z", "[DATE:+14]", "Nov 1"},
+		{"2026-10-18T12:00:00Z", "[DATE:-18]", "Sep 30"},
+		{"2026-10-18T12:00:00Z", "[DATE:holidays]", "Dec 24"},
+		{"2026-10-23T12:00:00Z", "[DATE:essen]", "Oct 22"},
+	}
+
+	for _, test := range tests {
+		p := NewProvider(testConfig)
+		p.now = at(test.now)
+		got, err := parser.New(parser.WithProvider(p)).Expand(context.Background(), test.text)
+		if err != nil {
+			t.Errorf("%s %s: %v", test.now, test.text, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s %s = %q, want %q", test.now, test.text, got, test.want)
+		}
+	}
+}
+
+func TestLocalTimezone(t *testing.T) {
+	local := time.Local
+	time.Local = time.FixedZone("UTC-5", -5*60*60)
+	defer func() { time.Local = local }()
+
+	config := Config{Events: []Event{{Name: "party", Date: "2026-10-20"}}}
+	tests := []struct {
+		now  string
+		text string
+		want string
+	}{
+		// 11:30 pm on the 18th locally, but already the 19th in UTC
+		{"2026-10-19T04:30:00Z", "[C]", "2"},
+		{"2026-10-19T04:30:00Z", "[DATE]", "Oct 18"},
+		// just past local midnight
+		{"2026-10-19T05:30:00Z", "[C]", "1"},
+		{"2026-10-19T05:30:00Z", "[DATE]", "Oct 19"},
+	}
+
+	for _, test := range tests {
+		p := NewProvider(config)
+		p.now = at(test.now)
+		got, err := parser.New(parser.WithProvider(p)).Expand(context.Background(), test.text)
+		if err != nil {
+			t.Errorf("%s %s: %v", test.now, test.text, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s %s = %q, want %q", test.now, test.text, got, test.want)
+		}
+	}
+}
+
+func TestTagErrors(t *testing.T) {
+	tests := []struct {
+		config Config
+		text   string
+	}{
+		{Config{}, "[C]"},
+		{testConfig, "[C:nope]"},
+		{testConfig, "[C9]"},
+		{testConfig, "[SINCE:nope]"},
+		{testConfig, "[DATE:+x]"},
+	}
+
+	for _, test := range tests {
+		p := NewProvider(test.config)
+		p.now = at("2026-10-18T12:00:00Z")
+		if got, err := parser.New(parser.WithProvider(p)).Expand(context.Background(), test.text); err == nil {
+			t.Errorf("%s = %q, want an error", test.text, got)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		config Config
+		ok     bool
+	}{
+		{testConfig, true},
+		{Config{}, true},
+		{Config{Events: []Event{{Date: "02-29"}}}, true},
+		{Config{Timezone: "Nowhere/Special"}, false},
+		{Config{Events: []Event{{Name: "x", Date: "13-01"}}}, false},
+		{Config{Events: []Event{{Name: "x", Date: "2026-02-30"}}}, false},
+		{Config{Events: []Event{{Name: "x"}}}, false},
+		{Config{Events: []Event{{Name: "x", Date: "10-22", Until: "2026-10-25"}}}, false},
+		{Config{Events: []Event{{Name: "x", Date: "2026-10-22", Until: "2026-10-21"}}}, false},
+		{Config{Events: []Event{{Name: "x", Date: "10-22", Timezone: "Mars/Olympus"}}}, false},
+		{Config{Events: []Event{{Name: "x", Date: "10-22"}, {Name: "X", Date: "11-22"}}}, false},
+	}
+
+	for i, test := range tests {
+		if err := test.config.Check(); (err == nil) != test.ok {
+			t.Errorf("%d: Check() = %v, want ok %v", i, err, test.ok)
+		}
+	}
+}
+
+// Local Variables:
+// compile-command: "go test"
+// End:
@@ -24,7 +24,7 @@
 package geekbadge
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"image/color"
 	"log"
@@ -79,16 +79,21 @@ func init() {
 
 // Get retrieves the currently set badge.
 //
-func Get() (gb Geekbadge, err error) {
-	page, err := bggclient.Get(getGeekbadgeURL)
+func Get(client *bggclient.Client) (gb Geekbadge, err error) {
+	return GetContext(context.Background(), client)
+}
+
+// GetContext is like Get but gives up when ctx is done.
+//
+func GetContext(ctx context.Context, client *bggclient.Client) (gb Geekbadge, err error) {
+	page, err := client.GetContext(ctx, getGeekbadgeURL)
 	if err != nil {
-		message := fmt.Sprintf("geekbadge.Get: could not retrieve the geekbadge edit form: %v", err)
-		return Geekbadge{}, errors.New(message)
+		return Geekbadge{}, fmt.Errorf("geekbadge.Get: could not retrieve the geekbadge edit form: %w", err)
 	}
 
 	pieces := geekbadgeRegEx.FindStringSubmatch(page)
 	if len(pieces) != 2 {
-		return Geekbadge{}, errors.New("geekbadge.Get: could not parse geekbadge description")
+		return Geekbadge{}, &bggclient.LayoutError{Op: "geekbadge.Get", What: "geekbadge description"}
 	}
 
 	gb = Geekbadge{}
@@ -97,7 +102,10 @@ func Get() (gb Geekbadge, err error) {
 
 	keyvalues := strings.Split(pieces[1], "&amp;")
 	for _, keyvalue := range keyvalues {
-		pair := strings.Split(keyvalue, "=")
+		pair := strings.SplitN(keyvalue, "=", 2)
+		if len(pair) != 2 {
+			continue
+		}
 		// TODO: error handling for all the following type conversions
 		//       (colorFromString, ParseUint)
 		switch pair[0] {
@@ -123,9 +131,9 @@ func Get() (gb Geekbadge, err error) {
 			color, _ := colorFromString(pair[1])
 			rb.TextColor = color
 		case "leftText":
-			lb.Text = pair[1]
+			lb.Text, _ = url.QueryUnescape(pair[1])
 		case "rightText":
-			rb.Text = pair[1]
+			rb.Text, _ = url.QueryUnescape(pair[1])
 		case "leftTextPosition":
 			val, _ := strconv.ParseUint(pair[1], 10, 64)
 			lb.TextStart = uint(val)
@@ -144,7 +152,13 @@ func Get() (gb Geekbadge, err error) {
 // Set takes a structure describing the desired badge and posts it to
 // boardgamegeek.
 //
-func Set(gb Geekbadge) (success bool, err error) {
+func Set(client *bggclient.Client, gb Geekbadge) (success bool, err error) {
+	return SetContext(context.Background(), client, gb)
+}
+
+// SetContext is like Set but gives up when ctx is done.
+//
+func SetContext(ctx context.Context, client *bggclient.Client, gb Geekbadge) (success bool, err error) {
 	data := url.Values{}
 	data.Set("action", "savebadge")
 	data.Set("outerBorder", hexify(gb.OuterBorder))
@@ -159,10 +173,11 @@ func Set(gb Geekbadge) (success bool, err error) {
 	data.Set("rightTextColor", hexify(gb.RightBox.TextColor))
 	data.Set("rightTextPosition", fmt.Sprintf("%d", gb.RightBox.TextStart))
 
-	resp, err := bggclient.Post(setGeekbadgeURL, data)
+	resp, err := client.PostContext(ctx, setGeekbadgeURL, data)
 	if err != nil {
-		return false, err
+		return false, fmt.Errorf("geekbadge.Set: %w", err)
 	}
+	resp.Body.Close()
 
 	success = resp.StatusCode == 200
 	return
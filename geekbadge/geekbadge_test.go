@@ -24,6 +24,8 @@ package geekbadge
 import (
 	"image/color"
 	"testing"
+
+	"github.com/profburke/bgurt/bggclient/bggtest"
 )
 
 func TestHexify(t *testing.T) {
@@ -45,6 +47,47 @@ func TestHexify(t *testing.T) {
 	}
 }
 
+func TestSetAndGet(t *testing.T) {
+	server := bggtest.NewServer()
+	defer server.Close()
+	server.AddUser(bggtest.User{Username: "alice", PassHash: "hash"})
+
+	client, err := server.NewClient("alice")
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+
+	want := Geekbadge{
+		OuterBorder: color.RGBA{106, 90, 205, 255},
+		InnerBorder: color.RGBA{138, 43, 226, 255},
+		BarPosition: 40,
+		LeftBox: Box{
+			Text:       "Play",
+			Background: color.RGBA{85, 107, 47, 255},
+			TextColor:  color.RGBA{152, 251, 152, 255},
+			TextStart:  4,
+		},
+		RightBox: Box{
+			Text:       "Always & Forever",
+			Background: color.RGBA{152, 251, 152, 255},
+			TextColor:  color.RGBA{85, 107, 47, 255},
+			TextStart:  44,
+		},
+	}
+
+	if _, err := Set(client, want); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	got, err := Get(client)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got != want {
+		t.Errorf("Get() == %+v, want %+v", got, want)
+	}
+}
+
 // Local Variables:
 // compile-command: "go test"
 // End:
@@ -0,0 +1,239 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package history remembers what the randomizers have shown, so that they can avoid
+// repeating themselves. Each randomizer keeps a History of its own kind (avatar,
+// geekbadge, microbadges or overtext) in a Store: a directory of JSON files for the
+// command line tools, or S3 for the Lambda functions.
+//
+// Items are identified by strings: file names for avatars and geekbadges, badge
+// numbers for microbadges, and so on. A Policy says which items to avoid: those
+// shown in the last NoRepeat runs and, with ShuffleBag, those already shown in the
+// current cycle, so that every item is shown once before any is shown again.
+//
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// The kinds of history kept by the randomizers.
+//
+const (
+	Avatar      = "avatar"
+	Geekbadge   = "geekbadge"
+	Microbadges = "microbadges"
+	Overtext    = "overtext"
+)
+
+// Kinds lists the kinds of history, in the order bgurt history shows them.
+//
+var Kinds = []string{Avatar, Geekbadge, Microbadges, Overtext}
+
+// MaxEntries is the number of runs a History remembers.
+//
+const MaxEntries = 100
+
+// Entry records the items shown by one run, the time the run's choices were made
+// as of, and the seed its random choices were made with (zero if unknown).
+//
+type Entry struct {
+	Time  time.Time `json:"time"`
+	Seed  int64     `json:"seed,omitempty"`
+	Items []string  `json:"items"`
+}
+
+// History is the record of one kind of randomizer's runs. Entries are oldest
+// first. Cycle holds the items shown since the current shuffle bag cycle began.
+//
+type History struct {
+	Kind    string   `json:"kind"`
+	Entries []Entry  `json:"entries,omitempty"`
+	Cycle   []string `json:"cycle,omitempty"`
+}
+
+// Policy says which items a randomizer avoids. A zero Policy avoids nothing.
+//
+type Policy struct {
+	NoRepeat   int  // avoid items shown in this many of the latest runs
+	ShuffleBag bool // avoid items already shown in the current cycle
+}
+
+// Recent returns the items shown in the latest n runs.
+//
+func (h *History) Recent(n int) map[string]bool {
+	recent := make(map[string]bool)
+	for i := len(h.Entries) - 1; i >= 0 && i >= len(h.Entries)-n; i-- {
+		for _, item := range h.Entries[i].Items {
+			recent[item] = true
+		}
+	}
+
+	return recent
+}
+
+// Filter returns the items policy allows. If ok rejects them (typically because
+// there are too few), the policy is relaxed until ok accepts them: first the shuffle
+// bag starts a new cycle, then fewer recent runs are avoided, until, with nothing
+// avoided, all of items is returned.
+//
+func (h *History) Filter(items []string, policy Policy, ok func(allowed []string) bool) (allowed []string) {
+	inCycle := make(map[string]bool)
+	if policy.ShuffleBag {
+		for _, item := range h.Cycle {
+			inCycle[item] = true
+		}
+	}
+
+	for n := policy.NoRepeat; n >= 0; n-- {
+		recent := h.Recent(n)
+
+		for _, useCycle := range []bool{true, false} {
+			allowed = allowed[:0]
+			for _, item := range items {
+				if !recent[item] && !(useCycle && inCycle[item]) {
+					allowed = append(allowed, item)
+				}
+			}
+			if ok(allowed) {
+				if !useCycle && len(inCycle) > 0 {
+					// every remaining item has been shown: start a new cycle
+					h.Cycle = nil
+				}
+				return allowed
+			}
+			if len(inCycle) == 0 {
+				break
+			}
+		}
+	}
+
+	return items
+}
+
+// Record adds a run, made following policy, to the history. The shuffle bag cycle
+// is only kept under a ShuffleBag policy; otherwise it is dropped, so that it
+// doesn't grow without end, and turning the shuffle bag on starts a new cycle.
+//
+func (h *History) Record(entry Entry, policy Policy) {
+	h.Entries = append(h.Entries, entry)
+	if len(h.Entries) > MaxEntries {
+		h.Entries = h.Entries[len(h.Entries)-MaxEntries:]
+	}
+
+	if !policy.ShuffleBag {
+		h.Cycle = nil
+		return
+	}
+	h.Cycle = append(h.Cycle, entry.Items...)
+}
+
+// Store keeps histories. Load returns an empty History of the kind if none has
+// been saved.
+//
+type Store interface {
+	Load(ctx context.Context, kind string) (*History, error)
+	Save(ctx context.Context, h *History) error
+}
+
+// FileStore is a Store keeping each History in a JSON file, named after its kind,
+// in a directory.
+//
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore returns a FileStore in dir, which is created if need be.
+//
+func NewFileStore(dir string) (store *FileStore, err error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("history.NewFileStore: %w", err)
+	}
+
+	return &FileStore{dir: dir}, nil
+}
+
+func (fs *FileStore) filename(kind string) string {
+	return filepath.Join(fs.dir, kind+".json")
+}
+
+func (fs *FileStore) Load(ctx context.Context, kind string) (h *History, err error) {
+	data, err := ioutil.ReadFile(fs.filename(kind))
+	if errors.Is(err, os.ErrNotExist) {
+		return &History{Kind: kind}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("history.Load: %w", err)
+	}
+
+	return Decode(kind, data)
+}
+
+func (fs *FileStore) Save(ctx context.Context, h *History) error {
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return fmt.Errorf("history.Save: %w", err)
+	}
+
+	// write a new file and rename it, so an interrupted save loses only this run
+	temp, err := ioutil.TempFile(fs.dir, h.Kind+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("history.Save: %w", err)
+	}
+	_, err = temp.Write(data)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), fs.filename(h.Kind))
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+		return fmt.Errorf("history.Save: %w", err)
+	}
+
+	return nil
+}
+
+// Decode parses a History of the given kind saved as JSON, for Stores that keep
+// histories elsewhere than files.
+//
+func Decode(kind string, data []byte) (h *History, err error) {
+	h = &History{}
+	if err := json.Unmarshal(data, h); err != nil {
+		return nil, fmt.Errorf("history.Load: %s history: %w", kind, err)
+	}
+	if h.Kind == "" {
+		h.Kind = kind
+	}
+
+	return h, nil
+}
+
+// Local Variables:
+// compile-command: "go build"
+// End:
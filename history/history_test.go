@@ -0,0 +1,193 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package history
+
+import (
+	"context"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/profburke/bgurt/microbadge"
+	"github.com/profburke/bgurt/microbadge/constraints"
+)
+
+func nonEmpty(allowed []string) bool { return len(allowed) > 0 }
+
+func TestFilter(t *testing.T) {
+	items := []string{"a", "b", "c", "d"}
+	h := &History{Kind: Avatar}
+	bag := Policy{ShuffleBag: true}
+	h.Record(Entry{Time: time.Now(), Items: []string{"a"}}, bag)
+	h.Record(Entry{Time: time.Now(), Items: []string{"b"}}, bag)
+	h.Record(Entry{Time: time.Now(), Items: []string{"c"}}, bag)
+
+	var tests = []struct {
+		policy Policy
+		ok     func(allowed []string) bool
+		want   []string
+	}{
+		{Policy{}, nonEmpty, items},
+		{Policy{NoRepeat: 1}, nonEmpty, []string{"a", "b", "d"}},
+		{Policy{NoRepeat: 2}, nonEmpty, []string{"a", "d"}},
+		{Policy{NoRepeat: 5}, nonEmpty, []string{"d"}},
+		// too few left: avoid fewer runs
+		{Policy{NoRepeat: 5}, func(allowed []string) bool { return len(allowed) >= 3 }, []string{"a", "b", "d"}},
+		{Policy{ShuffleBag: true}, nonEmpty, []string{"d"}},
+	}
+
+	for _, test := range tests {
+		if got := h.Filter(items, test.policy, test.ok); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Filter with %+v gave %v, want %v", test.policy, got, test.want)
+		}
+	}
+}
+
+func TestShuffleBag(t *testing.T) {
+	items := []string{"a", "b", "c"}
+	h := &History{Kind: Overtext}
+	policy := Policy{NoRepeat: 1, ShuffleBag: true}
+
+	r := rand.New(rand.NewSource(1))
+	var shown []string
+	for run := 0; run < 30; run++ {
+		allowed := h.Filter(items, policy, nonEmpty)
+		item := allowed[r.Intn(len(allowed))]
+		if len(shown) > 0 && item == shown[len(shown)-1] {
+			t.Fatalf("run %d repeated %s", run, item)
+		}
+		shown = append(shown, item)
+		h.Record(Entry{Time: time.Now(), Items: []string{item}}, policy)
+	}
+
+	// every cycle of three shows each item once
+	for cycle := 0; cycle < len(shown); cycle += len(items) {
+		seen := make(map[string]bool)
+		for _, item := range shown[cycle : cycle+len(items)] {
+			seen[item] = true
+		}
+		if len(seen) != len(items) {
+			t.Errorf("cycle %d showed %v", cycle/len(items), shown[cycle:cycle+len(items)])
+		}
+	}
+
+	if len(h.Entries) != 30 {
+		t.Errorf("recorded %d entries, want 30", len(h.Entries))
+	}
+	for run := 0; run < MaxEntries; run++ {
+		h.Record(Entry{Time: time.Now(), Items: []string{"a"}}, policy)
+	}
+	if len(h.Entries) != MaxEntries {
+		t.Errorf("recorded %d entries, want at most %d", len(h.Entries), MaxEntries)
+	}
+}
+
+func TestCycleWithoutShuffleBag(t *testing.T) {
+	h := &History{Kind: Overtext}
+	for _, policy := range []Policy{{}, {NoRepeat: 1}} {
+		for run := 0; run < 2*MaxEntries; run++ {
+			h.Record(Entry{Time: time.Now(), Items: []string{"a", "b"}}, policy)
+		}
+		if len(h.Entries) != MaxEntries || len(h.Cycle) != 0 {
+			t.Errorf("with %+v, %d runs left %d entries and a cycle of %d items, want %d and none",
+				policy, 2*MaxEntries, len(h.Entries), len(h.Cycle), MaxEntries)
+		}
+	}
+
+	// a cycle left from shuffle bag runs is dropped once the policy changes
+	h.Record(Entry{Time: time.Now(), Items: []string{"a"}}, Policy{ShuffleBag: true})
+	if len(h.Cycle) != 1 {
+		t.Errorf("shuffle bag run left a cycle of %v, want [a]", h.Cycle)
+	}
+	h.Record(Entry{Time: time.Now(), Items: []string{"b"}}, Policy{NoRepeat: 1})
+	if h.Cycle != nil {
+		t.Errorf("run without shuffle bag left a cycle of %v, want none", h.Cycle)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := store.Load(ctx, Geekbadge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Kind != Geekbadge || len(h.Entries) != 0 {
+		t.Errorf("Load with nothing saved gave %+v", h)
+	}
+
+	h.Record(Entry{Time: time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC), Seed: 42, Items: []string{"red.json"}}, Policy{})
+	if err := store.Save(ctx, h); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := store.Load(ctx, Geekbadge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, h) {
+		t.Errorf("Load gave %+v, want %+v", loaded, h)
+	}
+}
+
+func TestPickMicrobadges(t *testing.T) {
+	var badges []microbadge.Microbadge
+	for n := uint(1); n <= 10; n++ {
+		badges = append(badges, microbadge.Microbadge{BadgeNumber: n})
+	}
+
+	// badge 1 is pinned, so is kept even though it was just shown
+	c := constraints.New(constraints.ConstraintsData{Slots: []constraints.SlotRules{{Slot: 1, Pin: 1}}},
+		constraints.WithRand(rand.New(rand.NewSource(1))))
+	h := &History{Kind: Microbadges}
+	h.Record(Entry{Time: time.Now(), Items: []string{"1", "2", "3", "4", "5"}}, Policy{NoRepeat: 1})
+
+	for run := 0; run < 20; run++ {
+		chosen, err := h.PickMicrobadges(c, badges, Policy{NoRepeat: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if chosen[0].BadgeNumber != 1 {
+			t.Fatalf("slot 1 shows %v, want badge 1", chosen[0])
+		}
+		for _, mb := range chosen[1:] {
+			if mb.BadgeNumber <= 5 {
+				t.Fatalf("chose %v, which was just shown", chosen)
+			}
+		}
+	}
+
+	// with too few badges left, repeats are allowed
+	chosen, err := h.PickMicrobadges(c, badges[:7], Policy{NoRepeat: 1})
+	if err != nil || len(chosen) != microbadge.TotalSlots {
+		t.Errorf("PickMicrobadges from 7 badges gave %v, %v", chosen, err)
+	}
+}
+
+// Local Variables:
+// compile-command: "go test"
+// End:
@@ -0,0 +1,87 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package history
+
+import (
+	"strconv"
+
+	"github.com/profburke/bgurt/microbadge"
+	"github.com/profburke/bgurt/microbadge/constraints"
+)
+
+// BadgeKeys returns the items a Microbadges history records for badges: their
+// badge numbers.
+//
+func BadgeKeys(badges []microbadge.Microbadge) (keys []string) {
+	for _, mb := range badges {
+		keys = append(keys, strconv.FormatUint(uint64(mb.BadgeNumber), 10))
+	}
+
+	return
+}
+
+// PickMicrobadges chooses badges obeying c, avoiding those policy rules out as long
+// as the constraints can still be satisfied. A badge that is the only one allowed
+// in some slot is always kept, so that pinning a badge doesn't stop the policy from
+// applying to the other slots.
+//
+func (h *History) PickMicrobadges(c constraints.Constraints, badges []microbadge.Microbadge, policy Policy) (chosen []microbadge.Microbadge, err error) {
+	forced := make(map[uint]bool)
+	for slot := uint(1); slot <= microbadge.TotalSlots; slot++ {
+		if allowed := c.Allowed(badges, slot); len(allowed) == 1 {
+			forced[allowed[0].BadgeNumber] = true
+		}
+	}
+
+	var kept, others []microbadge.Microbadge
+	for _, mb := range badges {
+		if forced[mb.BadgeNumber] {
+			kept = append(kept, mb)
+		} else {
+			others = append(others, mb)
+		}
+	}
+
+	keys := BadgeKeys(others)
+	byKey := make(map[string]microbadge.Microbadge)
+	for i, key := range keys {
+		byKey[key] = others[i]
+	}
+
+	candidates := func(allowed []string) []microbadge.Microbadge {
+		result := append([]microbadge.Microbadge{}, kept...)
+		for _, key := range allowed {
+			result = append(result, byKey[key])
+		}
+		return result
+	}
+
+	allowed := h.Filter(keys, policy, func(allowed []string) bool {
+		return c.Check(candidates(allowed)) == nil
+	})
+
+	return c.Pick(candidates(allowed))
+}
+
+// Local Variables:
+// compile-command: "go build"
+// End:
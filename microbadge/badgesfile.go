@@ -0,0 +1,327 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package microbadge
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BadgesFileVersion is the version of the badges file format written by Encode.
+// Version 0 is the original format, a bare JSON array of badges; version 1 wrapped
+// it in a BadgesFile, and version 2 keeps badges no longer owned, marked Disowned.
+//
+const BadgesFileVersion = 2
+
+// BadgesFile is the contents of a badges file: the badges someone owned when they
+// were fetched, along with those they used to own (see Merge).
+//
+type BadgesFile struct {
+	Version  int          `json:"version"`
+	Fetched  time.Time    `json:"fetched"`
+	Username string       `json:"username,omitempty"`
+	Badges   []Microbadge `json:"badges"`
+}
+
+// NewBadgesFile returns a badges file, in the current format, holding badges
+// fetched now for username.
+//
+func NewBadgesFile(username string, badges []Microbadge) *BadgesFile {
+	return &BadgesFile{
+		Version:  BadgesFileVersion,
+		Fetched:  time.Now().UTC().Truncate(time.Second),
+		Username: username,
+		Badges:   badges,
+	}
+}
+
+// DecodeBadgesFile parses and checks a badges file. A file in the original format
+// is migrated to the current one, with Version 0 recording where it came from;
+// files written by a later version of bgurt are refused.
+//
+func DecodeBadgesFile(data []byte) (bf *BadgesFile, err error) {
+	bf = &BadgesFile{}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(trimmed, &bf.Badges)
+	} else {
+		err = json.Unmarshal(data, bf)
+		if err == nil && bf.Version == 0 {
+			err = fmt.Errorf("no version")
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("microbadge.DecodeBadgesFile: not a badges file: %v", err)
+	}
+
+	if err := bf.Check(); err != nil {
+		return nil, fmt.Errorf("microbadge.DecodeBadgesFile: %v", err)
+	}
+
+	return bf, nil
+}
+
+// Encode returns the badges file as JSON, in the current format.
+//
+func (bf *BadgesFile) Encode() (data []byte, err error) {
+	current := *bf
+	current.Version = BadgesFileVersion
+
+	return json.MarshalIndent(current, "", "  ")
+}
+
+// Check reports problems with the badges file: a version this bgurt doesn't
+// understand, and badges with no number or listed twice.
+//
+func (bf *BadgesFile) Check() error {
+	if bf.Version < 0 || bf.Version > BadgesFileVersion {
+		return fmt.Errorf("badges file version %d is not supported (this bgurt reads up to version %d)",
+			bf.Version, BadgesFileVersion)
+	}
+
+	seen := make(map[uint]bool)
+	for i, mb := range bf.Badges {
+		if mb.BadgeNumber == 0 {
+			return fmt.Errorf("badge %d in the file has no number", i+1)
+		}
+		if seen[mb.BadgeNumber] {
+			return fmt.Errorf("badge %d is in the file more than once", mb.BadgeNumber)
+		}
+		seen[mb.BadgeNumber] = true
+	}
+
+	return nil
+}
+
+// Owned returns the badges in the file that are still owned.
+//
+func (bf *BadgesFile) Owned() (badges []Microbadge) {
+	for _, mb := range bf.Badges {
+		if mb.Disowned.IsZero() {
+			badges = append(badges, mb)
+		}
+	}
+
+	return badges
+}
+
+// Changes describes what Merge did to a badges file.
+//
+type Changes struct {
+	Added    []Microbadge // badges newly owned, or owned again
+	Disowned []Microbadge // badges no longer owned
+	Updated  []Microbadge // badges whose details have changed
+}
+
+// Empty reports whether nothing changed.
+//
+func (c Changes) Empty() bool {
+	return len(c.Added) == 0 && len(c.Disowned) == 0 && len(c.Updated) == 0
+}
+
+// Merge brings the file up to date with badges, a fresh list of the badges owned,
+// fetched at time now. New badges are added, acquired now; badges that are no longer
+// owned are kept but marked Disowned; and the details of the others are refreshed,
+// keeping their acquisition times and their Extra fields. A detail left empty in
+// badges (because part of a badge's page couldn't be parsed, say) keeps its stored
+// value. Owner counts change all the time, so they are refreshed without being
+// reported as changes.
+//
+func (bf *BadgesFile) Merge(badges []Microbadge, now time.Time) (changes Changes) {
+	stored := make(map[uint]Microbadge)
+	for _, mb := range bf.Badges {
+		stored[mb.BadgeNumber] = mb
+	}
+
+	merged := make([]Microbadge, 0, len(bf.Badges)+len(badges))
+	owned := make(map[uint]bool)
+	for _, mb := range badges {
+		owned[mb.BadgeNumber] = true
+
+		old, ok := stored[mb.BadgeNumber]
+		if ok {
+			mb = keepStored(mb, old)
+		}
+		if !ok || !old.Disowned.IsZero() {
+			mb.Acquired = now
+			mb.Extra = old.Extra
+			changes.Added = append(changes.Added, mb)
+			merged = append(merged, mb)
+			continue
+		}
+
+		mb.Acquired = old.Acquired
+		mb.Extra = old.Extra
+		if !sameDetails(old, mb) {
+			changes.Updated = append(changes.Updated, mb)
+		}
+		merged = append(merged, mb)
+	}
+
+	for _, mb := range bf.Badges {
+		if owned[mb.BadgeNumber] {
+			continue
+		}
+		if mb.Disowned.IsZero() {
+			mb.Disowned = now
+			changes.Disowned = append(changes.Disowned, mb)
+		}
+		merged = append(merged, mb)
+	}
+
+	bf.Badges = merged
+	bf.Fetched = now
+
+	return changes
+}
+
+// keepStored fills in the details mb is missing from old, the stored copy of the
+// same badge.
+//
+func keepStored(mb, old Microbadge) Microbadge {
+	keep := func(field *string, stored string) {
+		if *field == "" {
+			*field = stored
+		}
+	}
+	keep(&mb.Name, old.Name)
+	keep(&mb.Mouseover, old.Mouseover)
+	keep(&mb.Creator, old.Creator)
+	keep(&mb.Description, old.Description)
+	keep(&mb.ImageFilename, old.ImageFilename)
+	keep(&mb.ImageURL, old.ImageURL)
+
+	for _, g := range []struct{ field, stored *Group }{
+		{&mb.Category, &old.Category},
+		{&mb.Subcategory, &old.Subcategory},
+		{&mb.Subsubcategory, &old.Subsubcategory},
+	} {
+		if *g.field == (Group{}) {
+			*g.field = *g.stored
+		}
+	}
+
+	if mb.NumberOfOwners == 0 {
+		mb.NumberOfOwners = old.NumberOfOwners
+	}
+	if len(mb.RelatedBadges) == 0 {
+		mb.RelatedBadges = old.RelatedBadges
+	}
+
+	return mb
+}
+
+// sameDetails reports whether a and b differ only in the things Merge doesn't
+// report: owner counts and what mb-fetch records itself.
+//
+func sameDetails(a, b Microbadge) bool {
+	normalize := func(mb Microbadge) Microbadge {
+		mb.NumberOfOwners = 0
+		mb.Acquired = time.Time{}
+		mb.Disowned = time.Time{}
+		mb.Extra = nil
+		if len(mb.RelatedBadges) == 0 {
+			mb.RelatedBadges = nil
+		}
+		return mb
+	}
+
+	return reflect.DeepEqual(normalize(a), normalize(b))
+}
+
+// badgeField reports whether a JSON object key is decoded into one of
+// Microbadge's fields (which, as for encoding/json, ignores case).
+//
+func badgeField(key string) bool {
+	_, ok := reflect.TypeOf(Microbadge{}).FieldByNameFunc(func(name string) bool {
+		return strings.EqualFold(name, key)
+	})
+	return ok
+}
+
+// plainMicrobadge is Microbadge without its JSON methods.
+//
+type plainMicrobadge Microbadge
+
+// MarshalJSON encodes the badge as a JSON object, followed by its Extra fields.
+//
+func (mb Microbadge) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(plainMicrobadge(mb))
+	if err != nil || len(mb.Extra) == 0 {
+		return data, err
+	}
+
+	keys := make([]string, 0, len(mb.Extra))
+	for key := range mb.Extra {
+		if !badgeField(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var buffer bytes.Buffer
+	buffer.Write(data[:len(data)-1])
+	for _, key := range keys {
+		name, _ := json.Marshal(key)
+		buffer.WriteByte(',')
+		buffer.Write(name)
+		buffer.WriteByte(':')
+		buffer.Write(mb.Extra[key])
+	}
+	buffer.WriteByte('}')
+
+	return buffer.Bytes(), nil
+}
+
+// UnmarshalJSON decodes a badge, keeping any fields it doesn't know in Extra.
+//
+func (mb *Microbadge) UnmarshalJSON(data []byte) error {
+	var plain plainMicrobadge
+	if err := json.Unmarshal(data, &plain); err != nil {
+		return err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for key := range fields {
+		if badgeField(key) {
+			delete(fields, key)
+		}
+	}
+
+	*mb = Microbadge(plain)
+	if len(fields) > 0 {
+		mb.Extra = fields
+	}
+
+	return nil
+}
+
+// Local Variables:
+// compile-command: "go build"
+// End:
@@ -0,0 +1,125 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package microbadge
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/profburke/bgurt/bggclient"
+)
+
+// Cache keeps the metadata of microbadges on disk, one file per badge, so that
+// GetAll only has to fetch the pages of badges that are new or whose copy is older
+// than the cache's time-to-live. Stale copies are revalidated with a conditional
+// request rather than downloaded again. The cache is best effort: a copy that
+// cannot be read or written is simply fetched from BGG.
+//
+type Cache struct {
+	dir string
+	ttl time.Duration
+}
+
+type cacheEntry struct {
+	Badge      Microbadge
+	Fetched    time.Time
+	Validators bggclient.Validators
+}
+
+// NewCache returns a cache stored in dir, which is created if need be. Copies
+// younger than ttl are used without asking BGG.
+//
+func NewCache(dir string, ttl time.Duration) (cache *Cache, err error) {
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("microbadge.NewCache: %w", err)
+	}
+
+	return &Cache{dir: dir, ttl: ttl}, nil
+}
+
+func (c *Cache) filename(badgeNumber uint) string {
+	return filepath.Join(c.dir, fmt.Sprintf("%d.json", badgeNumber))
+}
+
+// load returns the cached copy of the specified badge. It is safe to call on a
+// nil Cache, which never has anything.
+//
+func (c *Cache) load(badgeNumber uint) (entry cacheEntry, ok bool) {
+	if c == nil {
+		return cacheEntry{}, false
+	}
+
+	data, err := ioutil.ReadFile(c.filename(badgeNumber))
+	if err != nil {
+		return cacheEntry{}, false
+	}
+
+	if err := json.Unmarshal(data, &entry); err != nil || entry.Badge.BadgeNumber != badgeNumber {
+		return cacheEntry{}, false
+	}
+
+	return entry, true
+}
+
+func (c *Cache) fresh(entry cacheEntry) bool {
+	return time.Since(entry.Fetched) < c.ttl
+}
+
+// store writes entry to the cache, via a temporary file so that concurrent
+// fetches never see half a copy. It is safe to call on a nil Cache.
+//
+func (c *Cache) store(entry cacheEntry) {
+	if c == nil {
+		return
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	tmp, err := ioutil.TempFile(c.dir, "badge")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+
+	if err := os.Rename(tmp.Name(), c.filename(entry.Badge.BadgeNumber)); err != nil {
+		os.Remove(tmp.Name())
+	}
+}
+
+// Local Variables:
+// compile-command: "go build"
+// End:
@@ -22,72 +22,331 @@
 // Package constraints implements a data structure to describe which microbadges can
 // be shown with in which slots and other constraints.
 //
+// Constraints are read from a TOML (or, if the file name ends in .json, JSON) file:
+//
+//	# never show these badges
+//	exclude = [1234, 5678]
+//
+//	# always show badge 4321 in slot 1
+//	[[slot]]
+//	slot = 1
+//	pin = 4321
+//
+//	# slot 5 shows one of these three, but never badge 99
+//	[[slot]]
+//	slot = 5
+//	candidates = [10, 11, 12]
+//	forbid = [99]
+//
+// Diversity rules apply to the five badges as a whole, using the groups and creators
+// fetched by mb-fetch. A badge is in a group if the group is its category,
+// subcategory or subsubcategory:
+//
+//	# no more than two badges from one category, one from one subcategory
+//	max_per_category = 2
+//	max_per_subcategory = 1
+//	# never two badges by the same creator
+//	distinct_creators = true
+//
+//	# at least one badge from group 42
+//	[[require]]
+//	group = 42
+//	count = 1
+//
+// Pick chooses among the allowed badges at random, favoring badges with a greater
+// weight. Weights are set per badge, and may be adjusted by one of the built in
+// strategies:
+//
+//	# favor rare badges (or "recent" for recently acquired ones, or "uniform")
+//	strategy = "inverse-popularity"
+//
+//	# badge 1234 is three times as likely to be shown
+//	[[weight]]
+//	badge = 1234
+//	weight = 3.0
+//
 package constraints
 
-import "github.com/profburke/bgurt/microbadge"
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/profburke/bgurt/microbadge"
+)
 
 type Constraints interface {
-	Pick(badges []microbadge.Microbadge) (chosenBadges []microbadge.Microbadge)
+	// Pick chooses one badge from badges for each slot, obeying the constraints,
+	// and returns them in slot order. If no choice obeys them, the error is a
+	// *ConflictError.
+	Pick(badges []microbadge.Microbadge) (chosenBadges []microbadge.Microbadge, err error)
+
+	// Check returns nil if Pick can succeed with badges, and the *ConflictError
+	// Pick would return otherwise.
+	Check(badges []microbadge.Microbadge) error
+
+	// Allowed returns the badges that may be shown in slot.
+	Allowed(badges []microbadge.Microbadge, slot uint) []microbadge.Microbadge
 }
 
-type ConstraintsData struct {
+// SlotRules are the constraints on a single slot. Pin, if not zero, is the badge
+// the slot must show. Forbid lists badges the slot must not show. Candidates, if
+// not empty, lists the only badges the slot may show.
+//
+type SlotRules struct {
+	Slot       uint   `toml:"slot" json:"slot"`
+	Pin        uint   `toml:"pin" json:"pin,omitempty"`
+	Forbid     []uint `toml:"forbid" json:"forbid,omitempty"`
+	Candidates []uint `toml:"candidates" json:"candidates,omitempty"`
 }
 
-func LoadConstraintsData(filepath string) (cd ConstraintsData, err error) {
-	return ConstraintsData{}, nil
+// Requirement asks for at least Count (by default 1) badges from Group.
+//
+type Requirement struct {
+	Group uint `toml:"group" json:"group"`
+	Count uint `toml:"count" json:"count,omitempty"`
 }
 
-// TODO: I'm going back and forth between badge as int and badge as microbadge.Microbadge;
-// need to decide
-type badgeSlotPair struct {
-	badge uint
-	slot  uint
+func (r Requirement) count() uint {
+	if r.Count == 0 {
+		return 1
+	}
+
+	return r.Count
 }
 
-type defaultConstraints struct {
-	disallowed map[badgeSlotPair]bool
+// ConstraintsData is the contents of a constraints file. Exclude lists badges
+// that are never shown. A zero MaxPerCategory or MaxPerSubcategory means no limit.
+// Strategy names one of Strategies; a zero HalfLifeDays means DefaultHalfLifeDays.
+//
+type ConstraintsData struct {
+	Exclude []uint      `toml:"exclude" json:"exclude,omitempty"`
+	Slots   []SlotRules `toml:"slot" json:"slot,omitempty"`
+
+	MaxPerCategory    uint          `toml:"max_per_category" json:"max_per_category,omitempty"`
+	MaxPerSubcategory uint          `toml:"max_per_subcategory" json:"max_per_subcategory,omitempty"`
+	DistinctCreators  bool          `toml:"distinct_creators" json:"distinct_creators,omitempty"`
+	Require           []Requirement `toml:"require" json:"require,omitempty"`
+
+	Strategy     string   `toml:"strategy" json:"strategy,omitempty"`
+	HalfLifeDays uint     `toml:"half_life_days" json:"half_life_days,omitempty"`
+	Weights      []Weight `toml:"weight" json:"weight,omitempty"`
 }
 
-func (dc defaultConstraints) IsAllowed(microbadge microbadge.Microbadge, slot uint) (result bool) {
-	return !dc.IsNotAllowed(microbadge, slot)
+// LoadConstraintsData reads and checks a constraints file. Unknown keys are
+// reported as errors, since they are most likely typos.
+//
+func LoadConstraintsData(filename string) (cd ConstraintsData, err error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return ConstraintsData{}, fmt.Errorf("constraints.LoadConstraintsData: %w", err)
+	}
+
+	cd, err = ParseConstraintsData(data, strings.EqualFold(filepath.Ext(filename), ".json"))
+	if err != nil {
+		return ConstraintsData{}, fmt.Errorf("constraints.LoadConstraintsData: %s: %v", filename, err)
+	}
+
+	return
 }
 
-// I have a hunch that there will be fewer disallowed pairs than allowed,
-// so, if true, it makes sense to have this one do work while IsAllowed is just negating
-// the result here...
+// ParseConstraintsData is like LoadConstraintsData for constraints already in
+// memory, in JSON if isJSON is set and TOML otherwise.
+//
+func ParseConstraintsData(data []byte, isJSON bool) (cd ConstraintsData, err error) {
+	if isJSON {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&cd)
+	} else {
+		var md toml.MetaData
+		md, err = toml.Decode(string(data), &cd)
+		if err == nil {
+			if undecoded := md.Undecoded(); len(undecoded) > 0 {
+				err = fmt.Errorf("unknown key '%s'", undecoded[0])
+			}
+		}
+	}
+	if err != nil {
+		return ConstraintsData{}, err
+	}
 
-func (dc defaultConstraints) IsNotAllowed(m microbadge.Microbadge, slot uint) (result bool) {
-	_, result = dc.disallowed[badgeSlotPair{m.BadgeNumber, slot}]
+	if err = cd.Check(); err != nil {
+		return ConstraintsData{}, err
+	}
 
 	return
 }
 
-func (dc defaultConstraints) Pick(badges []microbadge.Microbadge) (chosenBadges []microbadge.Microbadge) {
-	// create an empty set of possible microbadges for each slot
-	// possibles := ...
+// Check reports mistakes in the constraints themselves, such as an invalid slot
+// number or two sets of rules for the same slot.
+//
+func (cd ConstraintsData) Check() error {
+	seen := make(map[uint]bool)
+	for _, rules := range cd.Slots {
+		if !microbadge.ValidSlot(rules.Slot) {
+			return fmt.Errorf("slot must be between 1 and %d, not %d", microbadge.TotalSlots, rules.Slot)
+		}
+		if seen[rules.Slot] {
+			return fmt.Errorf("more than one set of rules for slot %d", rules.Slot)
+		}
+		seen[rules.Slot] = true
+	}
 
-	for mb := range badges {
-		for slot := 1; slot < microbadge.TotalSlots; slot++ {
-			if dc.IsAllowed(mb, slot) {
-				// put badge in set for slot in the possibles data structure
-			}
+	for _, r := range cd.Require {
+		if r.Group == 0 {
+			return errors.New("a require rule needs a group")
+		}
+		if r.count() > microbadge.TotalSlots {
+			return fmt.Errorf("cannot require %d badges from group %d; there are only %d slots",
+				r.count(), r.Group, microbadge.TotalSlots)
 		}
 	}
 
-	for slot := 1; slot < microbadge.TotalSlots; slot++ {
-		// p := randomly pick a badge from its set
-		// chosenBadges = append(chosenBadges, p)
+	if _, err := ParseStrategy(cd.Strategy); err != nil {
+		return err
+	}
 
-		for otherSlot := slot + 1; otherSlot < microbadge.TotalSlots; otherSlot++ {
-			// remove p from otheSlot
+	weighted := make(map[uint]bool)
+	for _, w := range cd.Weights {
+		if w.Badge == 0 {
+			return errors.New("a weight needs a badge")
+		}
+		if !(w.Weight > 0) {
+			return fmt.Errorf("the weight of badge %d must be positive, not %v (exclude it instead)", w.Badge, w.Weight)
+		}
+		if weighted[w.Badge] {
+			return fmt.Errorf("more than one weight for badge %d", w.Badge)
 		}
+		weighted[w.Badge] = true
 	}
 
-	return
+	return nil
+}
+
+type slotRules struct {
+	pin        uint
+	forbid     map[uint]bool
+	candidates map[uint]bool // nil means any badge
+}
+
+type defaultConstraints struct {
+	excluded map[uint]bool
+	slots    [microbadge.TotalSlots]slotRules
+	rand     *rand.Rand
+
+	maxPerCategory    uint
+	maxPerSubcategory uint
+	distinctCreators  bool
+	require           []Requirement
+
+	strategy     Strategy
+	halfLifeDays uint
+	weight       map[uint]float64
+	now          time.Time // zero means the time Pick is called
+}
+
+// Option configures the Constraints returned by New.
+//
+type Option func(dc *defaultConstraints)
+
+// WithRand makes Pick take its random choices from r.
+//
+func WithRand(r *rand.Rand) Option {
+	return func(dc *defaultConstraints) {
+		dc.rand = r
+	}
+}
+
+// WithNow makes Pick weigh how recently badges were acquired as of now, rather
+// than the time it is called, so that a run with the same random choices can be
+// repeated later.
+//
+func WithNow(now time.Time) Option {
+	return func(dc *defaultConstraints) {
+		dc.now = now
+	}
+}
+
+func set(numbers []uint) map[uint]bool {
+	s := make(map[uint]bool)
+	for _, n := range numbers {
+		s[n] = true
+	}
+
+	return s
 }
 
-func New(constraintsData ConstraintsData) (constraints Constraints) {
-	return defaultConstraints{}
+// New returns Constraints that enforce constraintsData, which should have passed
+// Check (LoadConstraintsData does this).
+//
+func New(constraintsData ConstraintsData, options ...Option) (constraints Constraints) {
+	dc := &defaultConstraints{
+		excluded:          set(constraintsData.Exclude),
+		rand:              rand.New(rand.NewSource(time.Now().UnixNano())),
+		maxPerCategory:    constraintsData.MaxPerCategory,
+		maxPerSubcategory: constraintsData.MaxPerSubcategory,
+		distinctCreators:  constraintsData.DistinctCreators,
+		require:           constraintsData.Require,
+		strategy:          Strategy(constraintsData.Strategy),
+		halfLifeDays:      constraintsData.HalfLifeDays,
+		weight:            make(map[uint]float64),
+	}
+	if dc.halfLifeDays == 0 {
+		dc.halfLifeDays = DefaultHalfLifeDays
+	}
+	for _, w := range constraintsData.Weights {
+		dc.weight[w.Badge] = w.Weight
+	}
+
+	for _, rules := range constraintsData.Slots {
+		if !microbadge.ValidSlot(rules.Slot) {
+			continue
+		}
+
+		sr := slotRules{pin: rules.Pin, forbid: set(rules.Forbid)}
+		if len(rules.Candidates) > 0 {
+			sr.candidates = set(rules.Candidates)
+		}
+		dc.slots[rules.Slot-1] = sr
+	}
+
+	for _, option := range options {
+		option(dc)
+	}
+
+	return dc
+}
+
+// IsAllowed reports whether the badge may be shown in the slot.
+//
+func (dc *defaultConstraints) IsAllowed(m microbadge.Microbadge, slot uint) (result bool) {
+	return !dc.IsNotAllowed(m, slot)
+}
+
+func (dc *defaultConstraints) IsNotAllowed(m microbadge.Microbadge, slot uint) (result bool) {
+	if !microbadge.ValidSlot(slot) || dc.excluded[m.BadgeNumber] {
+		return true
+	}
+
+	rules := dc.slots[slot-1]
+	switch {
+	case rules.pin != 0:
+		return m.BadgeNumber != rules.pin
+	case rules.forbid[m.BadgeNumber]:
+		return true
+	case rules.candidates != nil:
+		return !rules.candidates[m.BadgeNumber]
+	}
+
+	return false
 }
 
 // Local Variables:
@@ -0,0 +1,448 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package constraints
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/profburke/bgurt/microbadge"
+)
+
+func badges(numbers ...uint) (result []microbadge.Microbadge) {
+	for _, n := range numbers {
+		result = append(result, microbadge.Microbadge{BadgeNumber: n})
+	}
+
+	return
+}
+
+func write(t *testing.T, name, contents string) string {
+	filename := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(filename, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return filename
+}
+
+func TestLoadConstraintsData(t *testing.T) {
+	want := ConstraintsData{
+		Exclude: []uint{7},
+		Slots: []SlotRules{
+			{Slot: 1, Pin: 4321},
+			{Slot: 5, Forbid: []uint{99}, Candidates: []uint{10, 11}},
+		},
+	}
+
+	var tests = []struct {
+		name, contents string
+		wantErr        string
+	}{
+		{"c.toml", "exclude = [7]\n[[slot]]\nslot = 1\npin = 4321\n[[slot]]\nslot = 5\nforbid = [99]\ncandidates = [10, 11]\n", ""},
+		{"c.json", `{"exclude": [7], "slot": [{"slot": 1, "pin": 4321}, {"slot": 5, "forbid": [99], "candidates": [10, 11]}]}`, ""},
+		{"c.toml", "exclude = [7]\n[[slot]]\nslot = 1\npinn = 4321\n", "unknown key"},
+		{"c.json", `{"exclude": [7], "excluded": [8]}`, "unknown field"},
+		{"c.toml", "[[slot]]\nslot = 6\n", "between 1 and 5"},
+		{"c.toml", "[[slot]]\nslot = 2\n[[slot]]\nslot = 2\n", "more than one"},
+		{"c.toml", "[[require]]\ncount = 2\n", "group"},
+		{"c.toml", "[[require]]\ngroup = 5\ncount = 6\n", "only 5 slots"},
+		{"c.toml", "strategy = \"rare\"\n", "unknown strategy"},
+		{"c.toml", "[[weight]]\nbadge = 3\nweight = 0.0\n", "must be positive"},
+		{"c.toml", "[[weight]]\nbadge = 3\nweight = 2.0\n[[weight]]\nbadge = 3\nweight = 1.5\n", "more than one weight"},
+	}
+
+	for _, test := range tests {
+		cd, err := LoadConstraintsData(write(t, test.name, test.contents))
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("loading %q gave error %v, want one containing %q", test.contents, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("loading %q: %v", test.contents, err)
+		} else if !reflect.DeepEqual(cd, want) {
+			t.Errorf("loading %q gave %+v, want %+v", test.contents, cd, want)
+		}
+	}
+}
+
+func TestPick(t *testing.T) {
+	owned := badges(1, 2, 3, 4, 5, 6, 7, 8, 9, 10)
+
+	var tests = []struct {
+		cd      ConstraintsData
+		check   func(chosen []microbadge.Microbadge) bool
+		wantErr string
+	}{
+		{
+			cd:    ConstraintsData{Slots: []SlotRules{{Slot: 3, Pin: 8}}},
+			check: func(chosen []microbadge.Microbadge) bool { return chosen[2].BadgeNumber == 8 },
+		},
+		{
+			cd: ConstraintsData{Exclude: []uint{1, 2, 3, 4, 5}},
+			check: func(chosen []microbadge.Microbadge) bool {
+				for _, mb := range chosen {
+					if mb.BadgeNumber <= 5 {
+						return false
+					}
+				}
+				return true
+			},
+		},
+		{
+			cd:    ConstraintsData{Slots: []SlotRules{{Slot: 1, Candidates: []uint{4, 5}, Forbid: []uint{4}}}},
+			check: func(chosen []microbadge.Microbadge) bool { return chosen[0].BadgeNumber == 5 },
+		},
+		{
+			// the only choice is 2, 3, 1, 4, 5 (in some order for the last two),
+			// which a greedy picker often misses
+			cd: ConstraintsData{Slots: []SlotRules{
+				{Slot: 1, Candidates: []uint{1, 2}},
+				{Slot: 2, Candidates: []uint{2, 3}},
+				{Slot: 3, Candidates: []uint{1, 3}, Forbid: []uint{3}},
+				{Slot: 4, Candidates: []uint{1, 2, 3, 4, 5}},
+				{Slot: 5, Candidates: []uint{1, 2, 3, 4, 5}},
+			}},
+			check: func(chosen []microbadge.Microbadge) bool {
+				return chosen[0].BadgeNumber == 2 && chosen[1].BadgeNumber == 3 && chosen[2].BadgeNumber == 1
+			},
+		},
+		{
+			cd:      ConstraintsData{Slots: []SlotRules{{Slot: 2, Pin: 42}}},
+			wantErr: "slot 2 can show no badge (slot 2 is pinned to badge 42, which is not one of your badges)",
+		},
+		{
+			cd:      ConstraintsData{Slots: []SlotRules{{Slot: 4, Candidates: []uint{1}, Forbid: []uint{1}}}},
+			wantErr: "slot 4 can show no badge (slot 4 may only show badge 1; slot 4 may not show badge 1)",
+		},
+		{
+			cd:      ConstraintsData{Exclude: []uint{1, 2, 3, 4, 5, 6}},
+			wantErr: "slots 1, 2, 3, 4 and 5 can show only badges 7, 8, 9 and 10 between them (badges 1, 2, 3, 4, 5 and 6 are excluded)",
+		},
+	}
+
+	for i, test := range tests {
+		c := New(test.cd, WithRand(rand.New(rand.NewSource(int64(i)))))
+		for run := 0; run < 20; run++ {
+			chosen, err := c.Pick(owned)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Errorf("Pick with %+v gave error %v, want one containing %q", test.cd, err, test.wantErr)
+				}
+				break
+			}
+			if err != nil {
+				t.Errorf("Pick with %+v: %v", test.cd, err)
+				break
+			}
+
+			distinct := make(map[uint]bool)
+			for _, mb := range chosen {
+				distinct[mb.BadgeNumber] = true
+			}
+			if len(chosen) != microbadge.TotalSlots || len(distinct) != microbadge.TotalSlots || !test.check(chosen) {
+				t.Errorf("Pick with %+v chose %v", test.cd, chosen)
+				break
+			}
+		}
+	}
+}
+
+func TestConflict(t *testing.T) {
+	cd := ConstraintsData{
+		Exclude: []uint{3},
+		Slots: []SlotRules{
+			{Slot: 1, Pin: 8},
+			{Slot: 2, Candidates: []uint{3, 8}},
+			{Slot: 4, Forbid: []uint{1}},
+		},
+	}
+	c := New(cd)
+	owned := badges(1, 2, 3, 4, 5, 6, 7, 8)
+
+	err := c.Check(owned)
+	conflict, ok := err.(*ConflictError)
+	if !ok {
+		t.Fatalf("Check returned %v, want a *ConflictError", err)
+	}
+
+	want := &ConflictError{
+		Summary: "slots 1 and 2 can show only badge 8 between them",
+		Slots:   []uint{1, 2},
+		Badges:  []uint{8},
+		Reasons: []string{
+			"slot 1 is pinned to badge 8",
+			"slot 2 may only show badges 3 and 8, of which 3 is not available",
+			"badge 3 is excluded",
+		},
+	}
+	if !reflect.DeepEqual(conflict, want) {
+		t.Errorf("Check returned %#v, want %#v", conflict, want)
+	}
+
+	if _, err := c.Pick(owned); !reflect.DeepEqual(err, want) {
+		t.Errorf("Pick returned %v, want %v", err, want)
+	}
+
+	if err := New(ConstraintsData{}).Check(owned); err != nil {
+		t.Errorf("Check without constraints returned %v", err)
+	}
+}
+
+// diverse returns badges 1 to 10. Badges 1 to 4 are in category 100, 5 to 8 in
+// category 200 and 9 and 10 in category 300; odd and even badges are in
+// subcategories 101 and 102. Badges 1 and 2 are by the same creator, as are 3 and
+// 4; the others have none.
+//
+func diverse() (result []microbadge.Microbadge) {
+	for n := uint(1); n <= 10; n++ {
+		mb := microbadge.Microbadge{BadgeNumber: n}
+		switch {
+		case n <= 4:
+			mb.Category = microbadge.Group{GroupNumber: 100, Name: "Games"}
+		case n <= 8:
+			mb.Category = microbadge.Group{GroupNumber: 200, Name: "Places"}
+		default:
+			mb.Category = microbadge.Group{GroupNumber: 300, Name: "Misc"}
+		}
+		mb.Subcategory = microbadge.Group{GroupNumber: 101 + uint(1-n%2)}
+		if n <= 4 {
+			mb.Creator = []string{"ann", "bob"}[(n-1)/2]
+		}
+		result = append(result, mb)
+	}
+
+	return
+}
+
+func TestDiversity(t *testing.T) {
+	count := func(chosen []microbadge.Microbadge, in func(mb microbadge.Microbadge) bool) (n uint) {
+		for _, mb := range chosen {
+			if in(mb) {
+				n++
+			}
+		}
+		return
+	}
+
+	var tests = []struct {
+		cd      ConstraintsData
+		check   func(chosen []microbadge.Microbadge) bool
+		wantErr string
+	}{
+		{
+			cd: ConstraintsData{MaxPerCategory: 2},
+			check: func(chosen []microbadge.Microbadge) bool {
+				for _, c := range []uint{100, 200, 300} {
+					if count(chosen, func(mb microbadge.Microbadge) bool { return mb.Category.GroupNumber == c }) > 2 {
+						return false
+					}
+				}
+				return true
+			},
+		},
+		{
+			cd: ConstraintsData{MaxPerSubcategory: 3, Require: []Requirement{{Group: 300, Count: 2}}},
+			check: func(chosen []microbadge.Microbadge) bool {
+				return count(chosen, func(mb microbadge.Microbadge) bool { return mb.Subcategory.GroupNumber == 101 }) <= 3 &&
+					count(chosen, func(mb microbadge.Microbadge) bool { return mb.Category.GroupNumber == 300 }) == 2
+			},
+		},
+		{
+			// only two of badges 1 to 4 can be shown, one by each creator, so
+			// three of the slots must show badges from category 200
+			cd: ConstraintsData{
+				DistinctCreators: true,
+				Exclude:          []uint{9, 10},
+				Require:          []Requirement{{Group: 100, Count: 2}},
+				Slots:            []SlotRules{{Slot: 1, Candidates: []uint{1, 2, 3, 4}}},
+			},
+			check: func(chosen []microbadge.Microbadge) bool {
+				return chosen[0].BadgeNumber <= 4 &&
+					count(chosen, func(mb microbadge.Microbadge) bool { return mb.Category.GroupNumber == 100 }) == 2 &&
+					chosen[0].Creator != "" && count(chosen, func(mb microbadge.Microbadge) bool { return mb.Creator == chosen[0].Creator }) == 1
+			},
+		},
+		{
+			cd:      ConstraintsData{Exclude: []uint{9}, Require: []Requirement{{Group: 300, Count: 2}}},
+			wantErr: "2 badges from group 300 (Misc) are required, but only 1 can be shown (you have 2 badges in group 300 (Misc); the others are excluded or not allowed in any slot)",
+		},
+		{
+			cd:      ConstraintsData{MaxPerCategory: 1},
+			wantErr: "the diversity rules cannot all be met by badges allowed in their slots (at most 1 badges per category)",
+		},
+		{
+			cd:      ConstraintsData{DistinctCreators: true, Exclude: []uint{5, 6, 7, 8}},
+			wantErr: "(no two badges by the same creator)",
+		},
+	}
+
+	owned := diverse()
+	for i, test := range tests {
+		c := New(test.cd, WithRand(rand.New(rand.NewSource(int64(i)))))
+		for run := 0; run < 20; run++ {
+			chosen, err := c.Pick(owned)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Errorf("Pick with %+v gave error %v, want one containing %q", test.cd, err, test.wantErr)
+				}
+				break
+			}
+			if err != nil {
+				t.Errorf("Pick with %+v: %v", test.cd, err)
+				break
+			}
+
+			distinct := make(map[uint]bool)
+			for _, mb := range chosen {
+				distinct[mb.BadgeNumber] = true
+			}
+			if len(distinct) != microbadge.TotalSlots || !test.check(chosen) {
+				t.Errorf("Pick with %+v chose %v", test.cd, chosen)
+				break
+			}
+		}
+	}
+}
+
+// TestDiversityLargeCollection checks the diversity search finishes, either way,
+// on a collection far too big to search exhaustively.
+//
+func TestDiversityLargeCollection(t *testing.T) {
+	var owned []microbadge.Microbadge
+	for n := uint(1); n <= 800; n++ {
+		category := 100 * ((n-1)/200 + 1)
+		mb := microbadge.Microbadge{
+			BadgeNumber: n,
+			Category:    microbadge.Group{GroupNumber: category},
+			Subcategory: microbadge.Group{GroupNumber: category + (n-1)%200/10 + 1},
+			Creator:     fmt.Sprintf("creator %d", n%50),
+		}
+		// the first half of category 100 share a creator with badge 801
+		if n <= 100 {
+			mb.Creator = "Z"
+		}
+		owned = append(owned, mb)
+	}
+
+	var conflict *ConflictError
+	c := New(ConstraintsData{MaxPerCategory: 1, DistinctCreators: true})
+	if err := c.Check(owned); !errors.As(err, &conflict) {
+		t.Errorf("Check with four categories gave %v, want a conflict", err)
+	}
+
+	// only a badge of category 100 not by Z leaves room for badge 801
+	owned = append(owned, microbadge.Microbadge{
+		BadgeNumber: 801,
+		Category:    microbadge.Group{GroupNumber: 500},
+		Subcategory: microbadge.Group{GroupNumber: 501},
+		Creator:     "Z",
+	})
+	if err := c.Check(owned); err != nil {
+		t.Errorf("Check with a fifth category: %v", err)
+	}
+
+	c = New(ConstraintsData{MaxPerCategory: 1, DistinctCreators: true}, WithRand(rand.New(rand.NewSource(1))))
+	chosen, err := c.Pick(owned)
+	if err != nil {
+		t.Fatalf("Pick with a fifth category: %v", err)
+	}
+	categories := make(map[uint]bool)
+	for _, mb := range chosen {
+		categories[mb.Category.GroupNumber] = true
+		if mb.Category.GroupNumber == 100 && mb.Creator == "Z" {
+			t.Errorf("Pick chose badge %d, by Z like badge 801", mb.BadgeNumber)
+		}
+	}
+	if len(categories) != microbadge.TotalSlots {
+		t.Errorf("Pick chose %v, not one badge per category", chosen)
+	}
+}
+
+func TestWeights(t *testing.T) {
+	cd, err := ParseConstraintsData([]byte("strategy = \"recent\"\nhalf_life_days = 10\n[[weight]]\nbadge = 4\nweight = 2.5\n"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ConstraintsData{Strategy: "recent", HalfLifeDays: 10, Weights: []Weight{{Badge: 4, Weight: 2.5}}}
+	if !reflect.DeepEqual(cd, want) {
+		t.Errorf("parsing weights gave %+v, want %+v", cd, want)
+	}
+
+	// each test picks from badges 1 to 10 many times; favored is the badge the
+	// weights favor most and should be chosen far more often than badge 10
+	owned := badges(1, 2, 3, 4, 5, 6, 7, 8, 9, 10)
+	for i := range owned {
+		owned[i].NumberOfOwners = 1000
+	}
+	owned[0].NumberOfOwners = 10
+	owned[1].Acquired = time.Now().Add(-time.Hour)
+	owned[9].Acquired = time.Now().Add(-365 * 24 * time.Hour)
+	// as of then, two years on, only badge 3 is recent
+	then := time.Now().Add(2 * 365 * 24 * time.Hour)
+	owned[2].Acquired = then.Add(-24 * time.Hour)
+
+	var tests = []struct {
+		cd      ConstraintsData
+		options []Option
+		favored uint
+	}{
+		{ConstraintsData{Weights: []Weight{{Badge: 3, Weight: 20}}}, nil, 3},
+		{ConstraintsData{Strategy: string(InversePopularity)}, nil, 1},
+		{ConstraintsData{}, []Option{WithStrategy(RecentlyAcquired)}, 2},
+		{ConstraintsData{}, []Option{WithStrategy(RecentlyAcquired), WithNow(then)}, 3},
+	}
+
+	for i, test := range tests {
+		options := append([]Option{WithRand(rand.New(rand.NewSource(int64(i))))}, test.options...)
+		c := New(test.cd, options...)
+
+		shown := make(map[uint]int)
+		for run := 0; run < 500; run++ {
+			chosen, err := c.Pick(owned)
+			if err != nil {
+				t.Fatalf("Pick with %+v: %v", test.cd, err)
+			}
+			for _, mb := range chosen {
+				shown[mb.BadgeNumber]++
+			}
+		}
+
+		if shown[test.favored] < 450 || shown[10] > 350 {
+			t.Errorf("Pick with %+v showed badge %d %d times and badge 10 %d times in 500 runs",
+				test.cd, test.favored, shown[test.favored], shown[10])
+		}
+	}
+}
+
+// Local Variables:
+// compile-command: "go test"
+// End:
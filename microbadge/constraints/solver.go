@@ -0,0 +1,735 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package constraints
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/profburke/bgurt/microbadge"
+)
+
+// ConflictError explains why no choice of badges obeys the constraints. Summary
+// says what cannot be done, e.g. that between them Slots may only show Badges and
+// there are fewer of those than slots; Reasons describes the rules (and missing
+// badges) responsible.
+//
+type ConflictError struct {
+	Summary string
+	Slots   []uint
+	Badges  []uint
+	Reasons []string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("constraints: cannot be satisfied: %s (%s)", e.Summary, strings.Join(e.Reasons, "; "))
+}
+
+// list formats numbers as "1, 2 and 3".
+//
+func list(numbers []uint) string {
+	s := make([]string, len(numbers))
+	for i, n := range numbers {
+		s[i] = fmt.Sprint(n)
+	}
+	if len(s) < 2 {
+		return strings.Join(s, "")
+	}
+
+	return strings.Join(s[:len(s)-1], ", ") + " and " + s[len(s)-1]
+}
+
+// badgeList formats numbers as "badge 1" or "badges 1 and 2".
+//
+func badgeList(numbers []uint) string {
+	if len(numbers) == 1 {
+		return fmt.Sprintf("badge %d", numbers[0])
+	}
+
+	return "badges " + list(numbers)
+}
+
+func isAre(numbers []uint) string {
+	if len(numbers) == 1 {
+		return "is"
+	}
+
+	return "are"
+}
+
+func sorted(set map[uint]bool) (numbers []uint) {
+	for n := range set {
+		numbers = append(numbers, n)
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+
+	return
+}
+
+// Allowed returns the badges, without duplicates, that may be shown in slot.
+//
+func (dc *defaultConstraints) Allowed(badges []microbadge.Microbadge, slot uint) (allowed []microbadge.Microbadge) {
+	seen := make(map[uint]bool)
+	for _, mb := range badges {
+		if !seen[mb.BadgeNumber] && dc.IsAllowed(mb, slot) {
+			allowed = append(allowed, mb)
+		}
+		seen[mb.BadgeNumber] = true
+	}
+
+	return
+}
+
+// Pick treats choosing badges as finding a matching between slots and badges, so
+// it always finds a choice when one exists. The candidates for each slot are put
+// in a weighted random order, and the order the slots are filled in is shuffled,
+// so that the choice is random but favors badges with greater weights.
+// Diversity rules, which depend on the badges chosen together, are handled by a
+// backtracking search. Before going deeper it checks, as a flow problem, that the
+// remaining slots can still be filled within the number of badges each group,
+// creator and require rule may still take, and it tries just one of the badges
+// that are interchangeable as far as the rules are concerned. The search is
+// complete: it finds a choice whenever there is one.
+//
+func (dc *defaultConstraints) Pick(badges []microbadge.Microbadge) (chosenBadges []microbadge.Microbadge, err error) {
+	return dc.solve(badges, true)
+}
+
+func (dc *defaultConstraints) Check(badges []microbadge.Microbadge) error {
+	_, err := dc.solve(badges, false)
+
+	return err
+}
+
+func (dc *defaultConstraints) hasDiversityRules() bool {
+	return dc.maxPerCategory > 0 || dc.maxPerSubcategory > 0 || dc.distinctCreators || len(dc.require) > 0
+}
+
+func (dc *defaultConstraints) solve(badges []microbadge.Microbadge, shuffle bool) (chosenBadges []microbadge.Microbadge, err error) {
+	var candidates [microbadge.TotalSlots][]microbadge.Microbadge
+	order := make([]int, microbadge.TotalSlots)
+	for s := range candidates {
+		candidates[s] = dc.Allowed(badges, uint(s+1))
+		order[s] = s
+	}
+
+	if shuffle {
+		dc.order(badges, &candidates)
+		dc.rand.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+	}
+
+	chosen, seenSlots, seenBadges, ok := match(candidates, order, nil)
+	if !ok {
+		return nil, dc.conflict(badges, seenSlots, seenBadges)
+	}
+
+	if !dc.hasDiversityRules() {
+		return chosen, nil
+	}
+
+	if err := dc.checkRequirements(candidates, badges); err != nil {
+		return nil, err
+	}
+
+	// fill the most constrained slots first
+	sort.SliceStable(order, func(i, j int) bool {
+		return len(candidates[order[i]]) < len(candidates[order[j]])
+	})
+
+	ds := newDiversitySearch(dc, candidates, order)
+	if ds.feasible(order) && ds.run(0) {
+		return ds.chosen[:], nil
+	}
+
+	return nil, dc.diversityConflict(badges)
+}
+
+// match finds a badge for each of slots from its candidates, never using a badge
+// twice or one in used. On failure it returns the slots and badges looked at when
+// filling the slot that could not be filled: a set of slots with fewer candidates
+// between them than there are slots.
+//
+func match(candidates [microbadge.TotalSlots][]microbadge.Microbadge, slots []int, used map[uint]bool) (chosen []microbadge.Microbadge, seenSlots map[int]bool, seenBadges map[uint]bool, ok bool) {
+	// owner maps a badge number to the slot it is shown in
+	owner := make(map[uint]int)
+	chosen = make([]microbadge.Microbadge, microbadge.TotalSlots)
+
+	// assign finds a badge for slot s, moving badges already chosen for other
+	// slots if need be (an augmenting path)
+	var assign func(s int) bool
+	assign = func(s int) bool {
+		seenSlots[s] = true
+		for _, mb := range candidates[s] {
+			if seenBadges[mb.BadgeNumber] || used[mb.BadgeNumber] {
+				continue
+			}
+			seenBadges[mb.BadgeNumber] = true
+
+			other, taken := owner[mb.BadgeNumber]
+			if !taken || assign(other) {
+				owner[mb.BadgeNumber] = s
+				chosen[s] = mb
+				return true
+			}
+		}
+
+		return false
+	}
+
+	for _, s := range slots {
+		seenSlots = make(map[int]bool)
+		seenBadges = make(map[uint]bool)
+		if !assign(s) {
+			return nil, seenSlots, seenBadges, false
+		}
+	}
+
+	return chosen, nil, nil, true
+}
+
+// groups returns the numbers of the groups mb belongs to.
+//
+func groups(mb microbadge.Microbadge) (numbers []uint) {
+	for _, g := range []microbadge.Group{mb.Category, mb.Subcategory, mb.Subsubcategory} {
+		if g.GroupNumber != 0 {
+			numbers = append(numbers, g.GroupNumber)
+		}
+	}
+
+	return
+}
+
+func inGroup(mb microbadge.Microbadge, group uint) bool {
+	for _, g := range groups(mb) {
+		if g == group {
+			return true
+		}
+	}
+
+	return false
+}
+
+// diversitySearch is the state of the backtracking search for badges obeying the
+// diversity rules.
+//
+type diversitySearch struct {
+	dc         *defaultConstraints
+	candidates [microbadge.TotalSlots][]microbadge.Microbadge
+	order      []int
+	chosen     [microbadge.TotalSlots]microbadge.Microbadge
+
+	used          map[uint]bool
+	perCategory   map[uint]uint
+	perSubcat     map[uint]uint
+	creators      map[string]bool
+	requiredCount []uint // badges chosen so far from each required group
+
+	allowed      [microbadge.TotalSlots]map[uint]bool // the numbers of each slot's candidates
+	creatorCount map[string]int                       // how many candidates each creator made
+}
+
+func newDiversitySearch(dc *defaultConstraints, candidates [microbadge.TotalSlots][]microbadge.Microbadge, order []int) *diversitySearch {
+	ds := &diversitySearch{
+		dc:            dc,
+		candidates:    candidates,
+		order:         order,
+		used:          make(map[uint]bool),
+		perCategory:   make(map[uint]uint),
+		perSubcat:     make(map[uint]uint),
+		creators:      make(map[string]bool),
+		requiredCount: make([]uint, len(dc.require)),
+		creatorCount:  make(map[string]int),
+	}
+
+	seen := make(map[uint]bool)
+	for s, c := range candidates {
+		ds.allowed[s] = make(map[uint]bool)
+		for _, mb := range c {
+			ds.allowed[s][mb.BadgeNumber] = true
+			if !seen[mb.BadgeNumber] && mb.Creator != "" {
+				ds.creatorCount[mb.Creator]++
+			}
+			seen[mb.BadgeNumber] = true
+		}
+	}
+
+	return ds
+}
+
+// fits reports whether mb can join the badges chosen so far without breaking
+// a limit. Unknown groups and creators never count against a limit.
+//
+func (ds *diversitySearch) fits(mb microbadge.Microbadge) bool {
+	dc := ds.dc
+	if ds.used[mb.BadgeNumber] {
+		return false
+	}
+	if c := mb.Category.GroupNumber; dc.maxPerCategory > 0 && c != 0 && ds.perCategory[c] >= dc.maxPerCategory {
+		return false
+	}
+	if c := mb.Subcategory.GroupNumber; dc.maxPerSubcategory > 0 && c != 0 && ds.perSubcat[c] >= dc.maxPerSubcategory {
+		return false
+	}
+	if dc.distinctCreators && mb.Creator != "" && ds.creators[mb.Creator] {
+		return false
+	}
+
+	return true
+}
+
+func (ds *diversitySearch) place(slot int, mb microbadge.Microbadge, delta int) {
+	ds.chosen[slot] = mb
+	ds.used[mb.BadgeNumber] = delta > 0
+	ds.perCategory[mb.Category.GroupNumber] = uint(int(ds.perCategory[mb.Category.GroupNumber]) + delta)
+	ds.perSubcat[mb.Subcategory.GroupNumber] = uint(int(ds.perSubcat[mb.Subcategory.GroupNumber]) + delta)
+	if mb.Creator != "" {
+		ds.creators[mb.Creator] = delta > 0
+	}
+	for i, r := range ds.dc.require {
+		if inGroup(mb, r.Group) {
+			ds.requiredCount[i] = uint(int(ds.requiredCount[i]) + delta)
+		}
+	}
+}
+
+// missing is the number of badges still needed by the require rule furthest
+// from being met. One badge can count towards several rules, so this is only a
+// lower bound on the number of slots still needed, which is all pruning requires.
+//
+func (ds *diversitySearch) missing() (most uint) {
+	for i, r := range ds.dc.require {
+		if have := ds.requiredCount[i]; have < r.count() && r.count()-have > most {
+			most = r.count() - have
+		}
+	}
+
+	return
+}
+
+func (ds *diversitySearch) run(k int) bool {
+	if k == len(ds.order) {
+		return ds.missing() == 0
+	}
+
+	slot := ds.order[k]
+	remaining := ds.order[k+1:]
+	tried := make(map[string]bool)
+	for _, mb := range ds.candidates[slot] {
+		if !ds.fits(mb) {
+			continue
+		}
+
+		// a badge interchangeable with one already tried fails the same way
+		class := ds.class(mb, remaining)
+		if tried[class] {
+			continue
+		}
+		tried[class] = true
+
+		ds.place(slot, mb, 1)
+		if ds.feasible(remaining) && ds.run(k+1) {
+			return true
+		}
+		ds.place(slot, mb, -1)
+	}
+
+	return false
+}
+
+// class describes everything about mb that matters to the rules when filling
+// slots: badges with the same class can be swapped for each other in any choice.
+// A creator only matters if the creator made more than one of the candidates.
+//
+func (ds *diversitySearch) class(mb microbadge.Microbadge, slots []int) string {
+	dc := ds.dc
+	var b strings.Builder
+	if dc.maxPerCategory > 0 {
+		fmt.Fprintf(&b, "c%d ", mb.Category.GroupNumber)
+	}
+	if dc.maxPerSubcategory > 0 {
+		fmt.Fprintf(&b, "s%d ", mb.Subcategory.GroupNumber)
+	}
+	if dc.distinctCreators && ds.creatorCount[mb.Creator] > 1 {
+		fmt.Fprintf(&b, "m%q ", mb.Creator)
+	}
+	for _, r := range dc.require {
+		fmt.Fprintf(&b, "%t", inGroup(mb, r.Group))
+	}
+	b.WriteString(" ")
+	for _, s := range slots {
+		fmt.Fprintf(&b, "%t", ds.allowed[s][mb.BadgeNumber])
+	}
+
+	return b.String()
+}
+
+// feasible reports whether slots might still be filled without breaking a rule.
+// Each limit is checked as a capacity bound in a flow from the slots through the
+// badges that fit to the groups (or creators) they count against: the slots can
+// only be filled if the flow fills them all. Each require rule is checked the same
+// way with just its group's badges. The limits are checked one kind at a time, so
+// passing doesn't prove the slots can be filled, but failing proves they can't.
+//
+func (ds *diversitySearch) feasible(slots []int) bool {
+	if len(slots) == 0 {
+		return ds.missing() == 0
+	}
+	if ds.missing() > uint(len(slots)) {
+		return false
+	}
+
+	all := func(mb microbadge.Microbadge) bool { return true }
+	if ds.maxFlow(slots, all, ds.groupSink) < len(slots) {
+		return false
+	}
+	if ds.dc.distinctCreators && ds.maxFlow(slots, all, ds.creatorSink) < len(slots) {
+		return false
+	}
+
+	for i, r := range ds.dc.require {
+		need := int(r.count()) - int(ds.requiredCount[i])
+		if need <= 0 {
+			continue
+		}
+		group := r.Group
+		member := func(mb microbadge.Microbadge) bool { return inGroup(mb, group) }
+		if ds.maxFlow(slots, member, ds.groupSink) < need {
+			return false
+		}
+	}
+
+	return true
+}
+
+// groupSink adds to n the path from mb's node to the sink through the category
+// and subcategory limits, with what is left of each as its capacity.
+//
+func (ds *diversitySearch) groupSink(n *network, badge string, mb microbadge.Microbadge) {
+	dc := ds.dc
+	next := "sink"
+	if c := mb.Category.GroupNumber; dc.maxPerCategory > 0 && c != 0 {
+		next = fmt.Sprintf("category %d", c)
+		n.edge(next, "sink", int(dc.maxPerCategory)-int(ds.perCategory[c]))
+	}
+	if c := mb.Subcategory.GroupNumber; dc.maxPerSubcategory > 0 && c != 0 {
+		// subcategories nest in categories, so the limits form a tree
+		sub := fmt.Sprintf("subcategory %d/%d", mb.Category.GroupNumber, c)
+		n.edge(sub, next, int(dc.maxPerSubcategory)-int(ds.perSubcat[c]))
+		next = sub
+	}
+	n.edge(badge, next, 1)
+}
+
+// creatorSink adds to n the path from mb's node to the sink through its creator,
+// who may have one badge shown.
+//
+func (ds *diversitySearch) creatorSink(n *network, badge string, mb microbadge.Microbadge) {
+	if mb.Creator == "" {
+		n.edge(badge, "sink", 1)
+		return
+	}
+
+	creator := fmt.Sprintf("creator %q", mb.Creator)
+	n.edge(creator, "sink", 1)
+	n.edge(badge, creator, 1)
+}
+
+// maxFlow returns how many of slots can be given distinct badges, among those
+// that fit and that include selects, with sink adding each badge's way to the
+// network's sink.
+//
+func (ds *diversitySearch) maxFlow(slots []int, include func(mb microbadge.Microbadge) bool, sink func(n *network, badge string, mb microbadge.Microbadge)) int {
+	n := newNetwork()
+	added := make(map[uint]bool)
+	for _, s := range slots {
+		slot := fmt.Sprintf("slot %d", s)
+		n.edge("source", slot, 1)
+		for _, mb := range ds.candidates[s] {
+			if !include(mb) || !ds.fits(mb) {
+				continue
+			}
+			badge := fmt.Sprintf("badge %d", mb.BadgeNumber)
+			n.edge(slot, badge, 1)
+			if !added[mb.BadgeNumber] {
+				added[mb.BadgeNumber] = true
+				sink(n, badge, mb)
+			}
+		}
+	}
+
+	return n.maxFlow()
+}
+
+// network is a flow network with named nodes, from "source" to "sink".
+//
+type network struct {
+	ids      map[string]int
+	residual []map[int]int // residual[u][v] is the capacity left from u to v
+}
+
+func newNetwork() *network {
+	n := &network{ids: make(map[string]int)}
+	n.node("source")
+	n.node("sink")
+
+	return n
+}
+
+func (n *network) node(name string) int {
+	id, ok := n.ids[name]
+	if !ok {
+		id = len(n.residual)
+		n.ids[name] = id
+		n.residual = append(n.residual, make(map[int]int))
+	}
+
+	return id
+}
+
+// edge sets the capacity from one node to another; setting it again leaves it be.
+//
+func (n *network) edge(from, to string, capacity int) {
+	u, v := n.node(from), n.node(to)
+	if _, ok := n.residual[u][v]; ok {
+		return
+	}
+	if capacity < 0 {
+		capacity = 0
+	}
+	n.residual[u][v] = capacity
+	if _, ok := n.residual[v][u]; !ok {
+		n.residual[v][u] = 0
+	}
+}
+
+// maxFlow returns the greatest flow from source to sink, found one unit at a time
+// along shortest augmenting paths (every edge out of the source has capacity 1).
+//
+func (n *network) maxFlow() (flow int) {
+	source, sink := n.ids["source"], n.ids["sink"]
+	for {
+		previous := map[int]int{source: source}
+		queue := []int{source}
+		for len(queue) > 0 && !hasKey(previous, sink) {
+			u := queue[0]
+			queue = queue[1:]
+			for v, capacity := range n.residual[u] {
+				if capacity > 0 && !hasKey(previous, v) {
+					previous[v] = u
+					queue = append(queue, v)
+				}
+			}
+		}
+		if !hasKey(previous, sink) {
+			return flow
+		}
+
+		for v := sink; v != source; v = previous[v] {
+			u := previous[v]
+			n.residual[u][v]--
+			n.residual[v][u]++
+		}
+		flow++
+	}
+}
+
+func hasKey(m map[int]int, k int) bool {
+	_, ok := m[k]
+
+	return ok
+}
+
+// groupName returns "group N" followed by the group's name if any of badges
+// says what it is.
+//
+func groupName(badges []microbadge.Microbadge, number uint) string {
+	for _, mb := range badges {
+		for _, g := range []microbadge.Group{mb.Category, mb.Subcategory, mb.Subsubcategory} {
+			if g.GroupNumber == number && g.Name != "" {
+				return fmt.Sprintf("group %d (%s)", number, g.Name)
+			}
+		}
+	}
+
+	return fmt.Sprintf("group %d", number)
+}
+
+// checkRequirements makes sure each require rule can be met on its own, so that
+// the commonest mistake gets a specific explanation.
+//
+func (dc *defaultConstraints) checkRequirements(candidates [microbadge.TotalSlots][]microbadge.Microbadge, badges []microbadge.Microbadge) error {
+	for _, r := range dc.require {
+		allowed := make(map[uint]bool)
+		for _, c := range candidates {
+			for _, mb := range c {
+				if inGroup(mb, r.Group) {
+					allowed[mb.BadgeNumber] = true
+				}
+			}
+		}
+
+		if uint(len(allowed)) >= r.count() {
+			continue
+		}
+
+		owned := 0
+		for _, mb := range badges {
+			if inGroup(mb, r.Group) {
+				owned++
+			}
+		}
+
+		name := groupName(badges, r.Group)
+		e := &ConflictError{
+			Summary: fmt.Sprintf("%d badges from %s are required, but only %d can be shown", r.count(), name, len(allowed)),
+			Badges:  sorted(allowed),
+			Reasons: []string{fmt.Sprintf("you have %d badges in %s", owned, name)},
+		}
+		if owned > len(allowed) {
+			e.Reasons = append(e.Reasons, "the others are excluded or not allowed in any slot")
+		}
+		return e
+	}
+
+	return nil
+}
+
+// diversityConflict explains that the diversity rules cannot be met, listing them.
+//
+func (dc *defaultConstraints) diversityConflict(badges []microbadge.Microbadge) *ConflictError {
+	e := &ConflictError{Summary: "the diversity rules cannot all be met by badges allowed in their slots"}
+	for s := 1; s <= microbadge.TotalSlots; s++ {
+		e.Slots = append(e.Slots, uint(s))
+	}
+
+	if dc.maxPerCategory > 0 {
+		e.Reasons = append(e.Reasons, fmt.Sprintf("at most %d badges per category", dc.maxPerCategory))
+	}
+	if dc.maxPerSubcategory > 0 {
+		e.Reasons = append(e.Reasons, fmt.Sprintf("at most %d badges per subcategory", dc.maxPerSubcategory))
+	}
+	if dc.distinctCreators {
+		e.Reasons = append(e.Reasons, "no two badges by the same creator")
+	}
+	for _, r := range dc.require {
+		e.Reasons = append(e.Reasons, fmt.Sprintf("at least %d badges from %s", r.count(), groupName(badges, r.Group)))
+	}
+
+	return e
+}
+
+// conflict builds the explanation for a set of slots that cannot all be filled.
+//
+func (dc *defaultConstraints) conflict(badges []microbadge.Microbadge, seenSlots map[int]bool, seenBadges map[uint]bool) *ConflictError {
+	owned := make(map[uint]bool)
+	for _, mb := range badges {
+		owned[mb.BadgeNumber] = true
+	}
+
+	e := &ConflictError{Badges: sorted(seenBadges)}
+	for s := range seenSlots {
+		e.Slots = append(e.Slots, uint(s+1))
+	}
+	sort.Slice(e.Slots, func(i, j int) bool { return e.Slots[i] < e.Slots[j] })
+
+	what := "no badge"
+	if len(e.Badges) > 0 {
+		what = "only " + badgeList(e.Badges)
+	}
+	if len(e.Slots) == 1 {
+		e.Summary = fmt.Sprintf("slot %d can show %s", e.Slots[0], what)
+	} else {
+		e.Summary = fmt.Sprintf("slots %s can show %s between them", list(e.Slots), what)
+	}
+
+	// why a badge named by a rule is no help
+	unavailable := func(number uint) string {
+		switch {
+		case !owned[number]:
+			return "not one of your badges"
+		case dc.excluded[number]:
+			return "excluded"
+		}
+		return ""
+	}
+
+	restricted := false
+	for _, slot := range e.Slots {
+		rules := dc.slots[slot-1]
+
+		if rules.pin != 0 {
+			reason := fmt.Sprintf("slot %d is pinned to badge %d", slot, rules.pin)
+			if why := unavailable(rules.pin); why != "" {
+				reason += ", which is " + why
+			}
+			e.Reasons = append(e.Reasons, reason)
+			restricted = true
+			continue
+		}
+
+		if rules.candidates != nil {
+			reason := fmt.Sprintf("slot %d may only show %s", slot, badgeList(sorted(rules.candidates)))
+			var missing []uint
+			for _, number := range sorted(rules.candidates) {
+				if unavailable(number) != "" {
+					missing = append(missing, number)
+				}
+			}
+			if len(missing) > 0 {
+				reason += fmt.Sprintf(", of which %s %s not available", list(missing), isAre(missing))
+			}
+			e.Reasons = append(e.Reasons, reason)
+			restricted = true
+		}
+
+		var forbidden []uint
+		for _, number := range sorted(rules.forbid) {
+			if owned[number] {
+				forbidden = append(forbidden, number)
+			}
+		}
+		if len(forbidden) > 0 {
+			e.Reasons = append(e.Reasons, fmt.Sprintf("slot %d may not show %s", slot, badgeList(forbidden)))
+		}
+	}
+
+	var excluded []uint
+	for _, number := range sorted(dc.excluded) {
+		if owned[number] {
+			excluded = append(excluded, number)
+		}
+	}
+	if len(excluded) > 0 {
+		e.Reasons = append(e.Reasons, fmt.Sprintf("%s %s excluded", badgeList(excluded), isAre(excluded)))
+	}
+
+	if !restricted && len(owned) < microbadge.TotalSlots {
+		e.Reasons = append(e.Reasons, fmt.Sprintf("you have only %d badges", len(owned)))
+	}
+
+	return e
+}
+
+// Local Variables:
+// compile-command: "go build"
+// End:
@@ -0,0 +1,177 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package constraints
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/profburke/bgurt/microbadge"
+)
+
+// Strategy names a built in way of weighting badges, applied on top of any
+// explicit weights.
+//
+type Strategy string
+
+const (
+	// Uniform gives every badge the same chance.
+	Uniform Strategy = "uniform"
+	// InversePopularity favors rare badges: a badge's weight is inversely
+	// proportional to the square root of its number of owners, so a badge owned
+	// by a quarter as many people is twice as likely to be chosen.
+	InversePopularity Strategy = "inverse-popularity"
+	// RecentlyAcquired favors badges acquired recently: a badge acquired today
+	// is ten times as likely to be chosen as an old one, and the boost halves
+	// every half life.
+	RecentlyAcquired Strategy = "recent"
+)
+
+// Strategies lists the strategies ParseStrategy accepts.
+//
+var Strategies = []Strategy{Uniform, InversePopularity, RecentlyAcquired}
+
+// DefaultHalfLifeDays is the half life, in days, of the RecentlyAcquired boost.
+//
+const DefaultHalfLifeDays = 30
+
+// ParseStrategy returns the strategy named s. The empty string means Uniform.
+//
+func ParseStrategy(s string) (strategy Strategy, err error) {
+	if s == "" {
+		return Uniform, nil
+	}
+
+	names := make([]string, len(Strategies))
+	for i, strategy := range Strategies {
+		if Strategy(s) == strategy {
+			return strategy, nil
+		}
+		names[i] = string(strategy)
+	}
+
+	return "", fmt.Errorf("unknown strategy %q (must be one of %s)", s, strings.Join(names, ", "))
+}
+
+// Weight makes Badge Weight times as likely to be chosen as a badge of weight 1,
+// the default.
+//
+type Weight struct {
+	Badge  uint    `toml:"badge" json:"badge"`
+	Weight float64 `toml:"weight" json:"weight"`
+}
+
+// WithStrategy makes Pick use strategy, whatever the constraints file says.
+//
+func WithStrategy(strategy Strategy) Option {
+	return func(dc *defaultConstraints) {
+		dc.strategy = strategy
+	}
+}
+
+// weights returns the weight of each of badges, by badge number.
+//
+func (dc *defaultConstraints) weights(badges []microbadge.Microbadge) map[uint]float64 {
+	result := make(map[uint]float64)
+	for _, mb := range badges {
+		w, ok := dc.weight[mb.BadgeNumber]
+		if !ok {
+			w = 1
+		}
+		result[mb.BadgeNumber] = w
+	}
+
+	switch dc.strategy {
+	case InversePopularity:
+		// a badge whose popularity is unknown counts as typical of the others
+		typical := medianOwners(badges)
+		for _, mb := range badges {
+			owners := mb.NumberOfOwners
+			if owners == 0 {
+				owners = typical
+			}
+			if owners > 0 {
+				result[mb.BadgeNumber] /= math.Sqrt(float64(owners))
+			}
+		}
+
+	case RecentlyAcquired:
+		halfLife := float64(dc.halfLifeDays) * 24
+		now := dc.now
+		if now.IsZero() {
+			now = time.Now()
+		}
+		for _, mb := range badges {
+			if mb.Acquired.IsZero() {
+				continue
+			}
+			age := math.Max(0, now.Sub(mb.Acquired).Hours())
+			result[mb.BadgeNumber] *= 1 + 9*math.Exp2(-age/halfLife)
+		}
+	}
+
+	return result
+}
+
+func medianOwners(badges []microbadge.Microbadge) uint {
+	var owners []uint
+	for _, mb := range badges {
+		if mb.NumberOfOwners > 0 {
+			owners = append(owners, mb.NumberOfOwners)
+		}
+	}
+	if len(owners) == 0 {
+		return 0
+	}
+
+	sort.Slice(owners, func(i, j int) bool { return owners[i] < owners[j] })
+
+	return owners[len(owners)/2]
+}
+
+// order sorts each slot's candidates into a weighted random order: each badge is
+// given an exponentially distributed key divided by its weight, and badges with
+// smaller keys come first. The same keys are used for every slot, so a badge
+// ahead of another in one slot is ahead of it in all of them.
+//
+func (dc *defaultConstraints) order(badges []microbadge.Microbadge, candidates *[microbadge.TotalSlots][]microbadge.Microbadge) {
+	weights := dc.weights(badges)
+
+	keys := make(map[uint]float64)
+	for _, mb := range badges {
+		if _, ok := keys[mb.BadgeNumber]; !ok {
+			keys[mb.BadgeNumber] = dc.rand.ExpFloat64() / weights[mb.BadgeNumber]
+		}
+	}
+
+	for s := range candidates {
+		c := candidates[s]
+		sort.SliceStable(c, func(i, j int) bool { return keys[c[i].BadgeNumber] < keys[c[j].BadgeNumber] })
+	}
+}
+
+// Local Variables:
+// compile-command: "go build"
+// End:
@@ -0,0 +1,209 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package microbadge
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/profburke/bgurt/bggclient"
+)
+
+// ImageStore is a directory of badge images, each stored under the SHA-256 hash
+// of its contents so that an image shared by several badges is kept once and a
+// changed image never overwrites the old one. The store also remembers which URL
+// each image came from, so an image is only downloaded the first time it is needed.
+//
+type ImageStore struct {
+	dir string
+}
+
+// NewImageStore returns the store kept in dir, creating the directory if need be.
+//
+func NewImageStore(dir string) (store *ImageStore, err error) {
+	for _, sub := range []string{"objects", "urls"} {
+		err = os.MkdirAll(filepath.Join(dir, sub), 0755)
+		if err != nil {
+			return nil, fmt.Errorf("microbadge.NewImageStore: %w", err)
+		}
+	}
+
+	return &ImageStore{dir: dir}, nil
+}
+
+// Put stores data, giving the file the extension ext (e.g. ".gif"), and returns
+// the stored file's path.
+//
+func (s *ImageStore) Put(data []byte, ext string) (filename string, err error) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	filename = filepath.Join(s.dir, "objects", hash[:2], hash+ext)
+
+	if _, err := os.Stat(filename); err == nil {
+		return filename, nil
+	}
+
+	err = os.MkdirAll(filepath.Dir(filename), 0755)
+	if err != nil {
+		return "", err
+	}
+
+	return filename, writeAtomically(filename, data)
+}
+
+func (s *ImageStore) urlFilename(imageURL string) string {
+	sum := sha256.Sum256([]byte(imageURL))
+
+	return filepath.Join(s.dir, "urls", hex.EncodeToString(sum[:]))
+}
+
+// lookup returns the stored file for imageURL, if it has been downloaded before.
+//
+func (s *ImageStore) lookup(imageURL string) (filename string, ok bool) {
+	data, err := ioutil.ReadFile(s.urlFilename(imageURL))
+	if err != nil {
+		return "", false
+	}
+
+	filename = filepath.Join(s.dir, filepath.FromSlash(strings.TrimSpace(string(data))))
+	if _, err := os.Stat(filename); err != nil {
+		return "", false
+	}
+
+	return filename, true
+}
+
+func (s *ImageStore) remember(imageURL, filename string) error {
+	relative, err := filepath.Rel(s.dir, filename)
+	if err != nil {
+		return err
+	}
+
+	return writeAtomically(s.urlFilename(imageURL), []byte(filepath.ToSlash(relative)+"\n"))
+}
+
+func writeAtomically(filename string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), ".tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filename)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+
+	return err
+}
+
+// FetchImage downloads the image of the given badge (from its ImageURL) into the
+// store, unless it is already there, and returns the badge with ImageFilename
+// set to the stored file's path.
+//
+func FetchImage(client *bggclient.Client, store *ImageStore, mb Microbadge) (Microbadge, error) {
+	return FetchImageContext(context.Background(), client, store, mb)
+}
+
+// FetchImageContext is like FetchImage but gives up when ctx is done.
+//
+func FetchImageContext(ctx context.Context, client *bggclient.Client, store *ImageStore, mb Microbadge) (Microbadge, error) {
+	if mb.ImageURL == "" {
+		return mb, fmt.Errorf("microbadge.FetchImage: badge# %d has no image url", mb.BadgeNumber)
+	}
+
+	if filename, ok := store.lookup(mb.ImageURL); ok {
+		mb.ImageFilename = filename
+		return mb, nil
+	}
+
+	imageURL, err := url.Parse(mb.ImageURL)
+	if err != nil {
+		return mb, fmt.Errorf("microbadge.FetchImage: badge# %d: %w", mb.BadgeNumber, err)
+	}
+
+	data, err := client.DownloadContext(ctx, imageURL)
+	if err != nil {
+		return mb, fmt.Errorf("microbadge.FetchImage: badge# %d: %w", mb.BadgeNumber, err)
+	}
+
+	filename, err := store.Put(data, path.Ext(imageURL.Path))
+	if err == nil {
+		err = store.remember(mb.ImageURL, filename)
+	}
+	if err != nil {
+		return mb, fmt.Errorf("microbadge.FetchImage: badge# %d: %w", mb.BadgeNumber, err)
+	}
+
+	mb.ImageFilename = filename
+
+	return mb, nil
+}
+
+// FetchImages is like FetchImage for every badge in badges, which are updated in
+// place. Badges without an ImageURL, such as empty slots, are skipped. It downloads
+// several images at once; use WithWorkers to say how many. It stops at the first
+// error.
+//
+func FetchImages(client *bggclient.Client, store *ImageStore, badges []Microbadge, options ...FetchOption) error {
+	return FetchImagesContext(context.Background(), client, store, badges, options...)
+}
+
+// FetchImagesContext is like FetchImages but gives up when ctx is done.
+//
+func FetchImagesContext(ctx context.Context, client *bggclient.Client, store *ImageStore, badges []Microbadge, options ...FetchOption) (err error) {
+	f := fetcher{workers: DefaultWorkers}
+	for _, option := range options {
+		option(&f)
+	}
+
+	return f.each(ctx, len(badges), func(ctx context.Context, i int) error {
+		if badges[i].ImageURL == "" {
+			return nil
+		}
+
+		mb, err := FetchImageContext(ctx, client, store, badges[i])
+		if err != nil {
+			return err
+		}
+		badges[i] = mb
+
+		return nil
+	})
+}
+
+// Local Variables:
+// compile-command: "go build"
+// End:
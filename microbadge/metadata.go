@@ -0,0 +1,237 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package microbadge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/profburke/bgurt/bggclient"
+)
+
+// FieldError reports a field of a microbadge's page that is missing or could not
+// be parsed.
+//
+type FieldError struct {
+	BadgeNumber uint
+	Field       string // name of the Microbadge field
+	Problem     string
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("badge# %d: %s: %s", e.BadgeNumber, e.Field, e.Problem)
+}
+
+// MetadataError lists the fields of one or more badge pages that could not be
+// parsed. The functions returning it still return the badges, with every field
+// that could be parsed filled in. It matches bggclient.ErrUnexpectedLayout.
+//
+type MetadataError struct {
+	Fields []*FieldError
+}
+
+func (e *MetadataError) Error() string {
+	if len(e.Fields) == 1 {
+		return "microbadge: could not parse " + e.Fields[0].Error()
+	}
+
+	return fmt.Sprintf("microbadge: could not parse %d fields, the first being %v", len(e.Fields), e.Fields[0])
+}
+
+func (e *MetadataError) Is(target error) bool {
+	return target == bggclient.ErrUnexpectedLayout
+}
+
+// add appends the field errors in err, if it is a MetadataError, and returns
+// whether it was one.
+//
+func (e *MetadataError) add(err error) bool {
+	var metadataErr *MetadataError
+	if !errors.As(err, &metadataErr) {
+		return false
+	}
+	e.Fields = append(e.Fields, metadataErr.Fields...)
+
+	return true
+}
+
+func (e *MetadataError) orNil() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+
+	return e
+}
+
+var metadataRowRegEx *regexp.Regexp
+var groupRegEx *regexp.Regexp
+var relatedRegEx *regexp.Regexp
+var imageRegEx *regexp.Regexp
+
+func init() {
+	// A badge's page is mostly a table of <td>label</td> <td>value</td> rows.
+	metadataRowRegEx = regexp.MustCompile("(?s:<td>([^<]+)</td>\\s*<td>(.*?)</td>)")
+	groupRegEx = regexp.MustCompile("<a \\s*href=\"/microbadges/group/(\\d+)\"\\s*>(.*?)</a>")
+	relatedRegEx = regexp.MustCompile("href=\"/microbadge/(\\d+)\"")
+	imageRegEx = regexp.MustCompile("<img [^>]*src=['\"]([^'\"]+/(?:mbs|microbadges)/[^'\"]+)['\"]")
+}
+
+// getMetadata returns the specified badge as described on its page. With a cache,
+// a fresh cached copy is returned without a request, and a stale one is revalidated
+// with a conditional request; a badge is only cached once its page parses cleanly.
+//
+func getMetadata(ctx context.Context, client *bggclient.Client, id uint, cache *Cache) (mb Microbadge, err error) {
+	metadataURL, err := url.Parse(fmt.Sprintf("microbadge/%d", id))
+	if err != nil {
+		message := fmt.Sprintf("microbadge.metadataURL: error creating URL: %v", err)
+		return Microbadge{}, errors.New(message)
+	}
+
+	entry, cached := cache.load(id)
+	if cached && cache.fresh(entry) {
+		return entry.Badge, nil
+	}
+
+	page, validators, changed, err := client.GetIfChangedContext(ctx, metadataURL, entry.Validators)
+	if err != nil {
+		return Microbadge{}, fmt.Errorf("microbadge.getMetadata (for badge# %d): could not get page: %w", id, err)
+	}
+
+	if cached && !changed {
+		entry.Fetched = time.Now()
+		entry.Validators = validators
+		cache.store(entry)
+		return entry.Badge, nil
+	}
+
+	mb, err = parseMetadata(client, id, page)
+	if err == nil {
+		cache.store(cacheEntry{Badge: mb, Fetched: time.Now(), Validators: validators})
+	}
+
+	return mb, err
+}
+
+// parseMetadata fills in every field it can from the page of the specified badge.
+// Fields that are missing or malformed are reported in a *MetadataError; only
+// the groups, number of owners and image are required, since badges without a
+// description, creator and so on are common.
+//
+func parseMetadata(client *bggclient.Client, id uint, page string) (mb Microbadge, err error) {
+	mb = Microbadge{BadgeNumber: id}
+	problems := &MetadataError{}
+	problem := func(field, format string, args ...interface{}) {
+		problems.Fields = append(problems.Fields,
+			&FieldError{BadgeNumber: id, Field: field, Problem: fmt.Sprintf(format, args...)})
+	}
+
+	rows := make(map[string]string)
+	for _, match := range metadataRowRegEx.FindAllStringSubmatch(page, -1) {
+		label := strings.TrimSpace(match[1])
+		if _, ok := rows[label]; !ok {
+			rows[label] = match[2]
+		}
+	}
+
+	if v, ok := rows["Name"]; ok {
+		mb.Name = bggclient.Text(v)
+	}
+
+	if v, ok := rows["Group"]; ok {
+		groups := groupRegEx.FindAllStringSubmatch(v, -1)
+		targets := []*Group{&mb.Category, &mb.Subcategory, &mb.Subsubcategory}
+		if len(groups) < 2 {
+			problem("Category", "expected at least 2 groups, found %d", len(groups))
+		}
+		for i, group := range groups {
+			if i == len(targets) {
+				break
+			}
+			number, err := strconv.ParseUint(group[1], 10, 64)
+			if err != nil {
+				problem("Category", "bad group number '%s'", group[1])
+				continue
+			}
+			*targets[i] = Group{uint(number), html.UnescapeString(group[2])}
+		}
+	} else {
+		problem("Category", "no Group row")
+	}
+
+	if v, ok := rows["Num Owners"]; ok {
+		number, err := strconv.ParseUint(bggclient.Text(v), 10, 64)
+		if err != nil {
+			problem("NumberOfOwners", "bad number '%s'", bggclient.Text(v))
+		} else {
+			mb.NumberOfOwners = uint(number)
+		}
+	} else {
+		problem("NumberOfOwners", "no Num Owners row")
+	}
+
+	if v, ok := rows["Mouseover"]; ok {
+		mb.Mouseover = bggclient.Text(v)
+	}
+
+	if v, ok := rows["Created By"]; ok {
+		mb.Creator = bggclient.Text(v)
+	}
+
+	if v, ok := rows["Description"]; ok {
+		mb.Description = bggclient.Text(v)
+	}
+
+	if v, ok := rows["Related Microbadges"]; ok {
+		for _, match := range relatedRegEx.FindAllStringSubmatch(v, -1) {
+			number, err := strconv.ParseUint(match[1], 10, 64)
+			if err != nil {
+				problem("RelatedBadges", "bad badge number '%s'", match[1])
+				continue
+			}
+			mb.RelatedBadges = append(mb.RelatedBadges, uint(number))
+		}
+	}
+
+	if match := imageRegEx.FindStringSubmatch(page); match != nil {
+		src, err := url.Parse(html.UnescapeString(match[1]))
+		if err != nil {
+			problem("ImageURL", "bad image url '%s'", match[1])
+		} else {
+			mb.ImageURL = client.BaseURL().ResolveReference(src).String()
+		}
+	} else {
+		problem("ImageURL", "no badge image")
+	}
+
+	return mb, problems.orNil()
+}
+
+// Local Variables:
+// compile-command: "go build"
+// End:
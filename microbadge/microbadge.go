@@ -24,12 +24,18 @@
 package microbadge
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"html"
 	"log"
 	"net/url"
 	"regexp"
+	"sort"
 	"strconv"
+	"sync"
+	"time"
 
 	"github.com/profburke/bgurt/bggclient"
 )
@@ -49,8 +55,15 @@ type Microbadge struct {
 	Mouseover      string
 	Creator        string
 	Description    string
-	ImageFilename  string
-	// TODO: (low priority) related badge info
+	ImageFilename  string // path of the downloaded image; see FetchImages
+	ImageURL       string
+	RelatedBadges  []uint
+	Acquired       time.Time // when mb-fetch first saw the badge; zero if unknown
+	Disowned       time.Time // when mb-fetch found the badge was no longer owned; zero if owned
+
+	// Extra holds fields added to the badge by hand in a badges file (notes, say),
+	// so that they are written back out unchanged; see MarshalJSON.
+	Extra map[string]json.RawMessage `json:"-"`
 }
 
 func (mb Microbadge) String() string {
@@ -61,13 +74,15 @@ func (mb Microbadge) String() string {
 const TotalSlots = 5
 
 var microbadgeListRegEx *regexp.Regexp
-var metadataRegEx *regexp.Regexp
+var slotRegEx *regexp.Regexp
+var slotBadgeRegEx *regexp.Regexp
 var microbadgeListURL *url.URL
 var setSlotURL *url.URL
 
 func init() {
 	microbadgeListRegEx = regexp.MustCompile("<div id='badgename_(\\d+)'>([^<]+)</div>")
-	metadataRegEx = regexp.MustCompile("(?s:<td>Group</td>\\s*<td>\\s*<a \\s*href=\"/microbadges/group/(\\d+)\"\\s*>(.*?)</a>\\s*<div class='ml10'>\\s*<a \\s*href=\"/microbadges/group/(\\d+)\"\\s*>(.*?)</a>.*?<td>Num Owners</td>\\s*<td>(\\d+)</td>)")
+	slotRegEx = regexp.MustCompile("(?s:<td id='slot_(\\d+)'>(.*?)</td>)")
+	slotBadgeRegEx = regexp.MustCompile("<img src='([^']*/(\\d+)\\.gif)' alt='([^']*)'>")
 	var err error
 
 	microbadgeListURL, err = url.Parse("microbadge/edit")
@@ -84,7 +99,13 @@ func init() {
 // SetAll takes a collection of microbadge IDs and sends them to the server to set
 // as the displayed microbadges.
 //
-func SetAll(badgeNumbers []uint) (success bool, err error) {
+func SetAll(client *bggclient.Client, badgeNumbers []uint) (success bool, err error) {
+	return SetAllContext(context.Background(), client, badgeNumbers)
+}
+
+// SetAllContext is like SetAll but gives up when ctx is done.
+//
+func SetAllContext(ctx context.Context, client *bggclient.Client, badgeNumbers []uint) (success bool, err error) {
 	if len(badgeNumbers) != TotalSlots {
 		message := fmt.Sprintf("microbadge.SetAll: must be called with %d badge numbers, received %d",
 			TotalSlots, len(badgeNumbers))
@@ -95,7 +116,7 @@ func SetAll(badgeNumbers []uint) (success bool, err error) {
 		// TODO: fire these off as Go routines ...
 		// TODO: halt on first error? or try them all and return
 		// a summary of successes?
-		success, err = SetSlot(uint(i+1), b)
+		success, err = SetSlotContext(ctx, client, uint(i+1), b)
 		if err != nil {
 			return false, err
 		}
@@ -116,7 +137,13 @@ func ValidSlot(n uint) (result bool) {
 // SetSlot updates the specified microbadge display slot with the microbadge specified
 // by the ID passed in.
 //
-func SetSlot(slot, badgeNumber uint) (success bool, err error) {
+func SetSlot(client *bggclient.Client, slot, badgeNumber uint) (success bool, err error) {
+	return SetSlotContext(context.Background(), client, slot, badgeNumber)
+}
+
+// SetSlotContext is like SetSlot but gives up when ctx is done.
+//
+func SetSlotContext(ctx context.Context, client *bggclient.Client, slot, badgeNumber uint) (success bool, err error) {
 	if !ValidSlot(slot) {
 		message := fmt.Sprintf("microbadge.SetSlot: %d is an invalid slot number",
 			slot)
@@ -129,103 +156,303 @@ func SetSlot(slot, badgeNumber uint) (success bool, err error) {
 	data.Set("action", "setslot")
 	data.Set("ajax", "1")
 
-	resp, err := bggclient.Post(setSlotURL, data)
+	resp, err := client.PostContext(ctx, setSlotURL, data)
 	if err != nil {
-		return false, err
+		return false, fmt.Errorf("microbadge.SetSlot: %w", err)
 	}
+	resp.Body.Close()
 	success = resp.StatusCode == 200
 	return
 }
 
-// GetSlot returns the microbadge in the specified slot.
+// GetSlot returns the microbadge in the specified slot. Only BadgeNumber, Name and
+// ImageURL are filled in. An empty slot gives a Microbadge with a BadgeNumber of 0.
 //
-func GetSlot(slot uint) (mb Microbadge, err error) {
+func GetSlot(client *bggclient.Client, slot uint) (mb Microbadge, err error) {
+	return GetSlotContext(context.Background(), client, slot)
+}
+
+// GetSlotContext is like GetSlot but gives up when ctx is done.
+//
+func GetSlotContext(ctx context.Context, client *bggclient.Client, slot uint) (mb Microbadge, err error) {
 	if !ValidSlot(slot) {
-		message := fmt.Sprintf("microbadge.GetSlot: %s is an invalid slot number",
+		message := fmt.Sprintf("microbadge.GetSlot: %d is an invalid slot number",
 			slot)
 		return Microbadge{}, errors.New(message)
 	}
-	// TODO: implement function
-	log.Fatal("not currently implemented")
+
+	slots, err := GetSlotsContext(ctx, client)
+	if err != nil {
+		return Microbadge{}, err
+	}
+
+	return slots[slot-1], nil
+}
+
+// GetSlots returns the microbadges currently displayed, one per slot in slot
+// order (so slot n is at index n-1). As with GetSlot, only BadgeNumber, Name and
+// ImageURL are filled in, and empty slots have a BadgeNumber of 0.
+//
+func GetSlots(client *bggclient.Client) (slots []Microbadge, err error) {
+	return GetSlotsContext(context.Background(), client)
+}
+
+// GetSlotsContext is like GetSlots but gives up when ctx is done.
+//
+func GetSlotsContext(ctx context.Context, client *bggclient.Client) (slots []Microbadge, err error) {
+	page, err := client.GetContext(ctx, microbadgeListURL)
+	if err != nil {
+		return nil, fmt.Errorf("microbadge.GetSlots: could not get microbadge list: %w", err)
+	}
+
+	slots = make([]Microbadge, TotalSlots)
+	found := 0
+
+	for _, match := range slotRegEx.FindAllStringSubmatch(page, -1) {
+		slot, err := strconv.Atoi(match[1])
+		if err != nil || !ValidSlot(uint(slot)) {
+			continue
+		}
+		found++
+
+		badge := slotBadgeRegEx.FindStringSubmatch(match[2])
+		if badge == nil {
+			// empty slot
+			continue
+		}
+
+		v, err := strconv.ParseUint(badge[2], 10, 64)
+		if err != nil {
+			return nil, &bggclient.LayoutError{
+				Op:   "microbadge.GetSlots",
+				What: fmt.Sprintf("badge number in slot %d", slot),
+			}
+		}
+		src, err := url.Parse(html.UnescapeString(badge[1]))
+		if err != nil {
+			return nil, &bggclient.LayoutError{
+				Op:   "microbadge.GetSlots",
+				What: fmt.Sprintf("image url in slot %d", slot),
+			}
+		}
+		slots[slot-1] = Microbadge{
+			BadgeNumber: uint(v),
+			Name:        html.UnescapeString(badge[3]),
+			ImageURL:    client.BaseURL().ResolveReference(src).String(),
+		}
+	}
+
+	if found != TotalSlots {
+		return nil, &bggclient.LayoutError{Op: "microbadge.GetSlots", What: "microbadge slots"}
+	}
 
 	return
 }
 
 // ClearSlot clears the specified slot.
 //
-func ClearSlot(slot uint) (err error) {
+func ClearSlot(client *bggclient.Client, slot uint) (err error) {
+	return ClearSlotContext(context.Background(), client, slot)
+}
+
+// ClearSlotContext is like ClearSlot but gives up when ctx is done.
+//
+func ClearSlotContext(ctx context.Context, client *bggclient.Client, slot uint) (err error) {
 	if !ValidSlot(slot) {
-		message := fmt.Sprintf("microbadge.ClearSlot: %s is an invalid slot number",
+		message := fmt.Sprintf("microbadge.ClearSlot: %d is an invalid slot number",
 			slot)
 		return errors.New(message)
 	}
-	// TODO: implement function
-	log.Fatal("not currently implemented")
+
+	data := url.Values{}
+	data.Set("slot", fmt.Sprintf("%d", slot))
+	data.Set("action", "clearslot")
+	data.Set("ajax", "1")
+
+	resp, err := client.PostContext(ctx, setSlotURL, data)
+	if err != nil {
+		return fmt.Errorf("microbadge.ClearSlot: %w", err)
+	}
+	resp.Body.Close()
 
 	return
 }
 
-// TODO: look for subsubgroup...
+// TODO: a lot more error handling
 
-func getMetadata(id uint) (category Group, subcategory Group, numOwners uint, err error) {
-	metadataURL, err := url.Parse(fmt.Sprintf("microbadge/%d", id))
-	if err != nil {
-		message := fmt.Sprintf("microbadge.metadataURL: error creating URL: %v", err)
-		return Group{}, Group{}, 0, errors.New(message)
+// DefaultWorkers is how many badge pages GetAll fetches at once unless told
+// otherwise. The client's rate limit still applies across all of them.
+//
+const DefaultWorkers = 4
+
+// FetchOption configures GetAll, Get and the other functions that fetch badges.
+//
+type FetchOption func(f *fetcher)
+
+type fetcher struct {
+	workers int
+	cache   *Cache
+}
+
+// WithWorkers sets how many badge pages GetAll fetches at once.
+//
+func WithWorkers(n int) FetchOption {
+	return func(f *fetcher) {
+		if n > 0 {
+			f.workers = n
+		}
 	}
+}
 
-	page, err := bggclient.Get(metadataURL)
-	if err != nil {
-		message := fmt.Sprintf("microbadge.getMetadata (for badge# %d): could not get page: %v", id, err)
-		return Group{}, Group{}, 0, errors.New(message)
+// WithCache makes GetAll (or Get) use, and keep up to date, the given on-disk
+// cache of badge metadata.
+//
+func WithCache(cache *Cache) FetchOption {
+	return func(f *fetcher) {
+		f.cache = cache
+	}
+}
+
+// each calls work for 0 through n-1, f.workers at a time, and returns the first
+// error, after which no more work is started and ctx is cancelled for the work
+// in progress.
+//
+func (f fetcher) each(ctx context.Context, n int, work func(ctx context.Context, i int) error) (err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	jobs := make(chan int)
+
+	for w := 0; w < f.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if workErr := work(ctx, i); workErr != nil {
+					mu.Lock()
+					if err == nil {
+						err = workErr
+						cancel()
+					}
+					mu.Unlock()
+				}
+			}
+		}()
 	}
 
-	pieces := metadataRegEx.FindStringSubmatch(page)
-	if len(pieces) != 6 {
-		return Group{}, Group{}, 0, errors.New("could not parse metadata")
+queue:
+	for i := 0; i < n; i++ {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break queue
+		}
 	}
+	close(jobs)
+	wg.Wait()
 
-	var catid, subid uint
-	if v, err := strconv.ParseUint(pieces[1], 10, 64); err == nil {
-		catid = uint(v)
-	} else {
-		// TODO: error
+	if err == nil {
+		err = ctx.Err()
 	}
 
-	if v, err := strconv.ParseUint(pieces[3], 10, 64); err == nil {
-		subid = uint(v)
-	} else {
-		// TODO: error
+	return
+}
+
+// GetAll returns a collection of all the user's microbadges. If some badge pages
+// could not be fully parsed, or not fetched at all, the badges are returned along
+// with a *MetadataError listing the fields affected; a badge whose page couldn't
+// be fetched has just the number and name from the list of badges. GetAll only
+// gives up if ctx is done or BGG refuses the requests (ErrNotAuthenticated or
+// ErrRateLimited).
+//
+func GetAll(client *bggclient.Client, options ...FetchOption) (badges []Microbadge, err error) {
+	return GetAllContext(context.Background(), client, options...)
+}
+
+// GetAllContext is like GetAll but gives up when ctx is done.
+//
+func GetAllContext(ctx context.Context, client *bggclient.Client, options ...FetchOption) (badges []Microbadge, err error) {
+	f := fetcher{workers: DefaultWorkers}
+	for _, option := range options {
+		option(&f)
 	}
 
-	if v, err := strconv.ParseUint(pieces[5], 10, 64); err == nil {
-		numOwners = uint(v)
-	} else {
-		// TODO: error
+	badges, err = ListContext(ctx, client)
+	if err != nil {
+		return nil, fmt.Errorf("microbadge.GetAll: %w", err)
 	}
 
-	category = Group{catid, pieces[2]}
-	subcategory = Group{subid, pieces[4]}
+	var mu sync.Mutex
+	problems := &MetadataError{}
 
-	return
+	err = f.each(ctx, len(badges), func(ctx context.Context, i int) error {
+		mb, err := getMetadata(ctx, client, badges[i].BadgeNumber, f.cache)
+		if err != nil && fatal(ctx, err) {
+			return err
+		}
+		if err != nil {
+			mu.Lock()
+			if !problems.add(err) {
+				// one missing page shouldn't cost the rest of the badges
+				problems.Fields = append(problems.Fields, &FieldError{
+					BadgeNumber: badges[i].BadgeNumber,
+					Field:       "page",
+					Problem:     err.Error(),
+				})
+				mb = badges[i]
+			}
+			mu.Unlock()
+		}
+
+		if mb.Name == "" {
+			mb.Name = badges[i].Name
+		}
+		badges[i] = mb
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("microbadge.GetAll: %w", err)
+	}
+
+	sort.SliceStable(problems.Fields, func(i, j int) bool {
+		return problems.Fields[i].BadgeNumber < problems.Fields[j].BadgeNumber
+	})
+
+	return badges, problems.orNil()
 }
 
-// TODO: a lot more error handling
+// fatal reports whether err, from fetching one badge, means the others can't be
+// fetched either.
+//
+func fatal(ctx context.Context, err error) bool {
+	return ctx.Err() != nil ||
+		errors.Is(err, bggclient.ErrNotAuthenticated) ||
+		errors.Is(err, bggclient.ErrRateLimited)
+}
+
+// List returns the user's microbadges with just their numbers and names filled in.
+// It makes a single request, unlike GetAll which also fetches each badge's page.
+//
+func List(client *bggclient.Client) (badges []Microbadge, err error) {
+	return ListContext(context.Background(), client)
+}
 
-// GetAll returns a collection of all the user's microbadges.
+// ListContext is like List but gives up when ctx is done.
 //
-func GetAll() (badges []Microbadge, err error) {
-	page, err := bggclient.Get(microbadgeListURL)
+func ListContext(ctx context.Context, client *bggclient.Client) (badges []Microbadge, err error) {
+	page, err := client.GetContext(ctx, microbadgeListURL)
 	if err != nil {
-		message := fmt.Sprintf("microbadge.GetAll: could not get microbadge list: %v", err)
-		return nil, errors.New(message)
+		return nil, fmt.Errorf("microbadge.List: could not get microbadge list: %w", err)
 	}
 
 	matches := microbadgeListRegEx.FindAllStringSubmatch(page, -1)
 
 	for _, match := range matches {
 		mb := Microbadge{}
-		mb.Name = string(match[2])
+		mb.Name = html.UnescapeString(match[2])
 
 		var badgeNumber uint
 		if v, err := strconv.Atoi(match[1]); err == nil {
@@ -235,20 +462,38 @@ func GetAll() (badges []Microbadge, err error) {
 		}
 		mb.BadgeNumber = badgeNumber
 
-		category, subcategory, numOwners, err := getMetadata(mb.BadgeNumber)
-		if err != nil {
-			// TODO: error
-		} else {
-			mb.NumberOfOwners = numOwners
-			mb.Category = category
-			mb.Subcategory = subcategory
-		}
 		badges = append(badges, mb)
 	}
 
 	return
 }
 
+// Get returns the microbadge with the specified number, as described on its page.
+// If the page could not be fully parsed, the fields that could be are returned
+// along with a *MetadataError. Use WithCache to keep the badge in a cache.
+//
+func Get(client *bggclient.Client, badgeNumber uint, options ...FetchOption) (mb Microbadge, err error) {
+	return GetContext(context.Background(), client, badgeNumber, options...)
+}
+
+// GetContext is like Get but gives up when ctx is done.
+//
+func GetContext(ctx context.Context, client *bggclient.Client, badgeNumber uint, options ...FetchOption) (mb Microbadge, err error) {
+	var f fetcher
+	for _, option := range options {
+		option(&f)
+	}
+
+	mb, err = getMetadata(ctx, client, badgeNumber, f.cache)
+
+	var metadataErr *MetadataError
+	if err != nil && !errors.As(err, &metadataErr) {
+		return Microbadge{}, fmt.Errorf("microbadge.Get: %w", err)
+	}
+
+	return mb, err
+}
+
 // Local Variables:
 // compile-command: "go build"
 // End:
@@ -0,0 +1,725 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package microbadge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/profburke/bgurt/bggclient"
+	"github.com/profburke/bgurt/bggclient/bggtest"
+	"github.com/profburke/bgurt/parser"
+)
+
+func newServer(t *testing.T) *bggtest.Server {
+	server := bggtest.NewServer()
+	server.AddBadge(bggtest.Badge{
+		Number:         1234,
+		Name:           "I play games",
+		Category:       bggtest.Group{Number: 3, Name: "Gaming"},
+		Subcategory:    bggtest.Group{Number: 31, Name: "General"},
+		Subsubcategory: bggtest.Group{Number: 311, Name: "Gamers & Friends"},
+		NumberOfOwners: 4321,
+		Mouseover:      "I play games",
+		Creator:        "bgurt",
+		Description:    "For people who play games.\nAll of them.",
+		Related:        []uint{99, 2},
+	})
+	server.AddBadge(bggtest.Badge{
+		Number:         99,
+		Name:           "Meeple & Co.",
+		Category:       bggtest.Group{Number: 7, Name: "Fun"},
+		Subcategory:    bggtest.Group{Number: 71, Name: "Meeples"},
+		NumberOfOwners: 12,
+	})
+	server.AddUser(bggtest.User{
+		Username: "alice",
+		PassHash: "hash",
+		Badges:   []uint{99, 1234, 2, 3, 4},
+	})
+
+	return server
+}
+
+func TestGetAll(t *testing.T) {
+	server := newServer(t)
+	defer server.Close()
+
+	client, err := server.NewClient("alice")
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+
+	badges, err := GetAll(client)
+	if err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	if len(badges) != 5 {
+		t.Fatalf("GetAll returned %d badges, want 5", len(badges))
+	}
+
+	want := []Microbadge{
+		{
+			BadgeNumber:    99,
+			Name:           "Meeple & Co.",
+			Category:       Group{7, "Fun"},
+			Subcategory:    Group{71, "Meeples"},
+			NumberOfOwners: 12,
+			ImageURL:       server.URL + "/images/microbadges/99.gif",
+		},
+		{
+			BadgeNumber:    1234,
+			Name:           "I play games",
+			Category:       Group{3, "Gaming"},
+			Subcategory:    Group{31, "General"},
+			Subsubcategory: Group{311, "Gamers & Friends"},
+			NumberOfOwners: 4321,
+			Mouseover:      "I play games",
+			Creator:        "bgurt",
+			Description:    "For people who play games.\nAll of them.",
+			ImageURL:       server.URL + "/images/microbadges/1234.gif",
+			RelatedBadges:  []uint{99, 2},
+		},
+	}
+	for _, w := range want {
+		found := false
+		for _, b := range badges {
+			if b.BadgeNumber == w.BadgeNumber {
+				found = true
+				if !reflect.DeepEqual(b, w) {
+					t.Errorf("GetAll badge %d == %+v, want %+v", w.BadgeNumber, b, w)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("GetAll did not return badge %d", w.BadgeNumber)
+		}
+	}
+}
+
+// countingTransport counts the responses to requests for badge pages by status.
+//
+type countingTransport struct {
+	mu       sync.Mutex
+	statuses map[int]int
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := http.DefaultTransport.RoundTrip(req)
+	if err == nil && req.URL.Path != "/microbadge/edit" && strings.HasPrefix(req.URL.Path, "/microbadge/") {
+		c.mu.Lock()
+		c.statuses[res.StatusCode]++
+		c.mu.Unlock()
+	}
+
+	return res, err
+}
+
+func (c *countingTransport) reset() map[int]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	statuses := c.statuses
+	c.statuses = make(map[int]int)
+
+	return statuses
+}
+
+// failingTransport answers requests for one badge's page with status.
+//
+type failingTransport struct {
+	path   string
+	status int
+}
+
+func (f failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Path == f.path {
+		return &http.Response{
+			StatusCode: f.status,
+			Status:     http.StatusText(f.status),
+			Header:     make(http.Header),
+			Body:       ioutil.NopCloser(strings.NewReader("")),
+			Request:    req,
+		}, nil
+	}
+
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestGetAllMissingPage(t *testing.T) {
+	server := newServer(t)
+	defer server.Close()
+
+	client, err := server.NewClient("alice", bggclient.WithTransport(failingTransport{"/microbadge/99", http.StatusNotFound}))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+
+	badges, err := GetAll(client)
+	var metadataErr *MetadataError
+	if !errors.As(err, &metadataErr) {
+		t.Fatalf("GetAll returned %v, want a *MetadataError", err)
+	}
+	if len(badges) != 5 {
+		t.Fatalf("GetAll returned %d badges, want 5", len(badges))
+	}
+	for _, mb := range badges {
+		switch mb.BadgeNumber {
+		case 99:
+			if mb.Name != "Meeple & Co." || mb.NumberOfOwners != 0 {
+				t.Errorf("GetAll badge 99 == %+v, want just its number and name", mb)
+			}
+		case 1234:
+			if mb.NumberOfOwners != 4321 {
+				t.Errorf("GetAll badge 1234 == %+v, want its details", mb)
+			}
+		}
+	}
+	found := false
+	for _, f := range metadataErr.Fields {
+		if f.BadgeNumber == 99 && f.Field == "page" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("GetAll problems %v don't include badge 99's page", metadataErr)
+	}
+
+	// being rate limited stops the whole fetch
+	client, err = server.NewClient("alice", bggclient.WithTransport(failingTransport{"/microbadge/99", http.StatusTooManyRequests}))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	if badges, err := GetAll(client); !errors.Is(err, bggclient.ErrRateLimited) || badges != nil {
+		t.Errorf("GetAll when rate limited == %d badges, %v, want ErrRateLimited", len(badges), err)
+	}
+}
+
+func TestGetAllCache(t *testing.T) {
+	server := newServer(t)
+	defer server.Close()
+
+	counter := &countingTransport{statuses: make(map[int]int)}
+	client, err := server.NewClient("alice", bggclient.WithTransport(counter))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+
+	dir := t.TempDir()
+	cache, err := NewCache(dir, time.Hour)
+	if err != nil {
+		t.Fatalf("NewCache: %v", err)
+	}
+
+	first, err := GetAll(client, WithCache(cache), WithWorkers(3))
+	if err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	if got := counter.reset(); got[200] != 5 {
+		t.Errorf("first GetAll fetched %v, want 5 pages", got)
+	}
+
+	second, err := GetAll(client, WithCache(cache))
+	if err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	if got := counter.reset(); len(got) != 0 {
+		t.Errorf("GetAll with a fresh cache fetched %v, want nothing", got)
+	}
+	if !reflect.DeepEqual(second, first) {
+		t.Errorf("cached GetAll == %v, want %v", second, first)
+	}
+
+	// with a zero TTL everything is revalidated, and only the changed badge is sent again
+	server.AddBadge(bggtest.Badge{
+		Number:         99,
+		Name:           "Meeple & Co.",
+		Category:       bggtest.Group{Number: 7, Name: "Fun"},
+		Subcategory:    bggtest.Group{Number: 71, Name: "Meeples"},
+		NumberOfOwners: 13,
+	})
+	stale, err := NewCache(dir, 0)
+	if err != nil {
+		t.Fatalf("NewCache: %v", err)
+	}
+
+	third, err := GetAll(client, WithCache(stale))
+	if err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+	if got := counter.reset(); got[200] != 1 || got[304] != 4 {
+		t.Errorf("revalidating GetAll got %v, want 1 page and 4 not modified", got)
+	}
+	for i := range third {
+		want := first[i]
+		if want.BadgeNumber == 99 {
+			want.NumberOfOwners = 13
+		}
+		if !reflect.DeepEqual(third[i], want) {
+			t.Errorf("revalidated GetAll returned %v, want %v", third[i], want)
+		}
+	}
+}
+
+func TestFetchImages(t *testing.T) {
+	server := newServer(t)
+	defer server.Close()
+	server.AddBadge(bggtest.Badge{Number: 2, Name: "Twin", Image: []byte("GIF89a badge 3")})
+
+	client, err := server.NewClient("alice")
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+
+	badges, err := GetAll(client)
+	if err != nil {
+		t.Fatalf("GetAll: %v", err)
+	}
+
+	store, err := NewImageStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewImageStore: %v", err)
+	}
+	if err := FetchImages(client, store, badges, WithWorkers(2)); err != nil {
+		t.Fatalf("FetchImages: %v", err)
+	}
+
+	filenames := make(map[uint]string)
+	for _, mb := range badges {
+		data, err := ioutil.ReadFile(mb.ImageFilename)
+		if err != nil {
+			t.Fatalf("badge %d: %v", mb.BadgeNumber, err)
+		}
+		if want := fmt.Sprintf("GIF89a badge %d", mb.BadgeNumber); mb.BadgeNumber != 2 && string(data) != want {
+			t.Errorf("image of badge %d == %q, want %q", mb.BadgeNumber, data, want)
+		}
+		if filepath.Ext(mb.ImageFilename) != ".gif" {
+			t.Errorf("image of badge %d stored as %s, want a .gif", mb.BadgeNumber, mb.ImageFilename)
+		}
+		filenames[mb.BadgeNumber] = mb.ImageFilename
+	}
+	if filenames[2] != filenames[3] {
+		t.Errorf("identical images stored as %s and %s", filenames[2], filenames[3])
+	}
+
+	// a second run finds every image in the store, so needs no server
+	server.Close()
+	again := append([]Microbadge(nil), badges...)
+	for i := range again {
+		again[i].ImageFilename = ""
+	}
+	if err := FetchImages(client, store, again); err != nil {
+		t.Fatalf("FetchImages: %v", err)
+	}
+	if !reflect.DeepEqual(again, badges) {
+		t.Errorf("second FetchImages == %v, want %v", again, badges)
+	}
+}
+
+func TestGetReportsFieldErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<img src='/images/microbadges/5.gif'>
+<table>
+<tr><td>Name</td><td>Half a badge</td></tr>
+<tr><td>Group</td><td><a href="/microbadges/group/3" >Gaming</a></td></tr>
+<tr><td>Num Owners</td><td>lots</td></tr>
+<tr><td>Mouseover</td><td>Still here</td></tr>
+</table>`)
+	}))
+	defer server.Close()
+
+	client, err := bggclient.New(bggclient.WithBaseURL(server.URL), bggclient.WithRateLimit(0))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	mb, err := Get(client, 5)
+
+	var metadataErr *MetadataError
+	if !errors.As(err, &metadataErr) {
+		t.Fatalf("Get returned %v, want a *MetadataError", err)
+	}
+	if !errors.Is(err, bggclient.ErrUnexpectedLayout) {
+		t.Errorf("%v is not ErrUnexpectedLayout", err)
+	}
+
+	var fields []string
+	for _, f := range metadataErr.Fields {
+		fields = append(fields, f.Field)
+	}
+	if want := []string{"Category", "NumberOfOwners"}; !reflect.DeepEqual(fields, want) {
+		t.Errorf("Get reported problems with %v, want %v", fields, want)
+	}
+
+	if mb.Name != "Half a badge" || mb.Mouseover != "Still here" || mb.Category != (Group{3, "Gaming"}) {
+		t.Errorf("Get == %+v, want the parseable fields filled in", mb)
+	}
+}
+
+func TestSetAll(t *testing.T) {
+	server := newServer(t)
+	defer server.Close()
+
+	client, err := server.NewClient("alice")
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+
+	numbers := []uint{1234, 99, 2, 3, 4}
+	if _, err := SetAll(client, numbers); err != nil {
+		t.Fatalf("SetAll: %v", err)
+	}
+
+	u, _ := server.User("alice")
+	if !reflect.DeepEqual(u.Slots[:], numbers) {
+		t.Errorf("after SetAll(%v) slots == %v", numbers, u.Slots)
+	}
+
+	if _, err := SetSlot(client, 1, 555); err == nil {
+		t.Errorf("SetSlot with a badge the user does not own succeeded")
+	}
+}
+
+func TestGetSlotsAndClearSlot(t *testing.T) {
+	server := newServer(t)
+	defer server.Close()
+
+	client, err := server.NewClient("alice")
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+
+	if _, err := SetAll(client, []uint{1234, 99, 2, 3, 4}); err != nil {
+		t.Fatalf("SetAll: %v", err)
+	}
+	if err := ClearSlot(client, 3); err != nil {
+		t.Fatalf("ClearSlot: %v", err)
+	}
+
+	slots, err := GetSlots(client)
+	if err != nil {
+		t.Fatalf("GetSlots: %v", err)
+	}
+	image := func(number uint) string {
+		return fmt.Sprintf("%s/images/microbadges/%d.gif", server.URL, number)
+	}
+	want := []Microbadge{
+		{BadgeNumber: 1234, Name: "I play games", ImageURL: image(1234)},
+		{BadgeNumber: 99, Name: "Meeple & Co.", ImageURL: image(99)},
+		{},
+		{BadgeNumber: 3, Name: "Badge 3", ImageURL: image(3)},
+		{BadgeNumber: 4, Name: "Badge 4", ImageURL: image(4)},
+	}
+	if !reflect.DeepEqual(slots, want) {
+		t.Errorf("GetSlots == %v, want %v", slots, want)
+	}
+
+	mb, err := GetSlot(client, 2)
+	if err != nil {
+		t.Fatalf("GetSlot: %v", err)
+	}
+	if !reflect.DeepEqual(mb, want[1]) {
+		t.Errorf("GetSlot(2) == %v, want %v", mb, want[1])
+	}
+
+	if _, err := GetSlot(client, 6); err == nil {
+		t.Errorf("GetSlot(6) succeeded")
+	}
+	if err := ClearSlot(client, 0); err == nil {
+		t.Errorf("ClearSlot(0) succeeded")
+	}
+}
+
+func TestDecodeBadgesFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		version int
+		count   int
+		err     string
+	}{
+		{"original format", `[{"BadgeNumber": 1}, {"BadgeNumber": 2}]`, 0, 2, ""},
+		{"version 1", `{"version": 1, "username": "joe", "badges": [{"BadgeNumber": 1}]}`, 1, 1, ""},
+		{"current format", `{"version": 2, "badges": [{"BadgeNumber": 1}, {"BadgeNumber": 2, "Disowned": "2020-01-01T00:00:00Z"}]}`, 2, 2, ""},
+		{"later version", `{"version": 3, "badges": []}`, 0, 0, "not supported"},
+		{"no version", `{"badges": [{"BadgeNumber": 1}]}`, 0, 0, "no version"},
+		{"duplicate", `[{"BadgeNumber": 1}, {"BadgeNumber": 1}]`, 0, 0, "more than once"},
+		{"no number", `[{"Name": "oops"}]`, 0, 0, "has no number"},
+		{"garbage", `badges`, 0, 0, "not a badges file"},
+	}
+
+	for _, test := range tests {
+		bf, err := DecodeBadgesFile([]byte(test.data))
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: got error %v, want one containing %q", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		if bf.Version != test.version || len(bf.Badges) != test.count {
+			t.Errorf("%s: got version %d with %d badges, want version %d with %d",
+				test.name, bf.Version, len(bf.Badges), test.version, test.count)
+		}
+	}
+}
+
+func TestBadgesFileRoundTrip(t *testing.T) {
+	original := NewBadgesFile("joe", []Microbadge{{BadgeNumber: 1, Name: "one"}, {BadgeNumber: 2, Name: "two"}})
+	original.Version = 0
+
+	data, err := original.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bf, err := DecodeBadgesFile(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bf.Version != BadgesFileVersion {
+		t.Errorf("got version %d, want %d", bf.Version, BadgesFileVersion)
+	}
+	if bf.Username != "joe" || !bf.Fetched.Equal(original.Fetched) {
+		t.Errorf("got %q fetched at %v, want %q at %v", bf.Username, bf.Fetched, "joe", original.Fetched)
+	}
+	if !reflect.DeepEqual(bf.Badges, original.Badges) {
+		t.Errorf("got badges %v, want %v", bf.Badges, original.Badges)
+	}
+}
+
+func TestExtraFields(t *testing.T) {
+	data := `[{"BadgeNumber": 1, "Name": "one", "Notes": "a gift", "weight": 3}]`
+	bf, err := DecodeBadgesFile([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]json.RawMessage{"Notes": json.RawMessage(`"a gift"`), "weight": json.RawMessage(`3`)}
+	if mb := bf.Badges[0]; mb.Name != "one" || !reflect.DeepEqual(mb.Extra, want) {
+		t.Fatalf("got %q with extra fields %v, want %q with %v", mb.Name, mb.Extra, "one", want)
+	}
+
+	encoded, err := bf.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := DecodeBadgesFile(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again.Badges, bf.Badges) {
+		t.Errorf("round trip gave %v, want %v", again.Badges, bf.Badges)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	then := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	notes := map[string]json.RawMessage{"Notes": json.RawMessage(`"keep me"`)}
+
+	bf := &BadgesFile{Version: BadgesFileVersion, Badges: []Microbadge{
+		{BadgeNumber: 1, Name: "same", NumberOfOwners: 10, Acquired: then, Extra: notes},
+		{BadgeNumber: 2, Name: "old name", Acquired: then, ImageFilename: "2.png"},
+		{BadgeNumber: 3, Name: "sold", Acquired: then},
+		{BadgeNumber: 4, Name: "sold before", Acquired: then, Disowned: then},
+		{BadgeNumber: 5, Name: "bought back", Acquired: then, Disowned: then, Extra: notes},
+	}}
+	changes := bf.Merge([]Microbadge{
+		{BadgeNumber: 1, Name: "same", NumberOfOwners: 12},
+		{BadgeNumber: 2, Name: "new name"},
+		{BadgeNumber: 5, Name: "bought back"},
+		{BadgeNumber: 6, Name: "new"},
+	}, now)
+
+	numbers := func(badges []Microbadge) (result []uint) {
+		for _, mb := range badges {
+			result = append(result, mb.BadgeNumber)
+		}
+		return result
+	}
+	if got := numbers(changes.Added); !reflect.DeepEqual(got, []uint{5, 6}) {
+		t.Errorf("added %v, want [5 6]", got)
+	}
+	if got := numbers(changes.Disowned); !reflect.DeepEqual(got, []uint{3}) {
+		t.Errorf("disowned %v, want [3]", got)
+	}
+	if got := numbers(changes.Updated); !reflect.DeepEqual(got, []uint{2}) {
+		t.Errorf("updated %v, want [2]", got)
+	}
+
+	want := []Microbadge{
+		{BadgeNumber: 1, Name: "same", NumberOfOwners: 12, Acquired: then, Extra: notes},
+		{BadgeNumber: 2, Name: "new name", Acquired: then, ImageFilename: "2.png"},
+		{BadgeNumber: 5, Name: "bought back", Acquired: now, Extra: notes},
+		{BadgeNumber: 6, Name: "new", Acquired: now},
+		{BadgeNumber: 3, Name: "sold", Acquired: then, Disowned: now},
+		{BadgeNumber: 4, Name: "sold before", Acquired: then, Disowned: then},
+	}
+	if !reflect.DeepEqual(bf.Badges, want) {
+		t.Errorf("got badges\n%v\nwant\n%v", bf.Badges, want)
+	}
+	if got := numbers(bf.Owned()); !reflect.DeepEqual(got, []uint{1, 2, 5, 6}) {
+		t.Errorf("owned %v, want [1 2 5 6]", got)
+	}
+	if !bf.Fetched.Equal(now) {
+		t.Errorf("fetched at %v, want %v", bf.Fetched, now)
+	}
+
+	if changes := bf.Merge([]Microbadge{{BadgeNumber: 1, Name: "same", NumberOfOwners: 15}, {BadgeNumber: 2, Name: "new name"},
+		{BadgeNumber: 5, Name: "bought back"}, {BadgeNumber: 6, Name: "new"}}, now); !changes.Empty() {
+		t.Errorf("merging the same badges again gave %+v, want no changes", changes)
+	}
+}
+
+func TestMergeKeepsStoredDetails(t *testing.T) {
+	then := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	stored := Microbadge{BadgeNumber: 1, Name: "Meeple", Category: Group{1, "Games"}, Subcategory: Group{2, "Euro"},
+		NumberOfOwners: 10, Creator: "someone", ImageURL: "https://example.com/1.png", RelatedBadges: []uint{2}, Acquired: then}
+
+	tests := []struct {
+		name     string
+		incoming Microbadge
+		want     Microbadge
+		updated  bool
+	}{
+		{"nothing parsed", Microbadge{BadgeNumber: 1}, stored, false},
+		{"groups missing", Microbadge{BadgeNumber: 1, Name: "Meeple", NumberOfOwners: 12},
+			func() Microbadge { mb := stored; mb.NumberOfOwners = 12; return mb }(), false},
+		{"renamed", Microbadge{BadgeNumber: 1, Name: "Big Meeple"},
+			func() Microbadge { mb := stored; mb.Name = "Big Meeple"; return mb }(), true},
+		{"moved", Microbadge{BadgeNumber: 1, Subcategory: Group{3, "Ameritrash"}},
+			func() Microbadge { mb := stored; mb.Subcategory = Group{3, "Ameritrash"}; return mb }(), true},
+	}
+
+	for _, test := range tests {
+		bf := &BadgesFile{Version: BadgesFileVersion, Badges: []Microbadge{stored}}
+		changes := bf.Merge([]Microbadge{test.incoming}, now)
+		if !reflect.DeepEqual(bf.Badges, []Microbadge{test.want}) {
+			t.Errorf("%s: got %v, want %v", test.name, bf.Badges, []Microbadge{test.want})
+		}
+		if updated := len(changes.Updated) > 0; updated != test.updated {
+			t.Errorf("%s: updated is %t, want %t", test.name, updated, test.updated)
+		}
+	}
+}
+
+func TestProvider(t *testing.T) {
+	server := bggtest.NewServer()
+	defer server.Close()
+	server.AddBadge(bggtest.Badge{
+		Number:      1234,
+		Name:        "I play games",
+		Category:    bggtest.Group{Number: 3, Name: "Gaming"},
+		Subcategory: bggtest.Group{Number: 31, Name: "General"},
+		Mouseover:   "Games & more games",
+	})
+	server.AddBadge(bggtest.Badge{
+		Number:      42,
+		Name:        "Meeple",
+		Category:    bggtest.Group{Number: 3, Name: "Gaming"},
+		Subcategory: bggtest.Group{Number: 31, Name: "General"},
+	})
+	server.AddUser(bggtest.User{Username: "alice", PassHash: "hash"})
+
+	client, err := server.NewClient("alice")
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	cache, err := NewCache(t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatalf("NewCache: %v", err)
+	}
+	store, err := NewImageStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewImageStore: %v", err)
+	}
+
+	tests := []struct {
+		text string
+		want string
+		err  bool
+	}{
+		{text: "[MB1234]: [MBOM1234]", want: "I play games: Games & more games"},
+		{text: "[MB:42] says [MBOM42]", want: "Meeple says "},
+		{text: "[MBI42][MBI1234][MBI42]", want: ""},
+		{text: "[MB999]", err: true},
+		{text: "[MB:x]", err: true},
+	}
+
+	p := NewProvider(client, store, WithCache(cache))
+	engine := parser.New(parser.WithProvider(p))
+	for _, test := range tests {
+		got, err := engine.Expand(context.Background(), test.text)
+		if test.err {
+			if err == nil {
+				t.Errorf("Expand(%q) == %q, want an error", test.text, got)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("Expand(%q) == %q, %v, want %q", test.text, got, err, test.want)
+		}
+	}
+
+	images := p.Images()
+	if len(images) != 2 || images[0].BadgeNumber != 42 || images[1].BadgeNumber != 1234 {
+		t.Fatalf("Images() == %+v, want badges 42 and 1234", images)
+	}
+	for _, mb := range images {
+		data, err := ioutil.ReadFile(mb.ImageFilename)
+		if err != nil || string(data) != fmt.Sprintf("GIF89a badge %d", mb.BadgeNumber) {
+			t.Errorf("image of badge# %d == %q, %v", mb.BadgeNumber, data, err)
+		}
+	}
+
+	// a new provider, as for the next template, finds the badges in the cache
+	server.Close()
+	got, err := parser.New(parser.WithProvider(NewProvider(client, nil, WithCache(cache)))).Expand(context.Background(), "[MB1234]")
+	if err != nil || got != "I play games" {
+		t.Errorf("Expand from the cache == %q, %v", got, err)
+	}
+
+	// without a store, there is nowhere to put images
+	if _, err := parser.New(parser.WithProvider(NewProvider(client, nil))).Expand(context.Background(), "[MBI1234]"); err == nil {
+		t.Error("Expand([MBI1234]) without a store succeeded")
+	}
+}
+
+// Local Variables:
+// compile-command: "go test"
+// End:
@@ -0,0 +1,154 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package microbadge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/profburke/bgurt/bggclient"
+	"github.com/profburke/bgurt/parser"
+)
+
+// Provider supplies the text tags (see the parser package) that refer to a
+// microbadge by its number:
+//
+//	[MB1234]    the badge's name
+//	[MBOM1234]  its mouseover text
+//	[MBI1234]   its image, which can't be part of text: the tag expands to nothing
+//	            and the badge is added to Images, to be drawn into an avatar
+//
+// Images are only drawn into avatars (see avatar.Compose): a geekbadge is
+// colors and text set through a form, with no image to draw into.
+//
+// Each badge is fetched once, through the cache if one is given with WithCache.
+//
+type Provider struct {
+	client  *bggclient.Client
+	store   *ImageStore
+	options []FetchOption
+
+	mu     sync.Mutex
+	badges map[uint]Microbadge
+	images []Microbadge
+}
+
+// NewProvider returns a provider of the microbadge tags. Images are downloaded into
+// store; with no store, [MBI1234] is an error.
+//
+func NewProvider(client *bggclient.Client, store *ImageStore, options ...FetchOption) *Provider {
+	return &Provider{client: client, store: store, options: options, badges: make(map[uint]Microbadge)}
+}
+
+// Tags returns the tags the provider supplies.
+//
+func (p *Provider) Tags() map[string]parser.Func {
+	return map[string]parser.Func{
+		"MB":   p.name,
+		"MBOM": p.mouseover,
+		"MBI":  p.image,
+	}
+}
+
+// Images returns the badges the [MBI1234] tags expanded so far referred to, in
+// the order they first appeared, with ImageFilename set.
+//
+func (p *Provider) Images() []Microbadge {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]Microbadge(nil), p.images...)
+}
+
+// badge returns the badge the tag's argument names. A badge whose page could only
+// partly be parsed is still returned, as long as it has a name.
+//
+func (p *Provider) badge(ctx context.Context, tag parser.Tag) (Microbadge, error) {
+	number, err := strconv.ParseUint(tag.Arg, 10, 64)
+	if err != nil || number == 0 {
+		return Microbadge{}, fmt.Errorf("bad badge number %q", tag.Arg)
+	}
+
+	if mb, ok := p.badges[uint(number)]; ok {
+		return mb, nil
+	}
+
+	mb, err := GetContext(ctx, p.client, uint(number), p.options...)
+	var metadataErr *MetadataError
+	if err != nil && !(errors.As(err, &metadataErr) && mb.Name != "") {
+		return Microbadge{}, err
+	}
+	p.badges[mb.BadgeNumber] = mb
+
+	return mb, nil
+}
+
+func (p *Provider) name(ctx context.Context, tag parser.Tag) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	mb, err := p.badge(ctx, tag)
+
+	return mb.Name, err
+}
+
+func (p *Provider) mouseover(ctx context.Context, tag parser.Tag) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	mb, err := p.badge(ctx, tag)
+
+	return mb.Mouseover, err
+}
+
+func (p *Provider) image(ctx context.Context, tag parser.Tag) (string, error) {
+	if p.store == nil {
+		return "", errors.New("badge images can only be drawn into an avatar (see av-set -overlay)")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	mb, err := p.badge(ctx, tag)
+	if err != nil {
+		return "", err
+	}
+	for _, image := range p.images {
+		if image.BadgeNumber == mb.BadgeNumber {
+			return "", nil
+		}
+	}
+
+	if mb, err = FetchImageContext(ctx, p.client, p.store, mb); err != nil {
+		return "", err
+	}
+	p.images = append(p.images, mb)
+
+	return "", nil
+}
+
+// Local Variables:
+// compile-command: "go build"
+// End:
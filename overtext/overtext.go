@@ -26,8 +26,9 @@
 package overtext
 
 import (
-	"errors"
+	"context"
 	"fmt"
+	"html"
 	"log"
 	"net/url"
 	"regexp"
@@ -41,7 +42,15 @@ type Overtext struct {
 }
 
 func (o Overtext) String() string {
-	return fmt.Sprintf("avatar: %s\nbadge: %s", o.Avatar, o.Badge)
+	var avatar, badge string
+	if o.Avatar != nil {
+		avatar = *o.Avatar
+	}
+	if o.Badge != nil {
+		badge = *o.Badge
+	}
+
+	return fmt.Sprintf("avatar: %s\nbadge: %s", avatar, badge)
 }
 
 var avatarOvertextRegEx *regexp.Regexp
@@ -50,8 +59,8 @@ var editOvertextURL *url.URL
 var overtextFormURL *url.URL
 
 func init() {
-	avatarOvertextRegEx = regexp.MustCompile("name=\"overtext\\[avatar\\]\"\\s*?value=\"(.*)\"")
-	badgeOvertextRegEx = regexp.MustCompile("name=\"overtext\\[badge\\]\"\\s*?value=\"(.*)\"")
+	avatarOvertextRegEx = regexp.MustCompile("name=\"overtext\\[avatar\\]\"\\s*?value=\"([^\"]*)\"")
+	badgeOvertextRegEx = regexp.MustCompile("name=\"overtext\\[badge\\]\"\\s*?value=\"([^\"]*)\"")
 	var err error
 
 	editOvertextURL, err = url.Parse("geekaccount/edit/overtext")
@@ -72,43 +81,55 @@ func init() {
 // is "dumb" in that regards. That is, it's the calling functions responsibility to handle
 // not deleting/overwriting overtext. Set will just set exactly what it's called with.
 //
-func Set(overtext Overtext) (success bool, err error) {
+func Set(client *bggclient.Client, overtext Overtext) (success bool, err error) {
+	return SetContext(context.Background(), client, overtext)
+}
+
+// SetContext is like Set but gives up when ctx is done.
+//
+func SetContext(ctx context.Context, client *bggclient.Client, overtext Overtext) (success bool, err error) {
 	data := url.Values{}
 	data.Set("action", "saveovertext")
 	data.Set("overtext[avatar]", *overtext.Avatar)
 	data.Set("overtext[badge]", *overtext.Badge)
 
-	resp, err := bggclient.Post(overtextFormURL, data)
+	resp, err := client.PostContext(ctx, overtextFormURL, data)
 	if err != nil {
-		return false, err
+		return false, fmt.Errorf("overtext.Set: %w", err)
 	}
+	resp.Body.Close()
 	success = resp.StatusCode == 200
 	return
 }
 
 // Get user's overtext.
 //
-func Get() (overtext Overtext, err error) {
-	page, err := bggclient.Get(editOvertextURL)
+func Get(client *bggclient.Client) (overtext Overtext, err error) {
+	return GetContext(context.Background(), client)
+}
+
+// GetContext is like Get but gives up when ctx is done.
+//
+func GetContext(ctx context.Context, client *bggclient.Client) (overtext Overtext, err error) {
+	page, err := client.GetContext(ctx, editOvertextURL)
 	if err != nil {
-		message := fmt.Sprintf("overtext.Get: could not get edit avatar page: %v", err)
-		return Overtext{}, errors.New(message)
+		return Overtext{}, fmt.Errorf("overtext.Get: could not get edit avatar page: %w", err)
 	}
 
 	pieces := avatarOvertextRegEx.FindStringSubmatch(page)
 
 	if len(pieces) != 2 {
-		return Overtext{}, errors.New("overtext.Get: could not parse avatar overtext")
+		return Overtext{}, &bggclient.LayoutError{Op: "overtext.Get", What: "avatar overtext"}
 	}
 
-	avatarOvertext := pieces[1]
+	avatarOvertext := html.UnescapeString(pieces[1])
 
 	pieces = badgeOvertextRegEx.FindStringSubmatch(page)
 	if len(pieces) != 2 {
-		return Overtext{}, errors.New("overtext.Get: could not parse badge overtext")
+		return Overtext{}, &bggclient.LayoutError{Op: "overtext.Get", What: "badge overtext"}
 	}
 
-	badgeOvertext := pieces[1]
+	badgeOvertext := html.UnescapeString(pieces[1])
 
 	return Overtext{
 		Avatar: &avatarOvertext,
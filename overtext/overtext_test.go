@@ -0,0 +1,77 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package overtext
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/profburke/bgurt/bggclient"
+	"github.com/profburke/bgurt/bggclient/bggtest"
+)
+
+func TestSetAndGet(t *testing.T) {
+	server := bggtest.NewServer()
+	defer server.Close()
+	server.AddUser(bggtest.User{Username: "alice", PassHash: "hash"})
+
+	client, err := server.NewClient("alice")
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+
+	avatarOvertext := "Can sour cream go bad?"
+	badgeOvertext := `Go "Speed" Racer!`
+
+	if _, err := Set(client, Overtext{Avatar: &avatarOvertext, Badge: &badgeOvertext}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	got, err := Get(client)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if *got.Avatar != avatarOvertext || *got.Badge != badgeOvertext {
+		t.Errorf("Get() == (%q, %q), want (%q, %q)", *got.Avatar, *got.Badge, avatarOvertext, badgeOvertext)
+	}
+}
+
+func TestGetWithBadCredentials(t *testing.T) {
+	server := bggtest.NewServer()
+	defer server.Close()
+	server.AddUser(bggtest.User{Username: "alice", PassHash: "hash"})
+
+	client, err := server.NewClient("alice",
+		bggclient.WithCredentials(bggclient.Credentials{Username: "alice", PassHash: "stale"}))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+
+	_, err = Get(client)
+	if !errors.Is(err, bggclient.ErrNotAuthenticated) {
+		t.Errorf("Get() returned %v, want ErrNotAuthenticated", err)
+	}
+}
+
+// Local Variables:
+// compile-command: "go test"
+// End:
@@ -1,10 +1,44 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package parser expands the tags in overtext and geekbadge text: "Essen in [C]
+// days!" becomes "Essen in 4 days!". The tags are those of BGG Randomizer (see its
+// HOWTO, quoted below), though which ones are available depends on the providers
+// given to New.
+//
+// A tag is a name in square brackets. Its argument, if it has one, either follows
+// the name after a colon, as in [C:2026-10-22], or is the number at the end of
+// it, as in [MB1234]. A "[[" stands for a literal "[".
+//
 package parser
 
-// This file will include function(s) to parse tags in overtext strings,
-// replacing the tag with the appropriate value.
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
 
-// In https://boardgamegeek.com/thread/501653/bgg-randomizer-periodically-randomize-your-desktop/page/1
-// supported tags are
+// The tags supported by BGG Randomizer, from its HOWTO at
+// https://boardgamegeek.com/thread/501653/bgg-randomizer-periodically-randomize-your-desktop/page/1
 
 /*
 
@@ -91,9 +125,291 @@ Here are some more possibilites:
 
 */
 
-// TODO: should also be able to parse text for geek badges
-// -- maybe move this out of overtext library and into utilities?
+// Token is a piece of a template: either literal text, or a tag to be replaced.
+//
+type Token struct {
+	Text string // the literal text or, for a tag, what is between the brackets
+	Tag  bool
+	Pos  int // byte offset of the token in the template
+}
+
+// SyntaxError reports a template that can't be split into tokens.
+//
+type SyntaxError struct {
+	Pos     int
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("parser: %s at offset %d", e.Message, e.Pos)
+}
+
+// Tokenize splits text into literal text and tags.
+//
+func Tokenize(text string) (tokens []Token, err error) {
+	return tokenize(text, nil)
+}
+
+// tokenize is Tokenize, except that with a report function a "[" that doesn't
+// start a tag is kept as literal text, and reported, rather than an error.
+//
+func tokenize(text string, report func(text string, pos int)) (tokens []Token, err error) {
+	var literal strings.Builder
+	literalPos := 0
+	flush := func() {
+		if literal.Len() > 0 {
+			tokens = append(tokens, Token{Text: literal.String(), Pos: literalPos})
+			literal.Reset()
+		}
+	}
+
+	for i := 0; i < len(text); {
+		if text[i] != '[' {
+			if literal.Len() == 0 {
+				literalPos = i
+			}
+			literal.WriteByte(text[i])
+			i++
+			continue
+		}
+
+		if strings.HasPrefix(text[i:], "[[") {
+			if literal.Len() == 0 {
+				literalPos = i
+			}
+			literal.WriteByte('[')
+			i += 2
+			continue
+		}
+
+		end := strings.IndexAny(text[i+1:], "[]\n")
+		var message string
+		switch {
+		case end < 0 || text[i+1+end] != ']':
+			message = "unclosed tag"
+		case end == 0:
+			message = "empty tag"
+		}
+		if message != "" {
+			if report == nil {
+				return nil, &SyntaxError{Pos: i, Message: message}
+			}
+			report("[", i)
+			if literal.Len() == 0 {
+				literalPos = i
+			}
+			literal.WriteByte('[')
+			i++
+			continue
+		}
+
+		flush()
+		tokens = append(tokens, Token{Text: text[i+1 : i+1+end], Tag: true, Pos: i})
+		i += end + 2
+	}
+	flush()
+
+	return tokens, nil
+}
+
+// Tag is a tag being expanded.
+//
+type Tag struct {
+	Name string // the name the tag was registered under, e.g. "MB"
+	Arg  string // its argument, e.g. "1234" for [MB1234]; empty if it has none
+	Pos  int    // byte offset of the tag in the template
+}
+
+func (t Tag) String() string {
+	if t.Arg == "" {
+		return "[" + t.Name + "]"
+	}
+
+	return "[" + t.Name + ":" + t.Arg + "]"
+}
+
+// Func returns the value of a tag.
+//
+type Func func(ctx context.Context, tag Tag) (value string, err error)
+
+// Provider supplies the values of a family of tags, such as the statistics on a
+// user's profile. Providers that fetch their data should do so once, when one of
+// their tags is first expanded, rather than when they are created.
+//
+type Provider interface {
+	// Tags returns the tags the provider supplies, by name.
+	Tags() map[string]Func
+}
+
+// Option configures New.
+//
+type Option func(e *Engine)
+
+// WithProvider adds the tags supplied by p. A tag supplied by more than one
+// provider comes from the last of them.
+//
+func WithProvider(p Provider) Option {
+	return func(e *Engine) {
+		for name, f := range p.Tags() {
+			e.funcs[name] = f
+		}
+	}
+}
+
+// WithTag adds a single tag.
+//
+func WithTag(name string, f Func) Option {
+	return func(e *Engine) {
+		e.funcs[name] = f
+	}
+}
+
+// WithUnknown makes Expand keep unknown tags, and brackets that don't make a tag,
+// as they are written instead of failing, calling report (if it isn't nil) with
+// each one and its offset. Check still reports them.
+//
+func WithUnknown(report func(text string, pos int)) Option {
+	return func(e *Engine) {
+		if report == nil {
+			report = func(text string, pos int) {}
+		}
+		e.unknown = report
+	}
+}
+
+// Engine expands the tags in templates.
+//
+type Engine struct {
+	funcs   map[string]Func
+	unknown func(text string, pos int)
+}
+
+// New returns an engine that knows the tags of the given providers, as well as
+// [LF], a line feed.
+//
+func New(options ...Option) *Engine {
+	e := &Engine{funcs: map[string]Func{
+		"LF": func(ctx context.Context, tag Tag) (string, error) { return "\n", nil },
+	}}
+	for _, option := range options {
+		option(e)
+	}
+
+	return e
+}
+
+// Tags returns the names of the tags the engine knows, sorted.
+//
+func (e *Engine) Tags() (names []string) {
+	for name := range e.funcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
 
-func Parse(text string) (result string) {
-	return "dude"
+	return names
 }
+
+// resolve finds the function for the tag written as text: a known name, perhaps
+// followed by a colon and an argument or by a number. The longest name that
+// matches wins, so [MBOM12] is MBOM's even though MB is known too.
+//
+func (e *Engine) resolve(text string, pos int) (tag Tag, f Func, err error) {
+	name, arg := text, ""
+	if colon := strings.IndexByte(text, ':'); colon >= 0 {
+		name, arg = text[:colon], text[colon+1:]
+	}
+	if f, ok := e.funcs[name]; ok {
+		return Tag{Name: name, Arg: arg, Pos: pos}, f, nil
+	}
+
+	if arg == "" {
+		for end := len(name) - 1; end > 0; end-- {
+			if !isDigits(name[end:]) {
+				break
+			}
+			if f, ok := e.funcs[name[:end]]; ok {
+				return Tag{Name: name[:end], Arg: name[end:], Pos: pos}, f, nil
+			}
+		}
+	}
+
+	return Tag{}, nil, fmt.Errorf("unknown tag [%s] at offset %d", text, pos)
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return s != ""
+}
+
+// Check reports whether text is a template the engine can expand, without
+// expanding it.
+//
+func (e *Engine) Check(text string) error {
+	tokens, err := Tokenize(text)
+	if err != nil {
+		return fmt.Errorf("parser.Check: %w", err)
+	}
+
+	for _, token := range tokens {
+		if !token.Tag {
+			continue
+		}
+		if _, _, err := e.resolve(token.Text, token.Pos); err != nil {
+			return fmt.Errorf("parser.Check: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Expand replaces the tags in text with their values. Nothing is expanded unless
+// every tag is known (or WithUnknown says what to do with the others).
+//
+func (e *Engine) Expand(ctx context.Context, text string) (result string, err error) {
+	tokens, err := tokenize(text, e.unknown)
+	if err != nil {
+		return "", fmt.Errorf("parser.Expand: %w", err)
+	}
+
+	tags := make([]Tag, len(tokens))
+	funcs := make([]Func, len(tokens))
+	for i, token := range tokens {
+		if token.Tag {
+			if tags[i], funcs[i], err = e.resolve(token.Text, token.Pos); err != nil {
+				if e.unknown == nil {
+					return "", fmt.Errorf("parser.Expand: %w", err)
+				}
+				e.unknown("["+token.Text+"]", token.Pos)
+			}
+		}
+	}
+
+	var b strings.Builder
+	for i, token := range tokens {
+		if !token.Tag {
+			b.WriteString(token.Text)
+			continue
+		}
+		if funcs[i] == nil {
+			b.WriteString("[" + token.Text + "]")
+			continue
+		}
+
+		value, err := funcs[i](ctx, tags[i])
+		if err != nil {
+			return "", fmt.Errorf("parser.Expand: %v: %w", tags[i], err)
+		}
+		b.WriteString(value)
+	}
+
+	return b.String(), nil
+}
+
+// Local Variables:
+// compile-command: "go build"
+// End:
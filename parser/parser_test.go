@@ -0,0 +1,170 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text   string
+		tokens []Token
+		err    string
+	}{
+		{"plain", []Token{{Text: "plain"}}, ""},
+		{"Essen in [C] days!", []Token{{Text: "Essen in "}, {Text: "C", Tag: true, Pos: 9}, {Text: " days!", Pos: 12}}, ""},
+		{"[THG][LF][THR]", []Token{{Text: "THG", Tag: true}, {Text: "LF", Tag: true, Pos: 5}, {Text: "THR", Tag: true, Pos: 9}}, ""},
+		{"a [[b] c]", []Token{{Text: "a [b] c]"}}, ""},
+		{"oops [C", nil, "unclosed tag at offset 5"},
+		{"[C [LF]", nil, "unclosed tag at offset 0"},
+		{"x []", nil, "empty tag at offset 2"},
+	}
+
+	for _, test := range tests {
+		tokens, err := Tokenize(test.text)
+		if test.err != "" {
+			var syntaxErr *SyntaxError
+			if !errors.As(err, &syntaxErr) || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("Tokenize(%q) gave error %v, want a syntax error containing %q", test.text, err, test.err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(tokens, test.tokens) {
+			t.Errorf("Tokenize(%q) == %+v, %v, want %+v", test.text, tokens, err, test.tokens)
+		}
+	}
+}
+
+// badges is a provider of microbadge names, counting how often it is asked.
+//
+type badges struct {
+	calls int
+}
+
+func (b *badges) Tags() map[string]Func {
+	name := func(ctx context.Context, tag Tag) (string, error) {
+		b.calls++
+		if tag.Arg == "" {
+			return "", errors.New("which badge?")
+		}
+		return "badge " + tag.Arg, nil
+	}
+	mouseover := func(ctx context.Context, tag Tag) (string, error) {
+		b.calls++
+		return "mouseover " + tag.Arg, nil
+	}
+
+	return map[string]Func{"MB": name, "MBOM": mouseover}
+}
+
+func TestExpand(t *testing.T) {
+	provider := &badges{}
+	engine := New(WithProvider(provider), WithTag("C", func(ctx context.Context, tag Tag) (string, error) {
+		if tag.Arg == "" {
+			return "4", nil
+		}
+		return "until " + tag.Arg, nil
+	}))
+
+	tests := []struct {
+		text   string
+		result string
+		err    string
+	}{
+		{"Essen in [C] days!", "Essen in 4 days!", ""},
+		{"[C:2026-10-22]", "until 2026-10-22", ""},
+		{"GIVEN:[MB12][LF]RECEIVED:[MBOM345]", "GIVEN:badge 12\nRECEIVED:mouseover 345", ""},
+		{"[[MB12]", "[MB12]", ""},
+		{"[MB:7]", "badge 7", ""},
+		{"[MB]", "", "[MB]: which badge?"},
+		{"[MBX12]", "", "unknown tag [MBX12] at offset 0"},
+		{"[MB1] and [THG]", "", "unknown tag [THG]"},
+	}
+
+	for _, test := range tests {
+		result, err := engine.Expand(context.Background(), test.text)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("Expand(%q) gave error %v, want one containing %q", test.text, err, test.err)
+			}
+			continue
+		}
+		if err != nil || result != test.result {
+			t.Errorf("Expand(%q) == %q, %v, want %q", test.text, result, err, test.result)
+		}
+	}
+
+	// [MB1] and [THG]: nothing is expanded when a tag is unknown
+	if provider.calls != 4 {
+		t.Errorf("provider was asked %d times, want 4", provider.calls)
+	}
+
+	if err := engine.Check("[THR]"); err == nil {
+		t.Errorf("Check([THR]) succeeded")
+	}
+	if got, want := engine.Tags(), []string{"C", "LF", "MB", "MBOM"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Tags() == %v, want %v", got, want)
+	}
+}
+
+func TestExpandWithUnknown(t *testing.T) {
+	var reported []string
+	engine := New(WithProvider(&badges{}), WithUnknown(func(text string, pos int) {
+		reported = append(reported, fmt.Sprintf("%s@%d", text, pos))
+	}))
+
+	tests := []struct {
+		text     string
+		result   string
+		reported []string
+	}{
+		{"[MB1] and [THG]", "badge 1 and [THG]", []string{"[THG]@10"}},
+		{"[sic] [MB:2]", "[sic] badge 2", []string{"[sic]@0"}},
+		{"a [ b [] c [MB3", "a [ b [] c [MB3", []string{"[@2", "[@6", "[@11"}},
+		{"[[LF]", "[LF]", nil},
+	}
+
+	for _, test := range tests {
+		reported = nil
+		result, err := engine.Expand(context.Background(), test.text)
+		if err != nil || result != test.result {
+			t.Errorf("Expand(%q) == %q, %v, want %q", test.text, result, err, test.result)
+		}
+		if !reflect.DeepEqual(reported, test.reported) {
+			t.Errorf("Expand(%q) reported %v, want %v", test.text, reported, test.reported)
+		}
+	}
+
+	if err := engine.Check("[THG]"); err == nil {
+		t.Errorf("Check([THG]) succeeded")
+	}
+}
+
+// Local Variables:
+// compile-command: "go test"
+// End:
@@ -0,0 +1,226 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package profile retrieves the figures shown on the user's profile page: thumbs
+// given and received, GeekGold, posts, and when the account was registered and
+// last used. It also supplies text tags (see the parser package) for them.
+//
+package profile
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/profburke/bgurt/bggclient"
+	"github.com/profburke/bgurt/parser"
+)
+
+// Stats are the figures on a profile page. Posts and LastLogin are zero when the
+// page leaves them out.
+//
+type Stats struct {
+	Username       string    `json:"username,omitempty"`
+	Registered     time.Time `json:"registered"`
+	LastLogin      time.Time `json:"last_login"`
+	GeekGold       float64   `json:"geekgold"`
+	ThumbsGiven    uint      `json:"thumbs_given"`
+	ThumbsReceived uint      `json:"thumbs_received"`
+	Posts          uint      `json:"posts"`
+}
+
+// Years returns the number of whole years the account had been registered at now.
+//
+func (s Stats) Years(now time.Time) int {
+	years := now.Year() - s.Registered.Year()
+	if now.Month() < s.Registered.Month() || now.Month() == s.Registered.Month() && now.Day() < s.Registered.Day() {
+		years--
+	}
+	if years < 0 {
+		return 0
+	}
+
+	return years
+}
+
+var profileURL *url.URL
+var statsRowRegEx *regexp.Regexp
+var usernameRegEx *regexp.Regexp
+
+func init() {
+	// The figures are a table of <td>label</td> <td>value</td> rows.
+	statsRowRegEx = regexp.MustCompile("(?s:<td>([^<]+)</td>\\s*<td>(.*?)</td>)")
+	usernameRegEx = regexp.MustCompile("<div class='profile_username'>([^<]*)</div>")
+
+	var err error
+	profileURL, err = url.Parse("myprofile")
+	if err != nil {
+		log.Fatal("profile: could not create profile URL")
+	}
+}
+
+// GetStats retrieves the figures on the user's profile page.
+//
+func GetStats(client *bggclient.Client) (stats Stats, err error) {
+	return GetStatsContext(context.Background(), client)
+}
+
+// GetStatsContext is like GetStats but gives up when ctx is done.
+//
+func GetStatsContext(ctx context.Context, client *bggclient.Client) (stats Stats, err error) {
+	page, err := client.GetContext(ctx, profileURL)
+	if err != nil {
+		return Stats{}, fmt.Errorf("profile.GetStats: could not get page: %w", err)
+	}
+
+	return parseStats(page)
+}
+
+// parseStats reads the figures from a profile page. Thumbs, GeekGold and the
+// registration date are required; the rest are filled in if present.
+//
+func parseStats(page string) (stats Stats, err error) {
+	rows := make(map[string]string)
+	for _, match := range statsRowRegEx.FindAllStringSubmatch(page, -1) {
+		label := strings.TrimSpace(match[1])
+		if _, ok := rows[label]; !ok {
+			rows[label] = bggclient.Text(match[2])
+		}
+	}
+
+	missing := func(what string) error {
+		return &bggclient.LayoutError{Op: "profile.GetStats", What: what}
+	}
+
+	if match := usernameRegEx.FindStringSubmatch(page); match != nil {
+		stats.Username = bggclient.Text(match[1])
+	}
+
+	var ok bool
+	if stats.Registered, ok = parseDate(rows["Registered"]); !ok {
+		return Stats{}, missing("registration date")
+	}
+	if stats.GeekGold, err = strconv.ParseFloat(withoutCommas(rows["GeekGold"]), 64); err != nil {
+		return Stats{}, missing("geekgold")
+	}
+	if stats.ThumbsGiven, ok = parseCount(rows["Thumbs Given"]); !ok {
+		return Stats{}, missing("thumbs given")
+	}
+	if stats.ThumbsReceived, ok = parseCount(rows["Thumbs Received"]); !ok {
+		return Stats{}, missing("thumbs received")
+	}
+
+	stats.LastLogin, _ = parseDate(rows["Last Login"])
+	stats.Posts, _ = parseCount(rows["Posts"])
+
+	return stats, nil
+}
+
+func withoutCommas(s string) string {
+	return strings.Replace(s, ",", "", -1)
+}
+
+// parseCount reads a count such as "1,234".
+//
+func parseCount(s string) (uint, bool) {
+	n, err := strconv.ParseUint(withoutCommas(s), 10, 64)
+
+	return uint(n), err == nil
+}
+
+// parseDate reads a date written either way BGG writes them.
+//
+func parseDate(s string) (time.Time, bool) {
+	for _, layout := range []string{"2006-01-02", "Jan 2, 2006"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// Provider supplies the text tags for the user's profile figures:
+//
+//	[THG]    thumbs given
+//	[THR]    thumbs received
+//	[GG]     GeekGold, to two decimal places
+//	[POSTS]  posts
+//	[YRS]    whole years since the account was registered
+//
+// The profile page is fetched once, when one of the tags is first expanded.
+//
+type Provider struct {
+	client *bggclient.Client
+	now    func() time.Time
+
+	mu    sync.Mutex
+	stats *Stats
+}
+
+// NewProvider returns a provider of the tags for the user client is logged in as.
+//
+func NewProvider(client *bggclient.Client) *Provider {
+	return &Provider{client: client, now: time.Now}
+}
+
+// Tags returns the tags the provider supplies.
+//
+func (p *Provider) Tags() map[string]parser.Func {
+	count := func(n uint) string { return strconv.FormatUint(uint64(n), 10) }
+
+	return map[string]parser.Func{
+		"THG":   p.figure(func(s Stats) string { return count(s.ThumbsGiven) }),
+		"THR":   p.figure(func(s Stats) string { return count(s.ThumbsReceived) }),
+		"GG":    p.figure(func(s Stats) string { return strconv.FormatFloat(s.GeekGold, 'f', 2, 64) }),
+		"POSTS": p.figure(func(s Stats) string { return count(s.Posts) }),
+		"YRS":   p.figure(func(s Stats) string { return strconv.Itoa(s.Years(p.now())) }),
+	}
+}
+
+// figure returns a tag giving what format makes of the profile's figures.
+//
+func (p *Provider) figure(format func(Stats) string) parser.Func {
+	return func(ctx context.Context, tag parser.Tag) (string, error) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		if p.stats == nil {
+			stats, err := GetStatsContext(ctx, p.client)
+			if err != nil {
+				return "", err
+			}
+			p.stats = &stats
+		}
+
+		return format(*p.stats), nil
+	}
+}
+
+// Local Variables:
+// compile-command: "go build"
+// End:
@@ -0,0 +1,172 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package profile
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/profburke/bgurt/bggclient"
+	"github.com/profburke/bgurt/bggclient/bggtest"
+	"github.com/profburke/bgurt/parser"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+
+	return t
+}
+
+func TestGetStats(t *testing.T) {
+	server := bggtest.NewServer()
+	defer server.Close()
+	server.AddUser(bggtest.User{Username: "alice", PassHash: "hash", Stats: bggtest.Stats{
+		Registered:     "2008-03-14",
+		LastLogin:      "2026-10-17",
+		GeekGold:       1234.5,
+		ThumbsGiven:    12345,
+		ThumbsReceived: 678,
+		Posts:          1001,
+	}})
+
+	client, err := server.NewClient("alice")
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+
+	got, err := GetStats(client)
+	if err != nil {
+		t.Fatalf("GetStats: %v", err)
+	}
+	want := Stats{
+		Username:       "alice",
+		Registered:     date("2008-03-14"),
+		LastLogin:      date("2026-10-17"),
+		GeekGold:       1234.5,
+		ThumbsGiven:    12345,
+		ThumbsReceived: 678,
+		Posts:          1001,
+	}
+	if got != want {
+		t.Errorf("GetStats() == %+v, want %+v", got, want)
+	}
+}
+
+func TestParseStats(t *testing.T) {
+	tests := []struct {
+		page string
+		want Stats
+		err  bool
+	}{
+		{
+			page: `<td>Registered</td><td>Mar 14, 2008</td>
+<td>GeekGold</td><td><a href="/geekgold">12.00</a></td>
+<td>Thumbs Given</td><td>1,234</td>
+<td>Thumbs Received</td><td>5</td>`,
+			want: Stats{Registered: date("2008-03-14"), GeekGold: 12, ThumbsGiven: 1234, ThumbsReceived: 5},
+		},
+		{
+			page: `<td>Registered</td><td>2008-03-14</td>
+<td>GeekGold</td><td>12.00</td>
+<td>Thumbs Received</td><td>5</td>`,
+			err: true,
+		},
+		{
+			page: `<td>Registered</td><td>sometime</td>
+<td>GeekGold</td><td>12.00</td>
+<td>Thumbs Given</td><td>1</td>
+<td>Thumbs Received</td><td>5</td>`,
+			err: true,
+		},
+		{page: "<p>Please log in.</p>", err: true},
+	}
+
+	for i, test := range tests {
+		got, err := parseStats(test.page)
+		if test.err {
+			if !errors.Is(err, bggclient.ErrUnexpectedLayout) {
+				t.Errorf("%d: parseStats() returned %v, want a layout error", i, err)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("%d: parseStats() == %+v, %v, want %+v", i, got, err, test.want)
+		}
+	}
+}
+
+func TestYears(t *testing.T) {
+	stats := Stats{Registered: date("2008-03-14")}
+	tests := []struct {
+		now  string
+		want int
+	}{
+		{"2008-03-14", 0},
+		{"2009-03-13", 0},
+		{"2009-03-14", 1},
+		{"2026-10-18", 18},
+		{"2001-01-01", 0},
+	}
+
+	for _, test := range tests {
+		if got := stats.Years(date(test.now)); got != test.want {
+			t.Errorf("Years(%s) == %d, want %d", test.now, got, test.want)
+		}
+	}
+}
+
+func TestProvider(t *testing.T) {
+	server := bggtest.NewServer()
+	defer server.Close()
+	server.AddUser(bggtest.User{Username: "alice", PassHash: "hash", Stats: bggtest.Stats{
+		Registered:     "2008-03-14",
+		GeekGold:       7.25,
+		ThumbsGiven:    1500,
+		ThumbsReceived: 42,
+		Posts:          9,
+	}})
+
+	client, err := server.NewClient("alice")
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	p := NewProvider(client)
+	p.now = func() time.Time { return date("2026-10-18") }
+
+	got, err := parser.New(parser.WithProvider(p)).Expand(context.Background(),
+		"[THR] thumbs up, [THG] given, [GG] GG, [POSTS] posts in [YRS] years")
+	if err != nil {
+		t.Fatalf("Expand: %v", err)
+	}
+	if want := "42 thumbs up, 1500 given, 7.25 GG, 9 posts in 18 years"; got != want {
+		t.Errorf("Expand() == %q, want %q", got, want)
+	}
+}
+
+// Local Variables:
+// compile-command: "go test"
+// End:
@@ -0,0 +1,368 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package schedule picks the theme your GUR should follow on a given day: holidays,
+// conventions, game nights. A theme says where the randomizers get their choices
+// from while it applies. Themes are read from a TOML (or, if the file name ends in
+// .json, JSON) file:
+//
+//	# the time zone days are counted in (by default the local one)
+//	timezone = "Europe/Berlin"
+//
+//	[[theme]]
+//	name = "essen"
+//	from = "10-20"              # every year from October 20th...
+//	to = "10-27"                # ...to October 27th
+//	microbadges = [1234, 5678]  # show only these (if you have them)
+//	avatars = "avatars/essen"   # a folder of images, as for av-randomize
+//	overtext = "essen.json"     # a file of overtext, as for ot-randomize
+//
+//	[[theme]]
+//	name = "game night"
+//	weekdays = ["friday"]
+//	geekbadges = "geekbadges/game-night"
+//	constraints = "game-night.toml"
+//
+//	[[theme]]
+//	name = "thanksgiving"
+//	nth = {week = 4, weekday = "thursday", month = 11}
+//	left_words = ["Thankful"]   # for the lambda-update-geekbadge function
+//
+// Dates are "MM-DD", recurring every year (a range may wrap past the new year), or
+// "YYYY-MM-DD" for a range that happens once. A week of -1 in nth means the last
+// such weekday of the month, and a month of 0 every month. A theme applies on a day
+// matching all of its rules; when several apply, the first in the file wins. Relative
+// paths are relative to the themes file.
+//
+package schedule
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/profburke/bgurt/microbadge"
+)
+
+// Nth is a recurring rule for the Week'th Weekday of Month, such as the fourth
+// Thursday of November. A Week of -1 means the last one, and a Month of 0 means
+// every month.
+//
+type Nth struct {
+	Week    int    `toml:"week" json:"week"`
+	Weekday string `toml:"weekday" json:"weekday"`
+	Month   int    `toml:"month" json:"month,omitempty"`
+}
+
+// Theme is a set of rules saying when the theme applies, and the sources the
+// randomizers use while it does. Sources left empty are not affected by the theme.
+//
+type Theme struct {
+	Name string `toml:"name" json:"name"`
+
+	From     string   `toml:"from" json:"from,omitempty"`
+	To       string   `toml:"to" json:"to,omitempty"`
+	Weekdays []string `toml:"weekdays" json:"weekdays,omitempty"`
+	Nth      *Nth     `toml:"nth" json:"nth,omitempty"`
+
+	Microbadges []uint   `toml:"microbadges" json:"microbadges,omitempty"`
+	Constraints string   `toml:"constraints" json:"constraints,omitempty"`
+	Geekbadges  string   `toml:"geekbadges" json:"geekbadges,omitempty"`
+	Avatars     string   `toml:"avatars" json:"avatars,omitempty"`
+	Overtext    string   `toml:"overtext" json:"overtext,omitempty"`
+	LeftWords   []string `toml:"left_words" json:"left_words,omitempty"`
+	RightWords  []string `toml:"right_words" json:"right_words,omitempty"`
+}
+
+// Schedule is the contents of a themes file.
+//
+type Schedule struct {
+	Timezone string  `toml:"timezone" json:"timezone,omitempty"`
+	Themes   []Theme `toml:"theme" json:"theme,omitempty"`
+
+	location *time.Location
+}
+
+// Load reads and checks a themes file, making the paths in it relative to the
+// directory it is in.
+//
+func Load(filename string) (s *Schedule, err error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("schedule.Load: %w", err)
+	}
+
+	s, err = Parse(data, strings.EqualFold(filepath.Ext(filename), ".json"))
+	if err != nil {
+		return nil, fmt.Errorf("schedule.Load: %s: %v", filename, err)
+	}
+
+	dir := filepath.Dir(filename)
+	for i := range s.Themes {
+		th := &s.Themes[i]
+		for _, path := range []*string{&th.Constraints, &th.Geekbadges, &th.Avatars, &th.Overtext} {
+			if *path != "" && !filepath.IsAbs(*path) {
+				*path = filepath.Join(dir, *path)
+			}
+		}
+	}
+
+	return s, nil
+}
+
+// Parse is like Load for a themes file already in memory, in JSON if isJSON is set
+// and TOML otherwise. Paths are left as they are.
+//
+func Parse(data []byte, isJSON bool) (s *Schedule, err error) {
+	s = &Schedule{}
+	if isJSON {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(s)
+	} else {
+		var md toml.MetaData
+		md, err = toml.Decode(string(data), s)
+		if err == nil {
+			if undecoded := md.Undecoded(); len(undecoded) > 0 {
+				err = fmt.Errorf("unknown key '%s'", undecoded[0])
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.Check(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Check reports mistakes in the schedule, such as a badly written date or a theme
+// with no rules saying when it applies.
+//
+func (s *Schedule) Check() error {
+	s.location = time.Local
+	if s.Timezone != "" {
+		location, err := time.LoadLocation(s.Timezone)
+		if err != nil {
+			return fmt.Errorf("unknown timezone %q", s.Timezone)
+		}
+		s.location = location
+	}
+
+	for i, th := range s.Themes {
+		name := th.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+
+		if th.From == "" && th.To == "" && len(th.Weekdays) == 0 && th.Nth == nil {
+			return fmt.Errorf("theme %s has no from, to, weekdays or nth rule", name)
+		}
+		if (th.From == "") != (th.To == "") {
+			return fmt.Errorf("theme %s needs both from and to", name)
+		}
+		if th.From != "" {
+			from, err := ParseDate(th.From)
+			if err != nil {
+				return fmt.Errorf("theme %s: %v", name, err)
+			}
+			to, err := ParseDate(th.To)
+			if err != nil {
+				return fmt.Errorf("theme %s: %v", name, err)
+			}
+			if (from.Year == 0) != (to.Year == 0) {
+				return fmt.Errorf("theme %s: from and to must both have a year, or neither", name)
+			}
+			if from.Year != 0 && to.before(from) {
+				return fmt.Errorf("theme %s ends before it starts", name)
+			}
+		}
+		for _, day := range th.Weekdays {
+			if _, err := parseWeekday(day); err != nil {
+				return fmt.Errorf("theme %s: %v", name, err)
+			}
+		}
+		if nth := th.Nth; nth != nil {
+			if _, err := parseWeekday(nth.Weekday); err != nil {
+				return fmt.Errorf("theme %s: %v", name, err)
+			}
+			if nth.Week == 0 || nth.Week < -1 || nth.Week > 5 {
+				return fmt.Errorf("theme %s: nth week must be 1 to 5, or -1 for the last", name)
+			}
+			if nth.Month < 0 || nth.Month > 12 {
+				return fmt.Errorf("theme %s: nth month must be 1 to 12, or 0 for every month", name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Active returns the first theme that applies at time t, or nil if none does.
+//
+func (s *Schedule) Active(t time.Time) *Theme {
+	if s == nil {
+		return nil
+	}
+	if s.location == nil {
+		s.location = time.Local
+	}
+
+	t = t.In(s.location)
+	for i := range s.Themes {
+		if s.Themes[i].Applies(t) {
+			return &s.Themes[i]
+		}
+	}
+
+	return nil
+}
+
+// Applies reports whether the theme applies on the day of t (in t's location). The
+// theme should have passed Check.
+//
+func (th *Theme) Applies(t time.Time) bool {
+	day := Date{Year: t.Year(), Month: int(t.Month()), Day: t.Day()}
+
+	if th.From != "" {
+		from, _ := ParseDate(th.From)
+		to, _ := ParseDate(th.To)
+		if from.Year == 0 {
+			// the range recurs every year, so compare within the year; a range
+			// ending before it starts wraps past the new year
+			day.Year = 0
+			if to.before(from) {
+				if day.before(from) && to.before(day) {
+					return false
+				}
+			} else if day.before(from) || to.before(day) {
+				return false
+			}
+		} else if day.before(from) || to.before(day) {
+			return false
+		}
+	}
+
+	if len(th.Weekdays) > 0 {
+		found := false
+		for _, name := range th.Weekdays {
+			if weekday, _ := parseWeekday(name); weekday == t.Weekday() {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if nth := th.Nth; nth != nil {
+		weekday, _ := parseWeekday(nth.Weekday)
+		if t.Weekday() != weekday || (nth.Month != 0 && int(t.Month()) != nth.Month) {
+			return false
+		}
+		if nth.Week == -1 {
+			// the last one: a week later is next month
+			if t.AddDate(0, 0, 7).Month() == t.Month() {
+				return false
+			}
+		} else if (t.Day()-1)/7+1 != nth.Week {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Badges returns those of badges the theme allows: the ones in Microbadges, or all
+// of them if it is empty.
+//
+func (th *Theme) Badges(badges []microbadge.Microbadge) (allowed []microbadge.Microbadge) {
+	if len(th.Microbadges) == 0 {
+		return badges
+	}
+
+	wanted := make(map[uint]bool)
+	for _, n := range th.Microbadges {
+		wanted[n] = true
+	}
+	for _, mb := range badges {
+		if wanted[mb.BadgeNumber] {
+			allowed = append(allowed, mb)
+		}
+	}
+
+	return
+}
+
+// Date is a day, with a zero Year for one that recurs every year.
+//
+type Date struct {
+	Year, Month, Day int
+}
+
+func (d Date) before(other Date) bool {
+	if d.Year != other.Year {
+		return d.Year < other.Year
+	}
+	if d.Month != other.Month {
+		return d.Month < other.Month
+	}
+
+	return d.Day < other.Day
+}
+
+// ParseDate reads a day written "YYYY-MM-DD", or "MM-DD" for one that recurs every
+// year. The countdown package reads its event dates the same way.
+//
+func ParseDate(s string) (d Date, err error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return Date{Year: t.Year(), Month: int(t.Month()), Day: t.Day()}, nil
+	}
+	// 2000 is a leap year, so February 29th is accepted
+	if t, err := time.Parse("2006-01-02", "2000-"+s); err == nil && len(s) == len("01-02") {
+		return Date{Month: int(t.Month()), Day: t.Day()}, nil
+	}
+
+	return Date{}, fmt.Errorf("bad date %q (must be MM-DD or YYYY-MM-DD)", s)
+}
+
+func parseWeekday(s string) (weekday time.Weekday, err error) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		name := d.String()
+		if strings.EqualFold(s, name) || strings.EqualFold(s, name[:3]) {
+			return d, nil
+		}
+	}
+
+	return 0, fmt.Errorf("bad weekday %q", s)
+}
+
+// Local Variables:
+// compile-command: "go build"
+// End:
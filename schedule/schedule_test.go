@@ -0,0 +1,159 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package schedule
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/profburke/bgurt/microbadge"
+)
+
+const themes = `
+timezone = "UTC"
+
+[[theme]]
+name = "new year"
+from = "12-30"
+to = "01-02"
+
+[[theme]]
+name = "essen"
+from = "10-20"
+to = "10-27"
+avatars = "essen"
+
+[[theme]]
+name = "essen friday"
+from = "10-20"
+to = "10-27"
+weekdays = ["fri"]
+
+[[theme]]
+name = "thanksgiving"
+nth = {week = 4, weekday = "thursday", month = 11}
+
+[[theme]]
+name = "last monday"
+nth = {week = -1, weekday = "Monday"}
+
+[[theme]]
+name = "launch"
+from = "2020-06-01"
+to = "2020-06-03"
+
+[[theme]]
+name = "game night"
+weekdays = ["friday", "saturday"]
+`
+
+func TestActive(t *testing.T) {
+	s, err := Parse([]byte(themes), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		day  string
+		want string
+	}{
+		{"2020-12-31", "new year"},
+		{"2021-01-02", "new year"},
+		{"2021-01-03", ""},      // a Sunday
+		{"2020-10-23", "essen"}, // a Friday, but essen comes first
+		{"2020-11-26", "thanksgiving"},
+		{"2020-11-19", ""},
+		{"2020-11-30", "last monday"},
+		{"2020-11-23", ""},
+		{"2020-06-02", "launch"},
+		{"2021-06-02", ""},
+		{"2020-11-20", "game night"},
+	}
+
+	for _, test := range tests {
+		day, _ := time.Parse("2006-01-02", test.day)
+		day = day.Add(12 * time.Hour)
+
+		var got string
+		if theme := s.Active(day); theme != nil {
+			got = theme.Name
+		}
+		if got != test.want {
+			t.Errorf("on %s theme %q applies, want %q", test.day, got, test.want)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	var tests = []struct {
+		contents, wantErr string
+	}{
+		{"[[theme]]\nname = \"x\"\n", "has no from"},
+		{"[[theme]]\nfrom = \"10-20\"\n", "both from and to"},
+		{"[[theme]]\nfrom = \"10-32\"\nto = \"11-01\"\n", "bad date"},
+		{"[[theme]]\nfrom = \"2020-10-20\"\nto = \"11-01\"\n", "both have a year"},
+		{"[[theme]]\nfrom = \"2020-10-20\"\nto = \"2020-10-01\"\n", "ends before"},
+		{"[[theme]]\nweekdays = [\"funday\"]\n", "bad weekday"},
+		{"[[theme]]\nnth = {week = 6, weekday = \"monday\"}\n", "week must be"},
+		{"[[theme]]\nweekdays = [\"monday\"]\navatar = \"x\"\n", "unknown key"},
+		{"timezone = \"Mars/Olympus\"\n", "unknown timezone"},
+	}
+
+	for _, test := range tests {
+		_, err := Parse([]byte(test.contents), false)
+		if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+			t.Errorf("parsing %q gave error %v, want one containing %q", test.contents, err, test.wantErr)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "themes.json")
+	contents := `{"theme": [{"name": "x", "weekdays": ["monday"], "avatars": "av", "overtext": "/ot.json", "microbadges": [1, 3]}]}`
+	if err := ioutil.WriteFile(filename, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Load(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	theme := s.Themes[0]
+	if theme.Avatars != filepath.Join(dir, "av") || theme.Overtext != "/ot.json" {
+		t.Errorf("Load gave paths %q and %q", theme.Avatars, theme.Overtext)
+	}
+
+	badges := []microbadge.Microbadge{{BadgeNumber: 1}, {BadgeNumber: 2}, {BadgeNumber: 3}}
+	if got := theme.Badges(badges); !reflect.DeepEqual(got, []microbadge.Microbadge{badges[0], badges[2]}) {
+		t.Errorf("Badges gave %v", got)
+	}
+}
+
+// Local Variables:
+// compile-command: "go test"
+// End:
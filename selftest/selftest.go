@@ -0,0 +1,241 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package selftest runs each of the bgurt scrapers once, read-only, and collects what
+// they found. Run against BGG it shows whether the scrapers still work; recorded with
+// Record and replayed by the package's tests it catches layout changes in BGG's pages:
+// refreshing the fixtures after a change turns up as a failing test or a diff in the
+// recorded results.
+//
+package selftest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/profburke/bgurt/avatar"
+	"github.com/profburke/bgurt/bggclient"
+	"github.com/profburke/bgurt/bggclient/cassette"
+	"github.com/profburke/bgurt/geekbadge"
+	"github.com/profburke/bgurt/microbadge"
+	"github.com/profburke/bgurt/overtext"
+	"github.com/profburke/bgurt/profile"
+)
+
+const CassetteFilename = "cassette.json"
+const ResultsFilename = "results.json"
+
+// Placeholders written to the fixtures in place of the real username and password
+// hash. Replay logs in with them.
+//
+const (
+	ScrubbedUsername = "bgurt-user"
+	ScrubbedPassHash = "bgurt-passhash"
+)
+
+// Step names, in the order Run performs them.
+//
+const (
+	StepOvertext   = "overtext"
+	StepGeekbadge  = "geekbadge"
+	StepList       = "microbadge list"
+	StepSlots      = "microbadge slots"
+	StepMicrobadge = "microbadge"
+	StepAvatar     = "avatar"
+	StepProfile    = "profile"
+)
+
+var Steps = []string{StepOvertext, StepGeekbadge, StepList, StepSlots, StepMicrobadge, StepAvatar, StepProfile}
+
+// Results holds what each scraper found. The avatar is recorded as a hash of
+// the image rather than the image itself.
+//
+type Results struct {
+	Overtext     overtext.Overtext
+	Geekbadge    geekbadge.Geekbadge
+	Microbadges  []microbadge.Microbadge
+	Slots        []microbadge.Microbadge
+	Microbadge   microbadge.Microbadge
+	AvatarSHA256 string
+	Profile      profile.Stats
+	Failures     map[string]string `json:",omitempty"`
+}
+
+// Run performs every step, even when an earlier one fails, and returns the
+// results along with the first error. Failures records the error of every step
+// that failed. The metadata step uses the first badge in the user's list, so it
+// is skipped for a user with no badges.
+//
+func Run(ctx context.Context, client *bggclient.Client) (results Results, err error) {
+	fail := func(step string, stepErr error) {
+		if results.Failures == nil {
+			results.Failures = make(map[string]string)
+		}
+		results.Failures[step] = stepErr.Error()
+		if err == nil {
+			err = fmt.Errorf("selftest: %s: %w", step, stepErr)
+		}
+	}
+
+	var stepErr error
+
+	if results.Overtext, stepErr = overtext.GetContext(ctx, client); stepErr != nil {
+		fail(StepOvertext, stepErr)
+	}
+
+	if results.Geekbadge, stepErr = geekbadge.GetContext(ctx, client); stepErr != nil {
+		fail(StepGeekbadge, stepErr)
+	}
+
+	if results.Microbadges, stepErr = microbadge.ListContext(ctx, client); stepErr != nil {
+		fail(StepList, stepErr)
+	}
+
+	if results.Slots, stepErr = microbadge.GetSlotsContext(ctx, client); stepErr != nil {
+		fail(StepSlots, stepErr)
+	}
+
+	if len(results.Microbadges) > 0 {
+		number := results.Microbadges[0].BadgeNumber
+		if results.Microbadge, stepErr = microbadge.GetContext(ctx, client, number); stepErr != nil {
+			fail(StepMicrobadge, stepErr)
+		}
+	}
+
+	if results.AvatarSHA256, stepErr = avatarHash(ctx, client); stepErr != nil {
+		fail(StepAvatar, stepErr)
+	}
+
+	if results.Profile, stepErr = profile.GetStatsContext(ctx, client); stepErr != nil {
+		fail(StepProfile, stepErr)
+	}
+
+	return
+}
+
+func avatarHash(ctx context.Context, client *bggclient.Client) (hash string, err error) {
+	dir, err := ioutil.TempDir("", "bgurt-selftest")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "avatar")
+	err = avatar.GetContext(ctx, client, filename)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Record runs the steps against the site the options point to (BGG by default),
+// logged in with credentials, and writes the conversation and the results to dir
+// as fixtures for Replay. The username and password hash are replaced by
+// placeholders in both files. Nothing is written if BGG rejects the credentials.
+//
+func Record(ctx context.Context, credentials bggclient.Credentials, dir string, options ...bggclient.Option) (results Results, err error) {
+	recorder, err := cassette.New(filepath.Join(dir, CassetteFilename), cassette.Record, nil,
+		cassette.Scrub(credentials.PassHash, ScrubbedPassHash),
+		cassette.Scrub(credentials.Username, ScrubbedUsername))
+	if err != nil {
+		return Results{}, fmt.Errorf("selftest.Record: %w", err)
+	}
+
+	options = append(options, bggclient.WithTransport(recorder), bggclient.WithCredentials(credentials))
+	client, err := bggclient.New(options...)
+	if err != nil {
+		return Results{}, fmt.Errorf("selftest.Record: %w", err)
+	}
+
+	results, err = Run(ctx, client)
+	if errors.Is(err, bggclient.ErrNotAuthenticated) || errors.Is(err, context.Canceled) {
+		return results, err
+	}
+
+	if saveErr := recorder.Save(); saveErr != nil {
+		return results, fmt.Errorf("selftest.Record: %w", saveErr)
+	}
+
+	if saveErr := saveResults(filepath.Join(dir, ResultsFilename), results); saveErr != nil {
+		return results, fmt.Errorf("selftest.Record: %w", saveErr)
+	}
+
+	return
+}
+
+// Replay runs the steps against the fixtures in dir instead of the network.
+// Pass the same options (other than credentials) as were passed to Record.
+//
+func Replay(ctx context.Context, dir string, options ...bggclient.Option) (results Results, err error) {
+	recorder, err := cassette.New(filepath.Join(dir, CassetteFilename), cassette.Replay, nil)
+	if err != nil {
+		return Results{}, fmt.Errorf("selftest.Replay: %w", err)
+	}
+
+	credentials := bggclient.Credentials{Username: ScrubbedUsername, PassHash: ScrubbedPassHash}
+	options = append(options, bggclient.WithTransport(recorder), bggclient.WithCredentials(credentials),
+		bggclient.WithRateLimit(0), bggclient.WithRetryPolicy(bggclient.NoRetry))
+	client, err := bggclient.New(options...)
+	if err != nil {
+		return Results{}, fmt.Errorf("selftest.Replay: %w", err)
+	}
+
+	return Run(ctx, client)
+}
+
+// LoadResults reads the results written by Record.
+//
+func LoadResults(dir string) (results Results, err error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, ResultsFilename))
+	if err != nil {
+		return Results{}, err
+	}
+
+	err = json.Unmarshal(data, &results)
+	return
+}
+
+func saveResults(filename string, results Results) error {
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filename, append(data, '\n'), 0644)
+}
+
+// Local Variables:
+// compile-command: "go build"
+// End:
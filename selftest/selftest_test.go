@@ -0,0 +1,143 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package selftest
+
+import (
+	"context"
+	"image/color"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/profburke/bgurt/bggclient"
+	"github.com/profburke/bgurt/bggclient/bggtest"
+	"github.com/profburke/bgurt/geekbadge"
+)
+
+// TestFixtures replays the conversation with BGG in testdata and checks the scrapers
+// still find what they found when it was recorded. To refresh the fixtures, run
+// `bgurt selftest -record` from the top of the repository; the committed ones were
+// recorded from the bggtest site, with its URL replaced by BGG's.
+//
+func TestFixtures(t *testing.T) {
+	dir := "testdata"
+
+	want, err := LoadResults(dir)
+	if err != nil {
+		t.Fatalf("LoadResults: %v", err)
+	}
+
+	got, err := Replay(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("replayed results differ from %s\ngot:  %+v\nwant: %+v",
+			filepath.Join(dir, ResultsFilename), got, want)
+	}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	server := bggtest.NewServer()
+	defer server.Close()
+	server.AddBadge(bggtest.Badge{
+		Number:         1234,
+		Name:           "I play games",
+		Category:       bggtest.Group{Number: 3, Name: "Gaming"},
+		Subcategory:    bggtest.Group{Number: 31, Name: "General"},
+		NumberOfOwners: 4321,
+	})
+	server.AddUser(bggtest.User{
+		Username:       "alice",
+		PassHash:       "s3cr3th4sh",
+		Badges:         []uint{1234},
+		AvatarOvertext: "alice plays games",
+		Avatar:         []byte("GIF89a not really an image"),
+		AvatarType:     "gif",
+	})
+
+	client, err := server.NewClient("alice")
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	gb := geekbadge.Geekbadge{
+		OuterBorder: color.RGBA{106, 90, 205, 255},
+		InnerBorder: color.RGBA{138, 43, 226, 255},
+		BarPosition: 40,
+		LeftBox:     geekbadge.Box{Text: "alice", Background: color.RGBA{85, 107, 47, 255}, TextColor: color.RGBA{152, 251, 152, 255}, TextStart: 4},
+		RightBox:    geekbadge.Box{Text: "Meeples", Background: color.RGBA{152, 251, 152, 255}, TextColor: color.RGBA{85, 107, 47, 255}, TextStart: 44},
+	}
+	if _, err := geekbadge.Set(client, gb); err != nil {
+		t.Fatalf("geekbadge.Set: %v", err)
+	}
+
+	dir := t.TempDir()
+	options := []bggclient.Option{bggclient.WithBaseURL(server.URL), bggclient.WithRateLimit(0)}
+
+	recorded, err := Record(context.Background(), server.Credentials("alice"), dir, options...)
+	if err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	if len(recorded.Microbadges) != 1 || recorded.Microbadge.NumberOfOwners != 4321 || recorded.AvatarSHA256 == "" {
+		t.Errorf("Record found %+v", recorded)
+	}
+	if recorded.Overtext.Avatar == nil || *recorded.Overtext.Avatar != ScrubbedUsername+" plays games" {
+		t.Errorf("recorded avatar overtext == %v, want the username scrubbed", recorded.Overtext)
+	}
+
+	for _, name := range []string{CassetteFilename, ResultsFilename} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, secret := range []string{"alice", "s3cr3th4sh", "bggusername", "bggpassword"} {
+			if strings.Contains(string(data), secret) {
+				t.Errorf("%s contains %q", name, secret)
+			}
+		}
+	}
+
+	// the server is gone, so replay can only be answered from the cassette
+	server.Close()
+
+	replayed, err := Replay(context.Background(), dir, options...)
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	if !reflect.DeepEqual(replayed, recorded) {
+		t.Errorf("Replay == %+v, want %+v", replayed, recorded)
+	}
+
+	saved, err := LoadResults(dir)
+	if err != nil {
+		t.Fatalf("LoadResults: %v", err)
+	}
+	if !reflect.DeepEqual(saved, recorded) {
+		t.Errorf("LoadResults == %+v, want %+v", saved, recorded)
+	}
+}
+
+// Local Variables:
+// compile-command: "go test"
+// End:
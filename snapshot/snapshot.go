@@ -0,0 +1,403 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package snapshot captures everything bgurt can change on a profile (the avatar,
+// geekbadge, overtext and the microbadges in the display slots) in a single archive,
+// so that the profile can later be put back the way it was.
+//
+// An archive is a zip file holding snapshot.json, the Snapshot itself, and the
+// avatar image it names.
+//
+package snapshot
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/profburke/bgurt/avatar"
+	"github.com/profburke/bgurt/bggclient"
+	"github.com/profburke/bgurt/geekbadge"
+	"github.com/profburke/bgurt/microbadge"
+	"github.com/profburke/bgurt/overtext"
+)
+
+// Version is the version of the snapshot format written by Encode.
+//
+const Version = 1
+
+// manifestName is the name of the Snapshot in an archive.
+//
+const manifestName = "snapshot.json"
+
+// A Part is one of the parts of a profile in a snapshot.
+//
+type Part string
+
+const (
+	Avatar      Part = "avatar"
+	Geekbadge   Part = "geekbadge"
+	Overtext    Part = "overtext"
+	Microbadges Part = "microbadges"
+)
+
+// Parts lists the parts of a profile, in the order they are restored.
+//
+var Parts = []Part{Avatar, Geekbadge, Overtext, Microbadges}
+
+// Snapshot is the state of a profile at the time it was taken.
+//
+type Snapshot struct {
+	Version     int                     `json:"version"`
+	Taken       time.Time               `json:"taken"`
+	Username    string                  `json:"username,omitempty"`
+	AvatarFile  string                  `json:"avatar_file,omitempty"` // name of the avatar in the archive; empty if there was none
+	Avatar      []byte                  `json:"-"`
+	Geekbadge   geekbadge.Geekbadge     `json:"geekbadge"`
+	Overtext    overtext.Overtext       `json:"overtext"`
+	Microbadges []microbadge.Microbadge `json:"microbadges"` // the slots, in order; empty slots have BadgeNumber 0
+}
+
+// Take captures the profile of the user client is logged in as.
+//
+func Take(client *bggclient.Client) (s *Snapshot, err error) {
+	return TakeContext(context.Background(), client)
+}
+
+// TakeContext is like Take but gives up when ctx is done.
+//
+func TakeContext(ctx context.Context, client *bggclient.Client) (s *Snapshot, err error) {
+	s = &Snapshot{Version: Version, Taken: time.Now().UTC().Truncate(time.Second)}
+
+	if s.Avatar, err = getAvatar(ctx, client); err != nil {
+		return nil, fmt.Errorf("snapshot.Take: %w", err)
+	}
+	if s.Avatar != nil {
+		s.AvatarFile = avatarFile(s.Avatar)
+	}
+
+	if s.Geekbadge, err = geekbadge.GetContext(ctx, client); err != nil {
+		return nil, fmt.Errorf("snapshot.Take: %w", err)
+	}
+	if s.Overtext, err = overtext.GetContext(ctx, client); err != nil {
+		return nil, fmt.Errorf("snapshot.Take: %w", err)
+	}
+	if s.Microbadges, err = microbadge.GetSlotsContext(ctx, client); err != nil {
+		return nil, fmt.Errorf("snapshot.Take: %w", err)
+	}
+
+	return s, nil
+}
+
+// getAvatar returns the user's avatar image, or nil if they don't have one.
+//
+func getAvatar(ctx context.Context, client *bggclient.Client) (data []byte, err error) {
+	dir, err := ioutil.TempDir("", "bgurt-snapshot")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "avatar")
+	err = avatar.GetContext(ctx, client, filename)
+	if errors.Is(err, avatar.ErrNoAvatar) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return ioutil.ReadFile(filename)
+}
+
+// avatarFile names an avatar image after its type, which is how BGG tells what
+// kind of image an upload is.
+//
+func avatarFile(data []byte) string {
+	switch http.DetectContentType(data) {
+	case "image/png":
+		return "avatar.png"
+	case "image/jpeg":
+		return "avatar.jpg"
+	default:
+		return "avatar.gif"
+	}
+}
+
+// Encode returns the snapshot as an archive.
+//
+func (s *Snapshot) Encode() (data []byte, err error) {
+	current := *s
+	current.Version = Version
+
+	manifest, err := json.MarshalIndent(current, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("snapshot.Encode: %v", err)
+	}
+
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{manifestName, manifest},
+		{current.AvatarFile, current.Avatar},
+	}
+	for _, file := range files {
+		if file.name == "" {
+			continue
+		}
+		w, err := archive.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: current.Taken})
+		if err == nil {
+			_, err = w.Write(file.data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("snapshot.Encode: %v", err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, fmt.Errorf("snapshot.Encode: %v", err)
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// Decode reads a snapshot from an archive written by Encode.
+//
+func Decode(data []byte) (s *Snapshot, err error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("snapshot.Decode: not a snapshot: %v", err)
+	}
+
+	manifest, err := readFile(archive, manifestName)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot.Decode: not a snapshot: %v", err)
+	}
+	s = &Snapshot{}
+	if err := json.Unmarshal(manifest, s); err != nil {
+		return nil, fmt.Errorf("snapshot.Decode: %v", err)
+	}
+	if s.Version < 1 || s.Version > Version {
+		return nil, fmt.Errorf("snapshot.Decode: snapshot version %d is not supported (this bgurt reads up to version %d)",
+			s.Version, Version)
+	}
+	if len(s.Microbadges) != microbadge.TotalSlots {
+		return nil, fmt.Errorf("snapshot.Decode: snapshot has %d microbadge slots, not %d",
+			len(s.Microbadges), microbadge.TotalSlots)
+	}
+
+	if s.AvatarFile != "" {
+		if s.Avatar, err = readFile(archive, s.AvatarFile); err != nil {
+			return nil, fmt.Errorf("snapshot.Decode: %v", err)
+		}
+	}
+
+	return s, nil
+}
+
+// readFile returns the contents of the named file in archive.
+//
+func readFile(archive *zip.Reader, name string) (data []byte, err error) {
+	for _, file := range archive.File {
+		if file.Name != name {
+			continue
+		}
+		r, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+
+		return ioutil.ReadAll(r)
+	}
+
+	return nil, fmt.Errorf("no %s in the archive", name)
+}
+
+// Difference is something that restoring a snapshot would change.
+//
+type Difference struct {
+	Part Part
+	What string // what changes, for example "microbadge slot 2"
+	From string
+	To   string
+}
+
+func (d Difference) String() string {
+	return fmt.Sprintf("%s: %s -> %s", d.What, d.From, d.To)
+}
+
+// Diff lists what would change in going from the profile in from to the one in to,
+// part by part. An avatar can't be removed, so a to with no avatar leaves the
+// avatar alone.
+//
+func Diff(from, to *Snapshot) (differences []Difference) {
+	add := func(part Part, what, before, after string) {
+		if before != after {
+			differences = append(differences, Difference{Part: part, What: what, From: before, To: after})
+		}
+	}
+
+	if to.Avatar != nil {
+		add(Avatar, "avatar", describeAvatar(from.Avatar), describeAvatar(to.Avatar))
+	}
+
+	add(Geekbadge, "geekbadge", describeGeekbadge(from.Geekbadge), describeGeekbadge(to.Geekbadge))
+
+	add(Overtext, "avatar overtext", quote(from.Overtext.Avatar), quote(to.Overtext.Avatar))
+	add(Overtext, "badge overtext", quote(from.Overtext.Badge), quote(to.Overtext.Badge))
+
+	for i := 0; i < microbadge.TotalSlots; i++ {
+		add(Microbadges, fmt.Sprintf("microbadge slot %d", i+1),
+			describeSlot(from.Microbadges, i), describeSlot(to.Microbadges, i))
+	}
+
+	return differences
+}
+
+func describeAvatar(data []byte) string {
+	if data == nil {
+		return "none"
+	}
+
+	sum := sha256.Sum256(data)
+	return fmt.Sprintf("%s, %d bytes (%x)", avatarFile(data), len(data), sum[:4])
+}
+
+func describeGeekbadge(gb geekbadge.Geekbadge) string {
+	hex := func(c interface{ RGBA() (r, g, b, a uint32) }) string {
+		r, g, b, _ := c.RGBA()
+		return fmt.Sprintf("#%02x%02x%02x", uint8(r), uint8(g), uint8(b))
+	}
+
+	return fmt.Sprintf("%v (borders %s/%s, bar at %d, left %s on %s from %d, right %s on %s from %d)",
+		gb, hex(gb.OuterBorder), hex(gb.InnerBorder), gb.BarPosition,
+		hex(gb.LeftBox.TextColor), hex(gb.LeftBox.Background), gb.LeftBox.TextStart,
+		hex(gb.RightBox.TextColor), hex(gb.RightBox.Background), gb.RightBox.TextStart)
+}
+
+func quote(text *string) string {
+	if text == nil {
+		return `""`
+	}
+
+	return fmt.Sprintf("%q", *text)
+}
+
+func describeSlot(slots []microbadge.Microbadge, i int) string {
+	if i >= len(slots) || slots[i].BadgeNumber == 0 {
+		return "empty"
+	}
+
+	return fmt.Sprintf("#%d %s", slots[i].BadgeNumber, slots[i].Name)
+}
+
+// Restore puts the given parts of the profile back the way they are in s. An
+// avatar can't be removed, so if s has none the avatar is left alone.
+//
+func Restore(client *bggclient.Client, s *Snapshot, parts []Part) (err error) {
+	return RestoreContext(context.Background(), client, s, parts)
+}
+
+// RestoreContext is like Restore but gives up when ctx is done.
+//
+func RestoreContext(ctx context.Context, client *bggclient.Client, s *Snapshot, parts []Part) (err error) {
+	for _, part := range parts {
+		switch part {
+		case Avatar:
+			err = setAvatar(ctx, client, s)
+		case Geekbadge:
+			err = saved(geekbadge.SetContext(ctx, client, s.Geekbadge))
+		case Overtext:
+			err = saved(overtext.SetContext(ctx, client, s.Overtext))
+		case Microbadges:
+			err = setSlots(ctx, client, s.Microbadges)
+		default:
+			err = fmt.Errorf("unknown part '%s'", part)
+		}
+		if err != nil {
+			return fmt.Errorf("snapshot.Restore: %s: %w", part, err)
+		}
+	}
+
+	return nil
+}
+
+// saved turns the results of a Set function into an error.
+//
+func saved(success bool, err error) error {
+	if err == nil && !success {
+		err = errors.New("BGG did not save it")
+	}
+
+	return err
+}
+
+func setAvatar(ctx context.Context, client *bggclient.Client, s *Snapshot) error {
+	if s.Avatar == nil {
+		return nil
+	}
+
+	dir, err := ioutil.TempDir("", "bgurt-snapshot")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	// avatar.Set uploads a file, whose name tells BGG what kind of image it is
+	filename := filepath.Join(dir, avatarFile(s.Avatar))
+	if err := ioutil.WriteFile(filename, s.Avatar, 0644); err != nil {
+		return err
+	}
+
+	return avatar.SetContext(ctx, client, filename)
+}
+
+func setSlots(ctx context.Context, client *bggclient.Client, slots []microbadge.Microbadge) error {
+	for i, mb := range slots {
+		slot := uint(i + 1)
+		if mb.BadgeNumber == 0 {
+			if err := microbadge.ClearSlotContext(ctx, client, slot); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := saved(microbadge.SetSlotContext(ctx, client, slot, mb.BadgeNumber)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Local Variables:
+// compile-command: "go build"
+// End:
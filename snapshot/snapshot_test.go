@@ -0,0 +1,202 @@
+// Copyright (c) 2020 BlueDino Software (http://bluedino.net)
+// Redistribution and use in source and binary forms, with or without modification,
+// are permitted provided that the following conditions are met:
+// 1. Redistributions of source code must retain the above copyright notice, this
+//    list of conditions and the following disclaimer.
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+//    this list of conditions and the following disclaimer in the documentation and/or
+//    other materials provided with the distribution.
+// 3. Neither the name of the copyright holder nor the names of its contributors may be
+//    used to endorse or promote products derived from this software without specific prior
+//    written permission.
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY
+// EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL
+// THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT
+// OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION)
+// HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR
+// TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+// SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package snapshot
+
+import (
+	"errors"
+	"image/color"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/profburke/bgurt/avatar"
+	"github.com/profburke/bgurt/bggclient"
+	"github.com/profburke/bgurt/bggclient/bggtest"
+	"github.com/profburke/bgurt/geekbadge"
+	"github.com/profburke/bgurt/microbadge"
+	"github.com/profburke/bgurt/overtext"
+)
+
+// setProfile sets everything a snapshot holds, leaving the avatar alone if image
+// is nil.
+//
+func setProfile(t *testing.T, client *bggclient.Client, image []byte, text string, slots []uint) {
+	t.Helper()
+
+	if image != nil {
+		filename := filepath.Join(t.TempDir(), "avatar.gif")
+		if err := ioutil.WriteFile(filename, image, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := avatar.Set(client, filename); err != nil {
+			t.Fatalf("avatar.Set: %v", err)
+		}
+	}
+
+	gb := geekbadge.Geekbadge{
+		OuterBorder: color.RGBA{106, 90, 205, 255},
+		InnerBorder: color.RGBA{138, 43, 226, 255},
+		BarPosition: 40,
+		LeftBox:     geekbadge.Box{Text: "Play", TextColor: color.RGBA{0, 0, 0, 255}, TextStart: 4},
+		RightBox:    geekbadge.Box{Text: text, Background: color.RGBA{255, 255, 255, 255}, TextStart: 44},
+	}
+	if _, err := geekbadge.Set(client, gb); err != nil {
+		t.Fatalf("geekbadge.Set: %v", err)
+	}
+
+	if _, err := overtext.Set(client, overtext.Overtext{Avatar: &text, Badge: &text}); err != nil {
+		t.Fatalf("overtext.Set: %v", err)
+	}
+
+	for i, number := range slots {
+		if _, err := microbadge.SetSlot(client, uint(i+1), number); err != nil {
+			t.Fatalf("microbadge.SetSlot: %v", err)
+		}
+	}
+}
+
+func TestTakeAndRestore(t *testing.T) {
+	server := bggtest.NewServer()
+	defer server.Close()
+	server.AddUser(bggtest.User{Username: "alice", PassHash: "hash", Badges: []uint{1, 2, 3}})
+
+	client, err := server.NewClient("alice")
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+
+	setProfile(t, client, []byte("GIF89a the original"), "Forever", []uint{1, 2, 3, 1, 2})
+	taken, err := Take(client)
+	if err != nil {
+		t.Fatalf("Take: %v", err)
+	}
+	if taken.AvatarFile != "avatar.gif" || string(taken.Avatar) != "GIF89a the original" {
+		t.Errorf("Take got avatar %s (%q)", taken.AvatarFile, taken.Avatar)
+	}
+	if taken.Geekbadge.RightBox.Text != "Forever" || *taken.Overtext.Badge != "Forever" {
+		t.Errorf("Take got geekbadge %v and overtext %v", taken.Geekbadge, taken.Overtext)
+	}
+
+	data, err := taken.Encode()
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	decoded, err := Decode(data)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, taken) {
+		t.Errorf("Decode(Encode()) == %+v, want %+v", decoded, taken)
+	}
+
+	setProfile(t, client, []byte("GIF89a an experiment"), "Never", []uint{3, 3, 3, 3, 3})
+	current, err := Take(client)
+	if err != nil {
+		t.Fatalf("Take: %v", err)
+	}
+
+	var what []string
+	for _, d := range Diff(current, decoded) {
+		what = append(what, d.What)
+	}
+	want := []string{"avatar", "geekbadge", "avatar overtext", "badge overtext",
+		"microbadge slot 1", "microbadge slot 2", "microbadge slot 4", "microbadge slot 5"}
+	if !reflect.DeepEqual(what, want) {
+		t.Errorf("Diff found %q, want %q", what, want)
+	}
+
+	if err := Restore(client, decoded, Parts); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	restored, err := Take(client)
+	if err != nil {
+		t.Fatalf("Take: %v", err)
+	}
+	if differences := Diff(restored, decoded); len(differences) > 0 {
+		t.Errorf("after Restore, still differs in %v", differences)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	short, err := (&Snapshot{Microbadges: make([]microbadge.Microbadge, 2)}).Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"not an archive", []byte("snapshot"), "not a snapshot"},
+		{"wrong number of slots", short, "2 microbadge slots"},
+	}
+
+	for _, test := range tests {
+		if _, err := Decode(test.data); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: got error %v, want one containing %q", test.name, err, test.err)
+		}
+	}
+}
+
+func TestTakeWithoutAvatar(t *testing.T) {
+	server := bggtest.NewServer()
+	defer server.Close()
+	server.AddUser(bggtest.User{Username: "alice", PassHash: "hash", Badges: []uint{1}})
+
+	client, err := server.NewClient("alice")
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	setProfile(t, client, nil, "Forever", []uint{1})
+
+	taken, err := Take(client)
+	if err != nil {
+		t.Fatalf("Take: %v", err)
+	}
+	if taken.Avatar != nil || taken.AvatarFile != "" {
+		t.Errorf("Take got avatar %s (%q), want none", taken.AvatarFile, taken.Avatar)
+	}
+}
+
+func TestTakeReportsLayoutErrors(t *testing.T) {
+	redesigned := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><body><div class="new-profile-picture"></div></body></html>`))
+	}))
+	defer redesigned.Close()
+
+	client, err := bggclient.New(bggclient.WithBaseURL(redesigned.URL), bggclient.WithRateLimit(0))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if _, err := Take(client); !errors.Is(err, bggclient.ErrUnexpectedLayout) {
+		t.Errorf("Take on a redesigned profile returned %v, want a layout error", err)
+	}
+}
+
+// Local Variables:
+// compile-command: "go test"
+// End: